@@ -0,0 +1,166 @@
+package check
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	cmdutil "github.com/bfrn/karen-preprocessor/pkg/cmd/util"
+	"github.com/bfrn/karen-preprocessor/pkg/preprocessor"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+// Exit codes of the check command. If several guardrails are violated, the codes are combined with a bitwise or.
+// The exit code 1 is reserved for errors.
+const (
+	ExitCodeDeletion        = 2
+	ExitCodeReplacement     = 4
+	ExitCodeMaxChanges      = 8
+	ExitCodeProtectedModule = 16
+)
+
+var exitCodes = map[string]int{
+	preprocessor.Guardrail_rule_delete:           ExitCodeDeletion,
+	preprocessor.Guardrail_rule_replace:          ExitCodeReplacement,
+	preprocessor.Guardrail_rule_max_changes:      ExitCodeMaxChanges,
+	preprocessor.Guardrail_rule_protected_module: ExitCodeProtectedModule,
+}
+
+// Options is a struct to support check command
+type Options struct {
+	InputType string
+
+	inputPath  string
+	configPath string
+	reportPath string
+	format     string
+
+	config *preprocessor.GuardrailConfig
+	args   []string
+}
+
+// NewOptions returns initialized Options
+func NewOptions() *Options {
+	return &Options{
+		InputType: "auto",
+		format:    "text",
+	}
+}
+
+// NewCmdCheck returns a cobra command for checking plans against guardrails
+func NewCmdCheck() *cobra.Command {
+	o := NewOptions()
+	cmd := &cobra.Command{
+		Use:   "check",
+		Short: "Check the changes of a plan against guardrails",
+		Long: fmt.Sprintf(`Check the changes of a plan against the guardrails of a json config file like
+
+  {
+    "denyDelete": ["*aws_db_instance.*", "module.data.*"],
+    "denyReplace": ["*aws_eks_cluster.*"],
+    "maxChanges": 50,
+    "protectedModules": ["module.iam"]
+  }
+
+The command exits with 0 if all guardrails hold and 1 on errors. Violations set the following
+bits of the exit code: %d deletion, %d replacement, %d maximum number of changes, %d protected module.`,
+			ExitCodeDeletion, ExitCodeReplacement, ExitCodeMaxChanges, ExitCodeProtectedModule),
+		Run: func(cmd *cobra.Command, args []string) {
+			cmdutil.CheckErr(o.Complete(args))
+			cmdutil.CheckErr(o.Validate())
+			cmdutil.CheckErr(o.Run())
+		},
+	}
+	cmd.Flags().StringVarP(&o.InputType, "type", "t", o.InputType, "One of 'auto', 'plan' or 'karen'.")
+	cmd.Flags().StringVarP(&o.inputPath, "input", "i", o.inputPath, "relative path to input file.")
+	cmd.Flags().StringVarP(&o.configPath, "config", "c", o.configPath, "relative path to the guardrail config file.")
+	cmd.Flags().StringVar(&o.reportPath, "report", o.reportPath, "relative path to which the result is additionally written as json.")
+	cmd.Flags().StringVar(&o.format, "format", o.format, "One of 'text' or 'json'.")
+
+	cmd.MarkFlagRequired("input")
+	cmd.MarkFlagRequired("config")
+
+	return cmd
+}
+
+// Complete completes all the required options
+func (o *Options) Complete(args []string) error {
+	o.args = args
+	return nil
+}
+
+// Validate validates the provided options
+func (o *Options) Validate() error {
+	if len(o.args) != 0 {
+		return fmt.Errorf("extra arguments: %v", o.args)
+	}
+	if o.InputType != "auto" && o.InputType != "plan" && o.InputType != "karen" {
+		return errors.New(`--type must be 'auto', 'plan' or 'karen'`)
+	}
+	if o.format != "text" && o.format != "json" {
+		return errors.New(`--format must be 'text' or 'json'`)
+	}
+	if o.inputPath == "" || o.configPath == "" {
+		return errors.New("check requires inputPath and configPath")
+	}
+
+	var err error
+	o.InputType, err = cmdutil.ResolveInputType(o.inputPath, o.InputType)
+	if err != nil {
+		return err
+	}
+	if o.InputType != "plan" && o.InputType != "karen" {
+		return fmt.Errorf("check requires a plan or karen file, the input is a %s file", o.InputType)
+	}
+
+	log.Debug().Msgf("read guardrail config %s", o.configPath)
+	data, err := os.ReadFile(o.configPath)
+	if err != nil {
+		return err
+	}
+	o.config, err = preprocessor.ParseGuardrailConfig(data)
+	return err
+}
+
+// Run executes check command
+func (o *Options) Run() error {
+	nodeTable, err := cmdutil.ReadNodeTable(o.inputPath, o.InputType, "", "")
+	if err != nil {
+		return err
+	}
+
+	result := preprocessor.CheckGuardrails(nodeTable, o.config)
+	jsonResult, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+
+	var output []byte
+	switch o.format {
+	case "text":
+		output = []byte(result.Text())
+	case "json":
+		output = append(jsonResult, '\n')
+	}
+	err = cmdutil.WriteOutput("", output)
+	if err != nil {
+		return err
+	}
+	if o.reportPath != "" {
+		err = cmdutil.WriteOutput(o.reportPath, jsonResult)
+		if err != nil {
+			return err
+		}
+	}
+
+	exitCode := 0
+	for _, violation := range result.Violations {
+		exitCode |= exitCodes[violation.Rule]
+	}
+	if exitCode != 0 {
+		return &cmdutil.ExitError{Code: exitCode}
+	}
+	return nil
+}
@@ -1,7 +1,17 @@
 package commands
 
 import (
+	"github.com/bfrn/karen-preprocessor/pkg/cmd/check"
+	"github.com/bfrn/karen-preprocessor/pkg/cmd/exposure"
+	"github.com/bfrn/karen-preprocessor/pkg/cmd/generate"
+	"github.com/bfrn/karen-preprocessor/pkg/cmd/iam"
+	"github.com/bfrn/karen-preprocessor/pkg/cmd/merge"
+	"github.com/bfrn/karen-preprocessor/pkg/cmd/moved"
 	"github.com/bfrn/karen-preprocessor/pkg/cmd/parse"
+	"github.com/bfrn/karen-preprocessor/pkg/cmd/policy"
+	"github.com/bfrn/karen-preprocessor/pkg/cmd/query"
+	"github.com/bfrn/karen-preprocessor/pkg/cmd/summary"
+	"github.com/bfrn/karen-preprocessor/pkg/cmd/validate"
 	"github.com/rs/zerolog"
 	"github.com/spf13/cobra"
 )
@@ -37,6 +47,16 @@ func NewKarenProcessorCommand(o KarenProcessorOptions) *cobra.Command {
 
 	// add sub-commands to root
 	cmd.AddCommand(parse.NewCmdParse())
+	cmd.AddCommand(query.NewCmdQuery())
+	cmd.AddCommand(summary.NewCmdSummary())
+	cmd.AddCommand(check.NewCmdCheck())
+	cmd.AddCommand(policy.NewCmdPolicy())
+	cmd.AddCommand(validate.NewCmdValidate())
+	cmd.AddCommand(merge.NewCmdMerge())
+	cmd.AddCommand(exposure.NewCmdExposure())
+	cmd.AddCommand(iam.NewCmdIAM())
+	cmd.AddCommand(moved.NewCmdMoved())
+	cmd.AddCommand(generate.NewCmdGenerate())
 
 	return cmd
 }
@@ -0,0 +1,123 @@
+package exposure
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	cmdutil "github.com/bfrn/karen-preprocessor/pkg/cmd/util"
+	"github.com/bfrn/karen-preprocessor/pkg/preprocessor"
+	"github.com/spf13/cobra"
+)
+
+// ExitCodeNewlyExposed is the exit code of the exposure command if --fail-on-new is set and the plan exposes new ports.
+const ExitCodeNewlyExposed = 2
+
+// Options is a struct to support exposure command
+type Options struct {
+	InputType string
+
+	inputPath  string
+	outputPath string
+	url        string
+	filePath   string
+	format     string
+	failOnNew  bool
+
+	args []string
+}
+
+// NewOptions returns initialized Options
+func NewOptions() *Options {
+	return &Options{
+		InputType: "auto",
+		format:    "text",
+	}
+}
+
+// NewCmdExposure returns a cobra command for analyzing which resources are reachable from the internet
+func NewCmdExposure() *cobra.Command {
+	o := NewOptions()
+	cmd := &cobra.Command{
+		Use:   "exposure",
+		Short: "Report the resources which are reachable from the internet",
+		Long: `Report the aws, azurerm and google resources which are reachable from the internet, on which ports
+and through which chain of resources.
+
+The analysis follows public IPs, elastic IPs, security groups, network ACLs, network security groups,
+firewall rules, load balancers and their targets. Plans are analyzed in their planned state and the ports
+which the plan newly exposes are reported separately. The format 'karen' writes the node table with the
+exposures attached to the resources. If --fail-on-new is set, the command exits with 2 when the plan
+exposes new ports.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			cmdutil.CheckErr(o.Complete(args))
+			cmdutil.CheckErr(o.Validate())
+			cmdutil.CheckErr(o.Run())
+		},
+	}
+	cmd.Flags().StringVarP(&o.InputType, "type", "t", o.InputType, "One of 'auto', 'plan', 'state', 'tfstate' or 'karen'.")
+	cmd.Flags().StringVarP(&o.inputPath, "input", "i", o.inputPath, "relative path to input file.")
+	cmd.Flags().StringVarP(&o.outputPath, "output", "o", o.outputPath, "relative path to output location. Defaults to stdout.")
+	cmd.Flags().StringVar(&o.url, "url", o.url, "url of the remote repository where the terraform files are located")
+	cmd.Flags().StringVar(&o.filePath, "filePath", o.filePath, "relative path under which the terraform files are located in the remote repository")
+	cmd.Flags().StringVar(&o.format, "format", o.format, "One of 'text', 'json' or 'karen'.")
+	cmd.Flags().BoolVar(&o.failOnNew, "fail-on-new", o.failOnNew, "fail if the plan exposes ports which are not exposed yet.")
+
+	cmd.MarkFlagRequired("input")
+
+	return cmd
+}
+
+// Complete completes all the required options
+func (o *Options) Complete(args []string) error {
+	o.args = args
+	return nil
+}
+
+// Validate validates the provided options
+func (o *Options) Validate() error {
+	if len(o.args) != 0 {
+		return fmt.Errorf("extra arguments: %v", o.args)
+	}
+	if o.InputType != "auto" && o.InputType != "plan" && o.InputType != "state" && o.InputType != "tfstate" && o.InputType != "karen" {
+		return errors.New(`--type must be 'auto', 'plan', 'state', 'tfstate' or 'karen'`)
+	}
+	if o.format != "text" && o.format != "json" && o.format != "karen" {
+		return errors.New(`--format must be 'text', 'json' or 'karen'`)
+	}
+	if o.inputPath == "" {
+		return errors.New("exposure requires inputPath")
+	}
+	return nil
+}
+
+// Run executes exposure command
+func (o *Options) Run() error {
+	document, err := cmdutil.ReadDocument(o.inputPath, o.InputType, o.url, o.filePath)
+	if err != nil {
+		return err
+	}
+	report := preprocessor.AnalyzeExposure(document.Nodes)
+
+	var output []byte
+	switch o.format {
+	case "text":
+		output = []byte(report.Text())
+	case "json":
+		output, err = json.Marshal(report)
+	case "karen":
+		output, err = json.Marshal(document)
+	}
+	if err != nil {
+		return err
+	}
+	err = cmdutil.WriteOutput(o.outputPath, output)
+	if err != nil {
+		return err
+	}
+
+	if o.failOnNew && len(report.NewlyExposed()) > 0 {
+		return &cmdutil.ExitError{Code: ExitCodeNewlyExposed}
+	}
+	return nil
+}
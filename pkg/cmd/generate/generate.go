@@ -0,0 +1,18 @@
+package generate
+
+import (
+	"github.com/spf13/cobra"
+)
+
+// NewCmdGenerate returns a cobra command which groups the commands generating terraform configuration
+func NewCmdGenerate() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "generate",
+		Short: "Generate terraform configuration from a node table",
+		Run: func(cmd *cobra.Command, args []string) {
+			cmd.Help()
+		},
+	}
+	cmd.AddCommand(NewCmdImports())
+	return cmd
+}
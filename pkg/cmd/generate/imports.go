@@ -0,0 +1,128 @@
+package generate
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	cmdutil "github.com/bfrn/karen-preprocessor/pkg/cmd/util"
+	"github.com/bfrn/karen-preprocessor/pkg/preprocessor"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+// ImportsOptions is a struct to support imports command
+type ImportsOptions struct {
+	InputType string
+
+	inputPath     string
+	outputPath    string
+	format        string
+	matches       []string
+	importIDsPath string
+	skeleton      bool
+
+	args []string
+}
+
+// NewImportsOptions returns initialized ImportsOptions
+func NewImportsOptions() *ImportsOptions {
+	return &ImportsOptions{
+		InputType: "auto",
+		format:    "hcl",
+		skeleton:  true,
+	}
+}
+
+// NewCmdImports returns a cobra command for generating import blocks
+func NewCmdImports() *cobra.Command {
+	o := NewImportsOptions()
+	cmd := &cobra.Command{
+		Use:   "imports",
+		Short: "Generate import blocks for the resources of a state",
+		Long: `Generate terraform import blocks and matching resource blocks for the resources of a state, e.g. to
+migrate them into another stack.
+
+The import ID of a resource is derived from its state by the first matching rule of the built-in import ID
+rules and the rules of --import-ids, and defaults to its id attribute. Resources are selected by address
+patterns like module.network.* in which * matches any characters.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			cmdutil.CheckErr(o.Complete(args))
+			cmdutil.CheckErr(o.Validate())
+			cmdutil.CheckErr(o.Run())
+		},
+	}
+	cmd.Flags().StringVarP(&o.InputType, "type", "t", o.InputType, "One of 'auto', 'plan', 'state', 'tfstate' or 'karen'. Plans are imported from their prior state.")
+	cmd.Flags().StringVarP(&o.inputPath, "input", "i", o.inputPath, "relative path to input file.")
+	cmd.Flags().StringVarP(&o.outputPath, "output", "o", o.outputPath, "relative path to output location. Defaults to stdout.")
+	cmd.Flags().StringVar(&o.format, "format", o.format, "One of 'hcl' or 'json'.")
+	cmd.Flags().StringArrayVarP(&o.matches, "match", "m", o.matches, "only import the resources whose address matches the pattern, like module.network.*. Can be repeated.")
+	cmd.Flags().StringVar(&o.importIDsPath, "import-ids", o.importIDsPath, "relative path to an import ID file whose rules take precedence over the built-in rules")
+	cmd.Flags().BoolVar(&o.skeleton, "skeleton", o.skeleton, "add an empty resource block for every imported resource")
+
+	cmd.MarkFlagRequired("input")
+
+	return cmd
+}
+
+// Complete completes all the required options
+func (o *ImportsOptions) Complete(args []string) error {
+	o.args = args
+	return nil
+}
+
+// Validate validates the provided options
+func (o *ImportsOptions) Validate() error {
+	if len(o.args) != 0 {
+		return fmt.Errorf("extra arguments: %v", o.args)
+	}
+	if o.InputType != "auto" && o.InputType != "plan" && o.InputType != "state" && o.InputType != "tfstate" && o.InputType != "karen" {
+		return errors.New(`--type must be 'auto', 'plan', 'state', 'tfstate' or 'karen'`)
+	}
+	if o.format != "hcl" && o.format != "json" {
+		return errors.New(`--format must be 'hcl' or 'json'`)
+	}
+	if o.inputPath == "" {
+		return errors.New("imports requires inputPath")
+	}
+	return nil
+}
+
+// Run executes imports command
+func (o *ImportsOptions) Run() error {
+	nodeTable, err := cmdutil.ReadNodeTable(o.inputPath, o.InputType, "", "")
+	if err != nil {
+		return err
+	}
+
+	registry := preprocessor.NewImportIDRegistry()
+	if o.importIDsPath != "" {
+		log.Debug().Msgf("read import ID file %s", o.importIDsPath)
+		data, err := os.ReadFile(o.importIDsPath)
+		if err != nil {
+			return err
+		}
+		rules, err := preprocessor.ParseImportIDRules(data)
+		if err != nil {
+			return err
+		}
+		registry.Extend(rules)
+	}
+	report := preprocessor.GenerateImports(nodeTable, registry, o.matches)
+	for _, address := range report.Unresolved {
+		log.Warn().Msgf("couldn't derive the import ID of %s", address)
+	}
+
+	var output []byte
+	switch o.format {
+	case "hcl":
+		output = []byte(report.HCL(o.skeleton))
+	case "json":
+		output, err = json.Marshal(report)
+		if err != nil {
+			return err
+		}
+	}
+	return cmdutil.WriteOutput(o.outputPath, output)
+}
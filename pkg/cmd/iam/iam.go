@@ -0,0 +1,132 @@
+package iam
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	cmdutil "github.com/bfrn/karen-preprocessor/pkg/cmd/util"
+	"github.com/bfrn/karen-preprocessor/pkg/preprocessor"
+	"github.com/spf13/cobra"
+)
+
+// Options is a struct to support iam command
+type Options struct {
+	InputType string
+
+	inputPath  string
+	outputPath string
+	url        string
+	filePath   string
+	format     string
+	principal  string
+
+	args []string
+}
+
+// NewOptions returns initialized Options
+func NewOptions() *Options {
+	return &Options{
+		InputType: "auto",
+		format:    "text",
+	}
+}
+
+// NewCmdIAM returns a cobra command for extracting the permissions granted by IAM policies
+func NewCmdIAM() *cobra.Command {
+	o := NewOptions()
+	cmd := &cobra.Command{
+		Use:   "iam",
+		Short: "Report which resources the IAM roles, users and groups may act on",
+		Long: `Report which actions the IAM roles, users and groups may perform on which resources.
+
+The permissions are derived from the inline and managed policies of the principals, including the
+aws_iam_policy_document data sources the policies are built from, so plans can be inspected before
+they are applied. With --principal only the permissions of one principal are reported. The principal may
+also be a lambda function, ECS task definition or EC2 instance, in which case the permissions of the roles
+it assumes are reported. The format 'karen' writes the node table with the permissions added as edges.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			cmdutil.CheckErr(o.Complete(args))
+			cmdutil.CheckErr(o.Validate())
+			cmdutil.CheckErr(o.Run())
+		},
+	}
+	cmd.Flags().StringVarP(&o.InputType, "type", "t", o.InputType, "One of 'auto', 'plan', 'state', 'tfstate' or 'karen'.")
+	cmd.Flags().StringVarP(&o.inputPath, "input", "i", o.inputPath, "relative path to input file.")
+	cmd.Flags().StringVarP(&o.outputPath, "output", "o", o.outputPath, "relative path to output location. Defaults to stdout.")
+	cmd.Flags().StringVar(&o.url, "url", o.url, "url of the remote repository where the terraform files are located")
+	cmd.Flags().StringVar(&o.filePath, "filePath", o.filePath, "relative path under which the terraform files are located in the remote repository")
+	cmd.Flags().StringVar(&o.format, "format", o.format, "One of 'text', 'json' or 'karen'.")
+	cmd.Flags().StringVarP(&o.principal, "principal", "p", o.principal, "terraform address of the principal whose permissions are reported, e.g. aws_lambda_function.api")
+
+	cmd.MarkFlagRequired("input")
+
+	return cmd
+}
+
+// Complete completes all the required options
+func (o *Options) Complete(args []string) error {
+	o.args = args
+	return nil
+}
+
+// Validate validates the provided options
+func (o *Options) Validate() error {
+	if len(o.args) != 0 {
+		return fmt.Errorf("extra arguments: %v", o.args)
+	}
+	if o.InputType != "auto" && o.InputType != "plan" && o.InputType != "state" && o.InputType != "tfstate" && o.InputType != "karen" {
+		return errors.New(`--type must be 'auto', 'plan', 'state', 'tfstate' or 'karen'`)
+	}
+	if o.format != "text" && o.format != "json" && o.format != "karen" {
+		return errors.New(`--format must be 'text', 'json' or 'karen'`)
+	}
+	if o.inputPath == "" {
+		return errors.New("iam requires inputPath")
+	}
+	return nil
+}
+
+// Run executes iam command
+func (o *Options) Run() error {
+	document, err := cmdutil.ReadDocument(o.inputPath, o.InputType, o.url, o.filePath)
+	if err != nil {
+		return err
+	}
+	report := preprocessor.ExtractIAMPermissions(document.Nodes)
+
+	if o.principal != "" {
+		address, ok := principalAddress(document.Nodes, o.principal)
+		if !ok {
+			return fmt.Errorf("the node table contains no resource with the address '%s'", o.principal)
+		}
+		report = report.ForPrincipal(address)
+	}
+
+	var output []byte
+	switch o.format {
+	case "text":
+		output = []byte(report.Text())
+	case "json":
+		output, err = json.Marshal(report)
+	case "karen":
+		output, err = json.Marshal(document)
+	}
+	if err != nil {
+		return err
+	}
+	return cmdutil.WriteOutput(o.outputPath, output)
+}
+
+// principalAddress returns the node address of the resource with the given node or terraform address.
+func principalAddress(nodeTable map[string]preprocessor.Node, address string) (string, bool) {
+	if _, ok := nodeTable[address]; ok {
+		return address, true
+	}
+	for nodeAddress := range nodeTable {
+		if preprocessor.TerraformAddress(nodeAddress) == address {
+			return nodeAddress, true
+		}
+	}
+	return "", false
+}
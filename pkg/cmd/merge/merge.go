@@ -0,0 +1,198 @@
+package merge
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	cmdutil "github.com/bfrn/karen-preprocessor/pkg/cmd/util"
+	"github.com/bfrn/karen-preprocessor/pkg/preprocessor"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+// Options is a struct to support merge command
+type Options struct {
+	InputType string
+
+	outputPath  string
+	url         string
+	filePath    string
+	bare        bool
+	networkView bool
+	inferEdges  bool
+	iam         bool
+	backends    []string
+
+	groupByTag   string
+	ownership    bool
+	requiredTags []string
+	defaultTags  []string
+
+	inputs        []mergeInput
+	stackBackends map[string]*preprocessor.StateBackend
+	args          []string
+}
+
+// mergeInput is an input file and the name of the stack it is merged as
+type mergeInput struct {
+	name string
+	path string
+}
+
+// NewOptions returns initialized Options
+func NewOptions() *Options {
+	return &Options{
+		InputType: "auto",
+	}
+}
+
+// NewCmdMerge returns a cobra command for merging several inputs into one node table
+func NewCmdMerge() *cobra.Command {
+	o := NewOptions()
+	cmd := &cobra.Command{
+		Use:   "merge [NAME=]INPUT...",
+		Short: "Merge several state, plan or karen files into one node table",
+		Long: `Merge the node tables of several root modules or workspaces into one node table.
+Every input becomes a stack node with the address _stack.NAME and the addresses of its nodes are
+prefixed accordingly, e.g. _stack.prod._root.aws_vpc.main. If no name is given, the file name without
+extension is used. Inputs which were merged before keep their stacks.
+
+terraform_remote_state data sources are linked to the outputs of the stack whose state they read.
+The backend of a stack is given with --backend NAME=TYPE:KEY=VALUE,..., e.g.
+
+  --backend network=s3:bucket=states,key=network.tfstate,workspace=prod
+
+Raw terraform.tfstate inputs default to the local backend with the path of the input.
+
+The locations of plan files are derived from --url and --filePath, which apply to all inputs.
+To keep different locations per stack, parse the plan files first and merge the karen documents.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			cmdutil.CheckErr(o.Complete(args))
+			cmdutil.CheckErr(o.Validate())
+			cmdutil.CheckErr(o.Run())
+		},
+	}
+	cmd.Flags().StringVarP(&o.InputType, "type", "t", o.InputType, "One of 'auto', 'plan', 'state', 'tfstate' or 'karen'. Applies to all inputs.")
+	cmd.Flags().StringVarP(&o.outputPath, "output", "o", o.outputPath, "relative path to output location. Defaults to stdout.")
+	cmd.Flags().StringVar(&o.url, "url", o.url, "url of the remote repository where the terraform files are located")
+	cmd.Flags().StringVar(&o.filePath, "filePath", o.filePath, "relative path under which the terraform files are located in the remote repository")
+	cmd.Flags().StringVar(&o.groupByTag, "group-by-tag", o.groupByTag, "add groups which arrange the resources by the value of a tag or label like team, tags.team or labels.env")
+	cmd.Flags().BoolVar(&o.ownership, "ownership", o.ownership, "add the owner and environment of every resource, resolved from the owner, team, environment and env tags, as attributes")
+	cmd.Flags().StringSliceVar(&o.requiredTags, "required-tags", o.requiredTags, "flag taggable resources which miss one of these tags with the attribute missingTags")
+	cmd.Flags().StringArrayVar(&o.defaultTags, "default-tags", o.defaultTags, "default tags of a module which its resources inherit, like module.network:team=net,env=prod or team=net for the root module. Can be repeated.")
+	cmd.Flags().BoolVar(&o.bare, "bare", o.bare, "write the bare node table without the versioned envelope, as before karen version 1.0")
+	cmd.Flags().BoolVar(&o.networkView, "network-view", o.networkView, "add groups which arrange aws, azurerm and google resources by account, region, network and subnet")
+	cmd.Flags().BoolVar(&o.inferEdges, "infer-edges", o.inferEdges, "add inferred edges between resources whose attributes contain the id, arn or self_link of another resource, also across stacks")
+	cmd.Flags().BoolVar(&o.iam, "iam", o.iam, "add edges from IAM roles, users and groups to the resources their policies allow actions on, also across stacks")
+	cmd.Flags().StringArrayVar(&o.backends, "backend", o.backends, "backend of a stack as NAME=TYPE:KEY=VALUE,... used to resolve terraform_remote_state data sources. Can be repeated.")
+
+	return cmd
+}
+
+// Complete completes all the required options
+func (o *Options) Complete(args []string) error {
+	o.args = args
+	o.inputs = nil
+	for _, arg := range args {
+		name, path, found := strings.Cut(arg, "=")
+		if !found {
+			path = arg
+			name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		}
+		o.inputs = append(o.inputs, mergeInput{name: name, path: path})
+	}
+
+	o.stackBackends = make(map[string]*preprocessor.StateBackend)
+	for _, backend := range o.backends {
+		name, description, found := strings.Cut(backend, "=")
+		if !found || name == "" {
+			return fmt.Errorf("--backend must have the form NAME=TYPE:KEY=VALUE,... but got '%s'", backend)
+		}
+		stateBackend, err := preprocessor.ParseStateBackend(description)
+		if err != nil {
+			return err
+		}
+		o.stackBackends[name] = stateBackend
+	}
+	return nil
+}
+
+// Validate validates the provided options
+func (o *Options) Validate() error {
+	if len(o.inputs) == 0 {
+		return errors.New("merge requires at least one input")
+	}
+	if o.InputType != "auto" && o.InputType != "plan" && o.InputType != "state" && o.InputType != "tfstate" && o.InputType != "karen" {
+		return errors.New(`--type must be 'auto', 'state', 'tfstate', 'plan' or 'karen'`)
+	}
+	names := make(map[string]bool)
+	for _, input := range o.inputs {
+		if input.path == "" {
+			return fmt.Errorf("the input of stack '%s' has no path", input.name)
+		}
+		names[input.name] = true
+	}
+	for name := range o.stackBackends {
+		if !names[name] {
+			return fmt.Errorf("--backend refers to the unknown stack '%s'", name)
+		}
+	}
+	return nil
+}
+
+// Run executes merge command
+func (o *Options) Run() error {
+	stacks := make([]preprocessor.StackInput, 0, len(o.inputs))
+	for _, input := range o.inputs {
+		document, err := cmdutil.ReadStackDocument(input.path, o.InputType, o.url, o.filePath)
+		if err != nil {
+			return fmt.Errorf("couldn't read the input of stack '%s': %s", input.name, err.Error())
+		}
+		backend := o.stackBackends[input.name]
+		if backend == nil && document.Metadata.InputKind == preprocessor.Input_kind_tfstate {
+			backend = &preprocessor.StateBackend{Type: "local", Config: map[string]string{"path": input.path}}
+		}
+		stacks = append(stacks, preprocessor.StackInput{Name: input.name, Document: document, Backend: backend})
+	}
+
+	log.Debug().Msgf("merge %d inputs", len(stacks))
+	document, err := preprocessor.MergeDocuments(stacks)
+	if err != nil {
+		return err
+	}
+
+	for _, link := range preprocessor.LinkRemoteStates(document.Nodes) {
+		if link.Producer == "" {
+			log.Warn().Msgf("%s reads the state of a %s backend which matches none of the stacks", link.Address, link.Backend)
+			continue
+		}
+		log.Debug().Msgf("%s reads the state of stack %s", link.Address, link.Producer)
+	}
+	if o.networkView {
+		document.Nodes, err = preprocessor.AddNetworkView(document.Nodes)
+		if err != nil {
+			return err
+		}
+	}
+
+	if o.inferEdges {
+		log.Debug().Msgf("inferred %d edges", preprocessor.InferEdges(document.Nodes))
+	}
+
+	if o.iam {
+		log.Debug().Msgf("extracted %d permissions", len(preprocessor.ExtractIAMPermissions(document.Nodes).Permissions))
+	}
+
+	err = cmdutil.ResolveTags(document.Nodes, o.groupByTag, o.ownership, o.requiredTags, o.defaultTags)
+	if err != nil {
+		return err
+	}
+
+	output, err := cmdutil.MarshalDocument(document, o.bare)
+	if err != nil {
+		return err
+	}
+	return cmdutil.WriteOutput(o.outputPath, output)
+}
@@ -0,0 +1,123 @@
+package moved
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	cmdutil "github.com/bfrn/karen-preprocessor/pkg/cmd/util"
+	"github.com/bfrn/karen-preprocessor/pkg/preprocessor"
+	"github.com/spf13/cobra"
+)
+
+// Options is a struct to support moved command
+type Options struct {
+	InputType string
+
+	inputPath     string
+	outputPath    string
+	url           string
+	filePath      string
+	format        string
+	minSimilarity float64
+
+	args []string
+}
+
+// NewOptions returns initialized Options
+func NewOptions() *Options {
+	return &Options{
+		InputType:     "auto",
+		format:        "hcl",
+		minSimilarity: preprocessor.DefaultMoveSimilarity,
+	}
+}
+
+// NewCmdMoved returns a cobra command for suggesting moved blocks
+func NewCmdMoved() *cobra.Command {
+	o := NewOptions()
+	cmd := &cobra.Command{
+		Use:   "moved",
+		Short: "Suggest moved blocks for resources which a plan deletes and creates under another address",
+		Long: `Suggest moved blocks for resources which a plan deletes under one address and creates under another.
+
+A deleted resource is paired with a created resource of the same type if the known attributes of its planned
+state match the current state of the deleted resource with at least the given similarity. The format 'hcl'
+writes moved blocks which can be pasted into the root module, 'text' and 'json' additionally list the
+attributes which differ.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			cmdutil.CheckErr(o.Complete(args))
+			cmdutil.CheckErr(o.Validate())
+			cmdutil.CheckErr(o.Run())
+		},
+	}
+	cmd.Flags().StringVarP(&o.InputType, "type", "t", o.InputType, "One of 'auto', 'plan' or 'karen'.")
+	cmd.Flags().StringVarP(&o.inputPath, "input", "i", o.inputPath, "relative path to input file.")
+	cmd.Flags().StringVarP(&o.outputPath, "output", "o", o.outputPath, "relative path to output location. Defaults to stdout.")
+	cmd.Flags().StringVar(&o.url, "url", o.url, "url of the remote repository where the terraform files are located")
+	cmd.Flags().StringVar(&o.filePath, "filePath", o.filePath, "relative path under which the terraform files are located in the remote repository")
+	cmd.Flags().StringVar(&o.format, "format", o.format, "One of 'hcl', 'text' or 'json'.")
+	cmd.Flags().Float64Var(&o.minSimilarity, "similarity", o.minSimilarity, "minimal share of equal attributes, between 0 and 1, for a deleted and a created resource to be paired")
+
+	cmd.MarkFlagRequired("input")
+
+	return cmd
+}
+
+// Complete completes all the required options
+func (o *Options) Complete(args []string) error {
+	o.args = args
+	return nil
+}
+
+// Validate validates the provided options
+func (o *Options) Validate() error {
+	if len(o.args) != 0 {
+		return fmt.Errorf("extra arguments: %v", o.args)
+	}
+	if o.InputType != "auto" && o.InputType != "plan" && o.InputType != "karen" {
+		return errors.New(`--type must be 'auto', 'plan' or 'karen'`)
+	}
+	if o.format != "hcl" && o.format != "text" && o.format != "json" {
+		return errors.New(`--format must be 'hcl', 'text' or 'json'`)
+	}
+	if o.minSimilarity <= 0 || o.minSimilarity > 1 {
+		return errors.New("--similarity must be greater than 0 and at most 1")
+	}
+	if o.inputPath == "" {
+		return errors.New("moved requires inputPath")
+	}
+
+	var err error
+	o.InputType, err = cmdutil.ResolveInputType(o.inputPath, o.InputType)
+	if err != nil {
+		return err
+	}
+	if o.InputType != "plan" && o.InputType != "karen" {
+		return fmt.Errorf("moved requires a plan or karen file, the input is a %s file", o.InputType)
+	}
+	return nil
+}
+
+// Run executes moved command
+func (o *Options) Run() error {
+	nodeTable, err := cmdutil.ReadNodeTable(o.inputPath, o.InputType, o.url, o.filePath)
+	if err != nil {
+		return err
+	}
+	report := preprocessor.SuggestMoves(nodeTable, o.minSimilarity)
+
+	var output []byte
+	switch o.format {
+	case "hcl":
+		output = []byte(report.HCL())
+	case "text":
+		output = []byte(report.Text())
+	case "json":
+		output, err = json.Marshal(report)
+		if err != nil {
+			return err
+		}
+	}
+	return cmdutil.WriteOutput(o.outputPath, output)
+}
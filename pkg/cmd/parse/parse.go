@@ -1,7 +1,6 @@
 package parse
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
@@ -16,17 +15,40 @@ import (
 type Options struct {
 	InputType string
 
-	inputPath  string
-	outputPath string
-	url        string
-	filePath   string
+	inputPath    string
+	outputPath   string
+	url          string
+	filePath     string
+	schemasPath  string
+	filter       string
+	depth        int
+	bare         bool
+	networkView  bool
+	inferEdges   bool
+	iam          bool
+	classify     bool
+	consoleLinks bool
 
-	args []string
+	classificationPath string
+	codeOwnersPath     string
+	consoleLinksPath   string
+	overlayPath        string
+	priceSheetPath     string
+
+	groupByTag   string
+	ownership    bool
+	requiredTags []string
+	defaultTags  []string
+
+	query *preprocessor.Query
+	args  []string
 }
 
 // NewOptions returns initialized Options
 func NewOptions() *Options {
-	return &Options{}
+	return &Options{
+		InputType: "auto",
+	}
 }
 
 // NewCmdParse returns a cobra command for parsing terraform files
@@ -41,13 +63,37 @@ func NewCmdParse() *cobra.Command {
 			cmdutil.CheckErr(o.Run())
 		},
 	}
-	cmd.Flags().StringVarP(&o.InputType, "type", "t", o.InputType, "One of 'plan' or 'state'.")
+	cmd.Flags().StringVarP(&o.InputType, "type", "t", o.InputType, "One of 'auto', 'plan', 'state', 'tfstate' or 'karen'. 'tfstate' is a raw terraform.tfstate file, 'auto' detects the type from the content.")
 	cmd.Flags().StringVarP(&o.inputPath, "input", "i", o.inputPath, "relative path to input file.")
 	cmd.Flags().StringVarP(&o.outputPath, "output", "o", o.outputPath, "relative path to output location.")
 	cmd.Flags().StringVar(&o.url, "url", o.url, "url of the remote repository where the terraform files are located")
 	cmd.Flags().StringVar(&o.filePath, "filePath", o.filePath, "relative path under which the terraform files are located in the remote repository")
 
-	cmd.MarkFlagRequired("type")
+	cmd.Flags().StringVar(&o.schemasPath, "schemas", o.schemasPath, "relative path to the output of 'terraform providers schema -json' used to annotate resources with their attribute schemas")
+
+	cmd.Flags().BoolVar(&o.classify, "classify", o.classify, "add the provider, service, category and icon of every resource as attributes")
+	cmd.Flags().StringVar(&o.classificationPath, "classification", o.classificationPath, "relative path to a classification file whose rules take precedence over the built-in rules. Implies --classify.")
+
+	cmd.Flags().BoolVar(&o.consoleLinks, "console-links", o.consoleLinks, "add a link to the cloud console or kubernetes dashboard page of every resource as attribute consoleUrl")
+	cmd.Flags().StringVar(&o.consoleLinksPath, "console-link-rules", o.consoleLinksPath, "relative path to a console link file whose rules and variables take precedence over the built-in ones. Implies --console-links.")
+
+	cmd.Flags().StringVar(&o.codeOwnersPath, "codeowners", o.codeOwnersPath, "relative path to a GitHub or GitLab CODEOWNERS file whose owners are attached to the modules and resources. The url is removed from the locations to get the paths within the repository.")
+
+	cmd.Flags().StringVar(&o.priceSheetPath, "price-sheet", o.priceSheetPath, "relative path to a json price sheet used to add the estimated current and planned monthly cost of the resources and modules as attribute monthlyCost")
+
+	cmd.Flags().StringVar(&o.overlayPath, "overlay", o.overlayPath, "relative path to a json file of address patterns and attributes like runbook links or criticality which are added to the matching nodes")
+
+	cmd.Flags().StringVar(&o.filter, "filter", o.filter, "only keep the nodes matching the filter expression and their ancestors. See 'query --help' for the syntax.")
+	cmd.Flags().IntVar(&o.depth, "depth", o.depth, "keep nodes which are up to depth dependency hops away from a node matching the filter")
+
+	cmd.Flags().BoolVar(&o.networkView, "network-view", o.networkView, "add groups which arrange aws, azurerm and google resources by account, region, network and subnet")
+	cmd.Flags().BoolVar(&o.inferEdges, "infer-edges", o.inferEdges, "add inferred edges between resources whose attributes contain the id, arn or self_link of another resource")
+	cmd.Flags().BoolVar(&o.iam, "iam", o.iam, "add edges from IAM roles, users and groups to the resources their policies allow actions on")
+	cmd.Flags().StringVar(&o.groupByTag, "group-by-tag", o.groupByTag, "add groups which arrange the resources by the value of a tag or label like team, tags.team or labels.env")
+	cmd.Flags().BoolVar(&o.ownership, "ownership", o.ownership, "add the owner and environment of every resource, resolved from the owner, team, environment and env tags, as attributes")
+	cmd.Flags().StringSliceVar(&o.requiredTags, "required-tags", o.requiredTags, "flag taggable resources which miss one of these tags with the attribute missingTags")
+	cmd.Flags().StringArrayVar(&o.defaultTags, "default-tags", o.defaultTags, "default tags of a module which its resources inherit, like module.network:team=net,env=prod or team=net for the root module. Can be repeated.")
+	cmd.Flags().BoolVar(&o.bare, "bare", o.bare, "write the bare node table without the versioned envelope, as before karen version 1.0")
 
 	return cmd
 }
@@ -64,51 +110,159 @@ func (o *Options) Validate() error {
 		return errors.New(fmt.Sprintf("extra arguments: %v", o.args))
 	}
 
-	if o.InputType == "" || o.InputType != "plan" && o.InputType != "state" {
-		return errors.New(`--type must be 'state' or 'plan'`)
+	if o.InputType != "auto" && o.InputType != "plan" && o.InputType != "state" && o.InputType != "tfstate" && o.InputType != "karen" {
+		return errors.New(`--type must be 'auto', 'state', 'tfstate', 'plan' or 'karen'`)
+	}
+	err := o.validatePaths()
+	if err != nil {
+		return err
 	}
 
+	if o.depth < 0 {
+		return errors.New("--depth must not be negative")
+	}
+	if o.filter != "" {
+		o.query, err = preprocessor.ParseQuery(o.filter)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validatePaths checks that the paths required by the input type are given
+func (o *Options) validatePaths() error {
 	switch o.InputType {
 	case "plan":
 		if o.inputPath == "" || o.outputPath == "" || o.url == "" || o.filePath == "" {
 			return errors.New("type 'plan' requires inputPath, outputPath, url and filePath")
 		}
-	case "state":
+	default:
 		if o.inputPath == "" || o.outputPath == "" {
-			return errors.New("type 'state' requires inputPath and outputPath")
+			return fmt.Errorf("type '%s' requires inputPath and outputPath", o.InputType)
 		}
 	}
-
 	return nil
 }
 
 // Run executes parse command
 func (o *Options) Run() error {
+	if o.InputType == "auto" {
+		inputType, err := cmdutil.DetectInputType(o.inputPath)
+		if err != nil {
+			return err
+		}
+		log.Debug().Msgf("detected type %s", inputType)
+		o.InputType = inputType
+		err = o.validatePaths()
+		if err != nil {
+			return err
+		}
+	}
+
+	document, err := cmdutil.ReadDocument(o.inputPath, o.InputType, o.url, o.filePath)
+	if err != nil {
+		return err
+	}
+
+	if o.schemasPath != "" {
+		log.Debug().Msgf("read provider schemas %s", o.schemasPath)
+		providerSchemas, err := os.ReadFile(o.schemasPath)
+		if err != nil {
+			return err
+		}
+		err = preprocessor.EnrichWithProviderSchemas(document, providerSchemas)
+		if err != nil {
+			return err
+		}
+	}
+
+	if o.classify || o.classificationPath != "" {
+		registry := preprocessor.NewClassificationRegistry()
+		if o.classificationPath != "" {
+			log.Debug().Msgf("read classification file %s", o.classificationPath)
+			data, err := os.ReadFile(o.classificationPath)
+			if err != nil {
+				return err
+			}
+			rules, err := preprocessor.ParseClassificationRules(data)
+			if err != nil {
+				return err
+			}
+			registry.Extend(rules)
+		}
+		document.Nodes = preprocessor.ClassifyResources(document.Nodes, registry)
+	}
+
+	if o.consoleLinks || o.consoleLinksPath != "" {
+		registry := preprocessor.NewConsoleLinkRegistry()
+		if o.consoleLinksPath != "" {
+			log.Debug().Msgf("read console link file %s", o.consoleLinksPath)
+			data, err := os.ReadFile(o.consoleLinksPath)
+			if err != nil {
+				return err
+			}
+			rules, err := preprocessor.ParseConsoleLinkRules(data)
+			if err != nil {
+				return err
+			}
+			registry.Extend(rules)
+		}
+		log.Debug().Msgf("added console links to %d resources", preprocessor.AddConsoleLinks(document.Nodes, registry))
+	}
+
+	if o.networkView {
+		document.Nodes, err = preprocessor.AddNetworkView(document.Nodes)
+		if err != nil {
+			return err
+		}
+	}
 
-	log.Debug().Msgf("read file %s", o.inputPath)
-	data, err := os.ReadFile(o.inputPath)
+	if o.inferEdges {
+		log.Debug().Msgf("inferred %d edges", preprocessor.InferEdges(document.Nodes))
+	}
+
+	if o.iam {
+		log.Debug().Msgf("extracted %d permissions", len(preprocessor.ExtractIAMPermissions(document.Nodes).Permissions))
+	}
+
+	if o.codeOwnersPath != "" {
+		err = cmdutil.AddCodeOwners(document.Nodes, o.codeOwnersPath, o.url)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = cmdutil.ResolveTags(document.Nodes, o.groupByTag, o.ownership, o.requiredTags, o.defaultTags)
 	if err != nil {
 		return err
 	}
 
-	var parsedModel map[string]preprocessor.Node
+	if o.priceSheetPath != "" {
+		report, err := cmdutil.EstimateCosts(document.Nodes, o.priceSheetPath)
+		if err != nil {
+			return err
+		}
+		log.Debug().Msgf("estimated monthly cost %.2f, planned %.2f", report.Current, report.Planned)
+	}
 
-	switch o.InputType {
-	case "plan":
-		log.Debug().Msgf("parse plan file url=%s filepath=%s", o.url, o.filePath)
-		parsedModel, err = preprocessor.ParsePlanFile(data, o.url, o.filePath)
+	if o.overlayPath != "" {
+		err = cmdutil.ApplyOverlay(document, o.overlayPath)
 		if err != nil {
 			return err
 		}
+	}
 
-	case "state":
-		log.Debug().Msgf("parse state file")
-		parsedModel, err = preprocessor.ParseStateFile(data)
+	if o.query != nil {
+		log.Debug().Msgf("filter node table with '%s'", o.query)
+		document.Nodes, err = preprocessor.FilterNodeTable(document.Nodes, o.query, o.depth)
 		if err != nil {
 			return err
 		}
 	}
-	output, err := json.Marshal(parsedModel)
+
+	output, err := cmdutil.MarshalDocument(document, o.bare)
 	if err != nil {
 		return err
 	}
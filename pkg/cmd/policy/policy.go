@@ -0,0 +1,173 @@
+package policy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	cmdutil "github.com/bfrn/karen-preprocessor/pkg/cmd/util"
+	"github.com/bfrn/karen-preprocessor/pkg/preprocessor"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+// ExitCodeViolations is the exit code of the policy command if a finding reaches the --fail-on severity.
+const ExitCodeViolations = 2
+
+// Options is a struct to support policy command
+type Options struct {
+	InputType string
+
+	inputPath  string
+	outputPath string
+	rulesPath  string
+	url        string
+	filePath   string
+	state      string
+	format     string
+	failOn     string
+
+	policySet *preprocessor.PolicySet
+	args      []string
+}
+
+// NewOptions returns initialized Options
+func NewOptions() *Options {
+	return &Options{
+		InputType: "auto",
+		format:    "text",
+	}
+}
+
+// NewCmdPolicy returns a cobra command for evaluating policies
+func NewCmdPolicy() *cobra.Command {
+	o := NewOptions()
+	cmd := &cobra.Command{
+		Use:   "policy",
+		Short: "Evaluate declarative policies against the resources of a node table",
+		Long: `Evaluate the rules of a json policy file against the current or planned state of every resource.
+
+  {
+    "rules": [{
+      "id": "s3-encryption",
+      "description": "every aws_s3_bucket must have server-side encryption",
+      "severity": "high",
+      "resourceTypes": ["aws_s3_bucket"],
+      "assert": {"attribute": "server_side_encryption_configuration", "operator": "not_empty"}
+    }],
+    "exemptions": [{"address": "aws_s3_bucket.public_assets", "rules": ["s3-encryption"], "reason": "public"}]
+  }
+
+Severities are info, low, medium, high and critical. The format 'karen' writes the node table with the
+findings attached to the resources. If --fail-on is set, the command exits with 2 when a finding which
+is not exempted has at least the given severity.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			cmdutil.CheckErr(o.Complete(args))
+			cmdutil.CheckErr(o.Validate())
+			cmdutil.CheckErr(o.Run())
+		},
+	}
+	cmd.Flags().StringVarP(&o.InputType, "type", "t", o.InputType, "One of 'auto', 'plan', 'state', 'tfstate' or 'karen'.")
+	cmd.Flags().StringVarP(&o.inputPath, "input", "i", o.inputPath, "relative path to input file.")
+	cmd.Flags().StringVarP(&o.outputPath, "output", "o", o.outputPath, "relative path to output location. Defaults to stdout.")
+	cmd.Flags().StringVarP(&o.rulesPath, "rules", "r", o.rulesPath, "relative path to the policy file.")
+	cmd.Flags().StringVar(&o.url, "url", o.url, "url of the remote repository where the terraform files are located")
+	cmd.Flags().StringVar(&o.filePath, "filePath", o.filePath, "relative path under which the terraform files are located in the remote repository")
+	cmd.Flags().StringVar(&o.state, "state", o.state, "One of 'current' or 'planned'. The state of the resources the rules are evaluated on. Defaults to 'current' for state files and 'planned' otherwise.")
+	cmd.Flags().StringVar(&o.format, "format", o.format, "One of 'text', 'json' or 'karen'.")
+	cmd.Flags().StringVar(&o.failOn, "fail-on", o.failOn, "fail if a finding has at least this severity.")
+
+	cmd.MarkFlagRequired("input")
+	cmd.MarkFlagRequired("rules")
+
+	return cmd
+}
+
+// Complete completes all the required options
+func (o *Options) Complete(args []string) error {
+	o.args = args
+	return nil
+}
+
+// Validate validates the provided options
+func (o *Options) Validate() error {
+	if len(o.args) != 0 {
+		return fmt.Errorf("extra arguments: %v", o.args)
+	}
+	if o.InputType != "auto" && o.InputType != "plan" && o.InputType != "state" && o.InputType != "tfstate" && o.InputType != "karen" {
+		return errors.New(`--type must be 'auto', 'plan', 'state', 'tfstate' or 'karen'`)
+	}
+	if o.state != "" && o.state != "current" && o.state != "planned" {
+		return errors.New(`--state must be 'current' or 'planned'`)
+	}
+	if o.format != "text" && o.format != "json" && o.format != "karen" {
+		return errors.New(`--format must be 'text', 'json' or 'karen'`)
+	}
+	if o.failOn != "" && !preprocessor.IsValidSeverity(o.failOn) {
+		return errors.New(`--fail-on must be one of 'info', 'low', 'medium', 'high' or 'critical'`)
+	}
+	if o.inputPath == "" || o.rulesPath == "" {
+		return errors.New("policy requires inputPath and rulesPath")
+	}
+
+	var err error
+	o.InputType, err = cmdutil.ResolveInputType(o.inputPath, o.InputType)
+	if err != nil {
+		return err
+	}
+	if o.state == "" {
+		o.state = "planned"
+		if o.InputType == "state" || o.InputType == "tfstate" {
+			o.state = "current"
+		}
+	}
+
+	log.Debug().Msgf("read policy file %s", o.rulesPath)
+	data, err := os.ReadFile(o.rulesPath)
+	if err != nil {
+		return err
+	}
+	o.policySet, err = preprocessor.ParsePolicySet(data)
+	return err
+}
+
+// Run executes policy command
+func (o *Options) Run() error {
+	document, err := cmdutil.ReadDocument(o.inputPath, o.InputType, o.url, o.filePath)
+	if err != nil {
+		return err
+	}
+	nodeTable := document.Nodes
+
+	state := preprocessor.State_planned
+	if o.state == "current" {
+		state = preprocessor.State_current
+	}
+	report, err := preprocessor.EvaluatePolicies(nodeTable, o.policySet, state)
+	if err != nil {
+		return err
+	}
+
+	var output []byte
+	switch o.format {
+	case "text":
+		output = []byte(report.Text())
+	case "json":
+		output, err = json.Marshal(report)
+	case "karen":
+		output, err = json.Marshal(document)
+	}
+	if err != nil {
+		return err
+	}
+	err = cmdutil.WriteOutput(o.outputPath, output)
+	if err != nil {
+		return err
+	}
+
+	if o.failOn != "" && len(report.Violations(o.failOn)) > 0 {
+		return &cmdutil.ExitError{Code: ExitCodeViolations}
+	}
+	return nil
+}
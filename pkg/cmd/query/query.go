@@ -0,0 +1,129 @@
+package query
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	cmdutil "github.com/bfrn/karen-preprocessor/pkg/cmd/util"
+	"github.com/bfrn/karen-preprocessor/pkg/preprocessor"
+	"github.com/spf13/cobra"
+)
+
+// Options is a struct to support query command
+type Options struct {
+	InputType string
+
+	inputPath  string
+	outputPath string
+	format     string
+	filter     string
+	depth      int
+
+	query *preprocessor.Query
+	args  []string
+}
+
+// NewOptions returns initialized Options
+func NewOptions() *Options {
+	return &Options{
+		InputType: "auto",
+		format:    "addresses",
+	}
+}
+
+// NewCmdQuery returns a cobra command for querying node tables
+func NewCmdQuery() *cobra.Command {
+	o := NewOptions()
+	cmd := &cobra.Command{
+		Use:   "query FILTER",
+		Short: "Select nodes of a node table with a filter expression",
+		Long: `Select nodes of a node table with a filter expression like
+
+  module.network.* and (type == aws_subnet or tags.env == "prod") and not action == NoOp
+
+Bare terms are address globs. Predicates compare one of address, type, name, module, mode,
+provider, node, action, stack or status or a dotted attribute path with ==, !=, ~= (glob), <, <=, >
+or >=.
+Terms are combined with and, or, not and parentheses.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			cmdutil.CheckErr(o.Complete(args))
+			cmdutil.CheckErr(o.Validate())
+			cmdutil.CheckErr(o.Run())
+		},
+	}
+	cmd.Flags().StringVarP(&o.InputType, "type", "t", o.InputType, "One of 'auto', 'plan', 'state', 'tfstate' or 'karen'.")
+	cmd.Flags().StringVarP(&o.inputPath, "input", "i", o.inputPath, "relative path to input file.")
+	cmd.Flags().StringVarP(&o.outputPath, "output", "o", o.outputPath, "relative path to output location. Defaults to stdout.")
+	cmd.Flags().StringVar(&o.format, "format", o.format, "One of 'addresses' or 'table'.")
+	cmd.Flags().IntVar(&o.depth, "depth", o.depth, "include nodes which are up to depth dependency hops away from a match")
+
+	cmd.MarkFlagRequired("input")
+
+	return cmd
+}
+
+// Complete completes all the required options
+func (o *Options) Complete(args []string) error {
+	o.args = args
+	if len(args) > 0 {
+		o.filter = args[0]
+	}
+	return nil
+}
+
+// Validate validates the provided options
+func (o *Options) Validate() error {
+	if len(o.args) != 1 {
+		return errors.New("query requires exactly one filter expression")
+	}
+	if o.InputType != "auto" && o.InputType != "plan" && o.InputType != "state" && o.InputType != "tfstate" && o.InputType != "karen" {
+		return errors.New(`--type must be 'auto', 'plan', 'state', 'tfstate' or 'karen'`)
+	}
+	if o.format != "addresses" && o.format != "table" {
+		return errors.New(`--format must be 'addresses' or 'table'`)
+	}
+	if o.depth < 0 {
+		return errors.New("--depth must not be negative")
+	}
+	if o.inputPath == "" {
+		return errors.New("query requires inputPath")
+	}
+
+	var err error
+	o.query, err = preprocessor.ParseQuery(o.filter)
+	return err
+}
+
+// Run executes query command
+func (o *Options) Run() error {
+	document, err := cmdutil.ReadDocument(o.inputPath, o.InputType, "", "")
+	if err != nil {
+		return err
+	}
+	nodeTable := document.Nodes
+
+	var output []byte
+	switch o.format {
+	case "addresses":
+		addresses := preprocessor.QueryNodeTable(nodeTable, o.query, o.depth)
+		if len(addresses) > 0 {
+			output = []byte(strings.Join(addresses, "\n") + "\n")
+		}
+	case "table":
+		filteredNodeTable, err := preprocessor.FilterNodeTable(nodeTable, o.query, o.depth)
+		if err != nil {
+			return err
+		}
+		document.Nodes = filteredNodeTable
+		output, err = json.Marshal(document)
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown format '%s'", o.format)
+	}
+
+	return cmdutil.WriteOutput(o.outputPath, output)
+}
@@ -0,0 +1,133 @@
+package summary
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	cmdutil "github.com/bfrn/karen-preprocessor/pkg/cmd/util"
+	"github.com/bfrn/karen-preprocessor/pkg/preprocessor"
+	"github.com/spf13/cobra"
+)
+
+// Options is a struct to support summary command
+type Options struct {
+	InputType string
+
+	inputPath  string
+	outputPath string
+	format     string
+	url        string
+	filePath   string
+
+	codeOwnersPath string
+	priceSheetPath string
+
+	args []string
+}
+
+// NewOptions returns initialized Options
+func NewOptions() *Options {
+	return &Options{
+		InputType: "auto",
+		format:    "markdown",
+	}
+}
+
+// NewCmdSummary returns a cobra command for summarizing plans
+func NewCmdSummary() *cobra.Command {
+	o := NewOptions()
+	cmd := &cobra.Command{
+		Use:   "summary",
+		Short: "Render a human-readable report of the changes in a plan",
+		Run: func(cmd *cobra.Command, args []string) {
+			cmdutil.CheckErr(o.Complete(args))
+			cmdutil.CheckErr(o.Validate())
+			cmdutil.CheckErr(o.Run())
+		},
+	}
+	cmd.Flags().StringVarP(&o.InputType, "type", "t", o.InputType, "One of 'auto', 'plan' or 'karen'.")
+	cmd.Flags().StringVarP(&o.inputPath, "input", "i", o.inputPath, "relative path to input file.")
+	cmd.Flags().StringVarP(&o.outputPath, "output", "o", o.outputPath, "relative path to output location. Defaults to stdout.")
+	cmd.Flags().StringVar(&o.format, "format", o.format, "One of 'markdown', 'text' or 'json'.")
+	cmd.Flags().StringVar(&o.url, "url", o.url, "url of the remote repository where the terraform files are located")
+	cmd.Flags().StringVar(&o.filePath, "filePath", o.filePath, "relative path under which the terraform files are located in the remote repository")
+	cmd.Flags().StringVar(&o.codeOwnersPath, "codeowners", o.codeOwnersPath, "relative path to a GitHub or GitLab CODEOWNERS file. The owners of the changed resources are listed as reviewers.")
+
+	cmd.Flags().StringVar(&o.priceSheetPath, "price-sheet", o.priceSheetPath, "relative path to a json price sheet. The estimated monthly cost before and after the plan and its delta are added to the summary.")
+
+	cmd.MarkFlagRequired("input")
+
+	return cmd
+}
+
+// Complete completes all the required options
+func (o *Options) Complete(args []string) error {
+	o.args = args
+	return nil
+}
+
+// Validate validates the provided options
+func (o *Options) Validate() error {
+	if len(o.args) != 0 {
+		return fmt.Errorf("extra arguments: %v", o.args)
+	}
+	if o.InputType != "auto" && o.InputType != "plan" && o.InputType != "karen" {
+		return errors.New(`--type must be 'auto', 'plan' or 'karen'`)
+	}
+	if o.format != "markdown" && o.format != "text" && o.format != "json" {
+		return errors.New(`--format must be 'markdown', 'text' or 'json'`)
+	}
+	if o.inputPath == "" {
+		return errors.New("summary requires inputPath")
+	}
+
+	var err error
+	o.InputType, err = cmdutil.ResolveInputType(o.inputPath, o.InputType)
+	if err != nil {
+		return err
+	}
+	if o.InputType != "plan" && o.InputType != "karen" {
+		return fmt.Errorf("summary requires a plan or karen file, the input is a %s file", o.InputType)
+	}
+	return nil
+}
+
+// Run executes summary command
+func (o *Options) Run() error {
+	nodeTable, err := cmdutil.ReadNodeTable(o.inputPath, o.InputType, o.url, o.filePath)
+	if err != nil {
+		return err
+	}
+	if o.codeOwnersPath != "" {
+		err = cmdutil.AddCodeOwners(nodeTable, o.codeOwnersPath, o.url)
+		if err != nil {
+			return err
+		}
+	}
+
+	var cost *preprocessor.CostReport
+	if o.priceSheetPath != "" {
+		cost, err = cmdutil.EstimateCosts(nodeTable, o.priceSheetPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	summary := preprocessor.SummarizePlan(nodeTable)
+	summary.Cost = cost
+
+	var output []byte
+	switch o.format {
+	case "markdown":
+		output = []byte(summary.Markdown())
+	case "text":
+		output = []byte(summary.Text())
+	case "json":
+		output, err = json.Marshal(summary)
+		if err != nil {
+			return err
+		}
+	}
+	return cmdutil.WriteOutput(o.outputPath, output)
+}
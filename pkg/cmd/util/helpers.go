@@ -1,15 +1,198 @@
 package util
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
 
+	"github.com/bfrn/karen-preprocessor/pkg/preprocessor"
 	"github.com/rs/zerolog/log"
 )
 
+// ExitError is returned by commands which have to terminate with a specific exit code.
+type ExitError struct {
+	Code int
+	Err  error
+}
+
+func (e *ExitError) Error() string {
+	if e.Err == nil {
+		return fmt.Sprintf("exit code %d", e.Code)
+	}
+	return e.Err.Error()
+}
+
 func CheckErr(err error) {
 	if err == nil {
 		return
 	}
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) {
+		if exitErr.Err != nil {
+			log.Error().Err(exitErr.Err).Msg("")
+		}
+		os.Exit(exitErr.Code)
+	}
 	log.Fatal().Err(err).Msg("")
 	os.Exit(1)
 }
+
+// ReadDocument reads the input file and parses it according to the input type into a karen document.
+// The url and filePath are only used for plan files.
+func ReadDocument(inputPath string, inputType string, url string, filePath string) (*preprocessor.KarenDocument, error) {
+	log.Debug().Msgf("read file %s", inputPath)
+	data, err := os.ReadFile(inputPath)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Debug().Msgf("parse %s file url=%s filepath=%s", inputType, url, filePath)
+	return preprocessor.ParseDocument(data, inputType, url, filePath)
+}
+
+// ReadStackDocument reads the input file like ReadDocument and additionally adds the outputs of its root module as
+// nodes, so that inputs which are merged can be linked by their terraform_remote_state data sources.
+func ReadStackDocument(inputPath string, inputType string, url string, filePath string) (*preprocessor.KarenDocument, error) {
+	log.Debug().Msgf("read file %s", inputPath)
+	data, err := os.ReadFile(inputPath)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Debug().Msgf("parse %s file with outputs url=%s filepath=%s", inputType, url, filePath)
+	return preprocessor.ParseStackDocument(data, inputType, url, filePath)
+}
+
+// DetectInputType reads the input file and detects whether it is a state, tfstate, plan or karen file.
+func DetectInputType(inputPath string) (string, error) {
+	log.Debug().Msgf("read file %s", inputPath)
+	data, err := os.ReadFile(inputPath)
+	if err != nil {
+		return "", err
+	}
+	return preprocessor.DetectInputKind(data)
+}
+
+// ResolveInputType returns the given input type or, if it is 'auto', the type detected from the input file.
+func ResolveInputType(inputPath string, inputType string) (string, error) {
+	if inputType != "auto" {
+		return inputType, nil
+	}
+	detected, err := DetectInputType(inputPath)
+	if err != nil {
+		return "", err
+	}
+	log.Debug().Msgf("detected type %s", detected)
+	return detected, nil
+}
+
+// ReadNodeTable reads the input file and parses it according to the input type into a node table.
+// The url and filePath are only used for plan files.
+func ReadNodeTable(inputPath string, inputType string, url string, filePath string) (map[string]preprocessor.Node, error) {
+	document, err := ReadDocument(inputPath, inputType, url, filePath)
+	if err != nil {
+		return nil, err
+	}
+	return document.Nodes, nil
+}
+
+// MarshalDocument marshals the karen document or, if bare is set, only its node table as in the format before karen version 1.0.
+func MarshalDocument(document *preprocessor.KarenDocument, bare bool) ([]byte, error) {
+	if bare {
+		return json.Marshal(document.Nodes)
+	}
+	return json.Marshal(document)
+}
+
+// WriteOutput writes the data to the file at outputPath or to stdout if no path is given.
+func WriteOutput(outputPath string, data []byte) error {
+	if outputPath == "" || outputPath == "-" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	log.Debug().Msgf("write file %s", outputPath)
+	return os.WriteFile(outputPath, data, 0644)
+}
+
+// ResolveTags groups the resources by the groupBy tag, adds their owner and environment if ownership is set and flags
+// resources without the required tags, as requested by the tag flags of the parse and merge commands.
+// Default tags are given like module.network:team=net,env=prod.
+func ResolveTags(nodeTable map[string]preprocessor.Node, groupBy string, ownership bool, required []string, defaultTags []string) error {
+	moduleDefaults := make(map[string]map[string]string)
+	for _, definition := range defaultTags {
+		module, tags, err := preprocessor.ParseModuleDefaultTags(definition)
+		if err != nil {
+			return err
+		}
+		if moduleDefaults[module] == nil {
+			moduleDefaults[module] = make(map[string]string)
+		}
+		for key, value := range tags {
+			moduleDefaults[module][key] = value
+		}
+	}
+
+	missingTags, err := preprocessor.ResolveRequestedTags(nodeTable, groupBy, ownership, required, moduleDefaults)
+	if err != nil {
+		return err
+	}
+	for _, missing := range missingTags {
+		log.Warn().Msg(missing.String())
+	}
+	return nil
+}
+
+// AddCodeOwners reads the CODEOWNERS file and attaches the owners of their locations to the modules and resources.
+// The locationPrefix is removed from the locations to get the paths within the repository.
+func AddCodeOwners(nodeTable map[string]preprocessor.Node, codeOwnersPath string, locationPrefix string) error {
+	log.Debug().Msgf("read CODEOWNERS file %s", codeOwnersPath)
+	data, err := os.ReadFile(codeOwnersPath)
+	if err != nil {
+		return err
+	}
+	codeOwners, err := preprocessor.ParseCodeOwners(data)
+	if err != nil {
+		return err
+	}
+	preprocessor.AddCodeOwners(nodeTable, codeOwners, locationPrefix)
+	return nil
+}
+
+// ApplyOverlay reads the overlay file, adds its attributes to the matching nodes, records the matches in the metadata of
+// the document and warns about patterns which matched no node.
+func ApplyOverlay(document *preprocessor.KarenDocument, overlayPath string) error {
+	log.Debug().Msgf("read overlay file %s", overlayPath)
+	data, err := os.ReadFile(overlayPath)
+	if err != nil {
+		return err
+	}
+	overlay, err := preprocessor.ParseOverlay(data)
+	if err != nil {
+		return err
+	}
+	report := preprocessor.ApplyOverlay(document.Nodes, overlay)
+	document.Metadata.Overlay = report
+	for _, pattern := range report.Unmatched {
+		log.Warn().Msgf("the overlay pattern '%s' matches no node", pattern)
+	}
+	return nil
+}
+
+// EstimateCosts reads the price sheet and annotates the resources and modules with their estimated monthly cost.
+func EstimateCosts(nodeTable map[string]preprocessor.Node, priceSheetPath string) (*preprocessor.CostReport, error) {
+	log.Debug().Msgf("read price sheet %s", priceSheetPath)
+	data, err := os.ReadFile(priceSheetPath)
+	if err != nil {
+		return nil, err
+	}
+	sheet, err := preprocessor.ParsePriceSheet(data)
+	if err != nil {
+		return nil, err
+	}
+	report := preprocessor.EstimateCosts(nodeTable, sheet)
+	for _, unpriced := range report.Unpriced {
+		log.Warn().Msgf("couldn't estimate the cost of %s", unpriced)
+	}
+	return report, nil
+}
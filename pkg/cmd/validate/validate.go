@@ -0,0 +1,110 @@
+package validate
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	cmdutil "github.com/bfrn/karen-preprocessor/pkg/cmd/util"
+	"github.com/bfrn/karen-preprocessor/pkg/preprocessor"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+// ExitCodeInvalid is the exit code of the validate command if the document does not conform to the karen schema.
+const ExitCodeInvalid = 2
+
+// Options is a struct to support validate command
+type Options struct {
+	inputPath  string
+	outputPath string
+	schema     bool
+	bare       bool
+
+	args []string
+}
+
+// NewOptions returns initialized Options
+func NewOptions() *Options {
+	return &Options{}
+}
+
+// NewCmdValidate returns a cobra command for validating karen documents
+func NewCmdValidate() *cobra.Command {
+	o := NewOptions()
+	cmd := &cobra.Command{
+		Use:   "validate",
+		Short: "Validate a karen document against the karen schema",
+		Long: `Validate a karen document, with or without envelope, against the karen JSON Schema.
+Every violation is printed with a JSON pointer to the offending value and the command exits with 2.
+If an output path is given, the normalised document is written to it.`,
+		Run: func(cmd *cobra.Command, args []string) {
+			cmdutil.CheckErr(o.Complete(args))
+			cmdutil.CheckErr(o.Validate())
+			cmdutil.CheckErr(o.Run())
+		},
+	}
+	cmd.Flags().StringVarP(&o.inputPath, "input", "i", o.inputPath, "relative path to input file.")
+	cmd.Flags().StringVarP(&o.outputPath, "output", "o", o.outputPath, "relative path to which the normalised document is written.")
+	cmd.Flags().BoolVar(&o.schema, "schema", o.schema, "print the karen JSON Schema instead of validating a document")
+	cmd.Flags().BoolVar(&o.bare, "bare", o.bare, "write the bare node table without the versioned envelope, as before karen version 1.0")
+
+	return cmd
+}
+
+// Complete completes all the required options
+func (o *Options) Complete(args []string) error {
+	o.args = args
+	return nil
+}
+
+// Validate validates the provided options
+func (o *Options) Validate() error {
+	if len(o.args) != 0 {
+		return fmt.Errorf("extra arguments: %v", o.args)
+	}
+	if !o.schema && o.inputPath == "" {
+		return errors.New("validate requires inputPath")
+	}
+	return nil
+}
+
+// Run executes validate command
+func (o *Options) Run() error {
+	if o.schema {
+		return cmdutil.WriteOutput(o.outputPath, preprocessor.KarenSchema())
+	}
+
+	log.Debug().Msgf("read file %s", o.inputPath)
+	data, err := os.ReadFile(o.inputPath)
+	if err != nil {
+		return err
+	}
+
+	document, err := preprocessor.ValidateKarenDocument(data)
+	var validationErr *preprocessor.ValidationError
+	if errors.As(err, &validationErr) {
+		fmt.Printf("%s is invalid:\n", o.inputPath)
+		for _, schemaError := range validationErr.Errors {
+			path := schemaError.Path
+			if path == "" {
+				path = "/"
+			}
+			fmt.Printf("  %s: %s\n", path, schemaError.Message)
+		}
+		return &cmdutil.ExitError{Code: ExitCodeInvalid}
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Printf("%s is valid (karen version %s, %d nodes)\n", o.inputPath, document.KarenVersion, len(document.Nodes))
+
+	if o.outputPath == "" {
+		return nil
+	}
+	output, err := cmdutil.MarshalDocument(document, o.bare)
+	if err != nil {
+		return err
+	}
+	return cmdutil.WriteOutput(o.outputPath, output)
+}
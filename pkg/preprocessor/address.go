@@ -0,0 +1,113 @@
+package preprocessor
+
+import (
+	"strings"
+)
+
+const (
+	Resource_mode_managed = "managed"
+	Resource_mode_data    = "data"
+)
+
+// resourceAddress contains the parts of a terraform resource address like
+// module.network.aws_subnet.private["a"]
+type resourceAddress struct {
+	// Module is the module path of the resource, e.g. module.network. It is empty for resources of the root module.
+	Module string
+	// Mode is either Resource_mode_managed or Resource_mode_data
+	Mode string
+	Type string
+	Name string
+	// Index is the raw instance key including the brackets, e.g. [0] or ["a"]
+	Index string
+}
+
+// TerraformAddress strips the stack and root prefix from a node address and returns the address as terraform knows it.
+func TerraformAddress(address string) string {
+	_, address = splitStackAddress(address)
+	if address == "" || address == RootAddress {
+		return ""
+	}
+	return strings.TrimPrefix(address, RootAddress+".")
+}
+
+// splitAddress splits an address into its dot separated segments.
+// Dots inside of index keys like ["a.b"] are not treated as separators.
+func splitAddress(address string) []string {
+	var segments []string
+	depth := 0
+	inString := false
+	start := 0
+	for i := 0; i < len(address); i++ {
+		switch c := address[i]; {
+		case inString:
+			if c == '\\' {
+				i++
+			} else if c == '"' {
+				inString = false
+			}
+		case c == '"':
+			inString = true
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+		case c == '.' && depth == 0:
+			segments = append(segments, address[start:i])
+			start = i + 1
+		}
+	}
+	return append(segments, address[start:])
+}
+
+// splitIndex splits a segment like web[0] into its name and its index.
+func splitIndex(segment string) (string, string) {
+	if !strings.HasSuffix(segment, "]") {
+		return segment, ""
+	}
+	idx := strings.Index(segment, "[")
+	if idx < 0 {
+		return segment, ""
+	}
+	return segment[:idx], segment[idx:]
+}
+
+// parseResourceAddress parses the terraform address of a resource. The root prefix of node addresses is removed beforehand.
+func parseResourceAddress(address string) (resourceAddress, bool) {
+	var parsed resourceAddress
+	segments := splitAddress(TerraformAddress(address))
+
+	var modulePath []string
+	for len(segments) >= 2 && segments[0] == "module" {
+		modulePath = append(modulePath, segments[0], segments[1])
+		segments = segments[2:]
+	}
+	parsed.Module = strings.Join(modulePath, ".")
+	parsed.Mode = Resource_mode_managed
+	if len(segments) == 3 && segments[0] == "data" {
+		parsed.Mode = Resource_mode_data
+		segments = segments[1:]
+	}
+	if len(segments) != 2 {
+		return parsed, false
+	}
+	parsed.Type = segments[0]
+	parsed.Name, parsed.Index = splitIndex(segments[1])
+	return parsed, true
+}
+
+// providerOfType returns the name of the provider which terraform infers by default for the given resource type.
+func providerOfType(resourceType string) string {
+	return strings.SplitN(resourceType, "_", 2)[0]
+}
+
+// parentTable maps the address of every node to the address of the node that contains it as a child.
+func parentTable(nodeTable map[string]Node) map[string]string {
+	parents := make(map[string]string)
+	for address, node := range nodeTable {
+		for _, child := range node.GetChildren() {
+			parents[child] = address
+		}
+	}
+	return parents
+}
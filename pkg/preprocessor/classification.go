@@ -0,0 +1,135 @@
+package preprocessor
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+//go:embed classification.json
+var builtinClassificationRules []byte
+
+// Node attributes under which the classification of a resource is stored
+const (
+	Attribute_provider = "provider"
+	Attribute_service  = "service"
+	Attribute_category = "category"
+	Attribute_icon     = "icon"
+)
+
+// Category_other is the category of resource types which match no classification rule
+const Category_other = "other"
+
+// ClassificationRules maps resource types to their service, category and icon. The file format is
+//
+//	{"rules": [{"pattern": "aws_s3_*", "service": "s3", "category": "storage", "icon": "aws/s3"}]}
+//
+// Patterns are globs on the resource type and the first matching rule wins. The provider defaults to the prefix of the
+// resource type and the icon to provider/service.
+type ClassificationRules struct {
+	Rules []ClassificationRule `json:"rules"`
+}
+
+// ClassificationRule classifies the resource types matching the pattern.
+type ClassificationRule struct {
+	Pattern  string `json:"pattern"`
+	Provider string `json:"provider,omitempty"`
+	Service  string `json:"service,omitempty"`
+	Category string `json:"category,omitempty"`
+	Icon     string `json:"icon,omitempty"`
+}
+
+// Classification is the provider, service, category and icon key of a resource type.
+type Classification struct {
+	Provider string `json:"provider"`
+	Service  string `json:"service"`
+	Category string `json:"category"`
+	Icon     string `json:"icon"`
+}
+
+// ClassificationRegistry classifies resource types by a list of rules.
+type ClassificationRegistry struct {
+	rules globRules[ClassificationRule]
+}
+
+// ParseClassificationRules takes a json formatted classification file and validates it.
+func ParseClassificationRules(data []byte) (*ClassificationRules, error) {
+	rules := new(ClassificationRules)
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(rules)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't parse the given classification file: %s", err.Error())
+	}
+	for idx, rule := range rules.Rules {
+		if rule.Pattern == "" {
+			return nil, fmt.Errorf("classification rule %d has no pattern", idx)
+		}
+	}
+	return rules, nil
+}
+
+// NewClassificationRegistry returns a registry with the built-in rules for the aws, azurerm and google providers.
+func NewClassificationRegistry() *ClassificationRegistry {
+	rules, err := ParseClassificationRules(builtinClassificationRules)
+	if err != nil {
+		panic(err)
+	}
+	registry := new(ClassificationRegistry)
+	registry.Extend(rules)
+	return registry
+}
+
+// Extend adds the rules to the registry. They take precedence over the rules which were added before.
+func (registry *ClassificationRegistry) Extend(rules *ClassificationRules) {
+	registry.rules.prepend(rules.Rules)
+}
+
+// Classify returns the classification of the resource type. Resource types without a matching rule get the
+// service that follows the provider prefix, e.g. s3 for aws_s3_bucket, and the category other.
+func (registry *ClassificationRegistry) Classify(resourceType string) Classification {
+	classification := Classification{Provider: providerOfType(resourceType), Category: Category_other}
+	if _, service, found := strings.Cut(resourceType, "_"); found {
+		classification.Service, _, _ = strings.Cut(service, "_")
+	}
+	if matching := registry.rules.matching(resourceType); len(matching) > 0 {
+		rule := matching[0]
+		if rule.Provider != "" {
+			classification.Provider = rule.Provider
+		}
+		if rule.Service != "" {
+			classification.Service = rule.Service
+		}
+		if rule.Category != "" {
+			classification.Category = rule.Category
+		}
+		classification.Icon = rule.Icon
+	}
+	if classification.Icon == "" {
+		classification.Icon = classification.Provider + "/" + classification.Service
+	}
+	return classification
+}
+
+// ClassifyResources stores the classification of every resource in the node table in the attributes
+// Attribute_provider, Attribute_service, Attribute_category and Attribute_icon.
+func ClassifyResources(nodeTable map[string]Node, registry *ClassificationRegistry) map[string]Node {
+	for address, node := range nodeTable {
+		resource, ok := node.(*Resource)
+		if !ok {
+			continue
+		}
+		parsed, ok := parseResourceAddress(address)
+		if !ok {
+			continue
+		}
+		classification := registry.Classify(parsed.Type)
+		resource.AddAttribute(Attribute_provider, classification.Provider)
+		resource.AddAttribute(Attribute_service, classification.Service)
+		resource.AddAttribute(Attribute_category, classification.Category)
+		resource.AddAttribute(Attribute_icon, classification.Icon)
+	}
+	return nodeTable
+}
@@ -0,0 +1,242 @@
+package preprocessor
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Node attributes holding the owners of a node according to a CODEOWNERS file
+const (
+	Attribute_code_owners = "codeOwners"
+	// Attribute_optional_code_owners holds the owners from optional GitLab sections, whose approval is not required
+	Attribute_optional_code_owners = "optionalCodeOwners"
+)
+
+// codeowners_location_file is the file name a location is matched as. Locations are the directories of the terraform
+// files, so patterns like *.tf have to match them.
+const codeowners_location_file = "main.tf"
+
+var codeOwnersSectionHeader = regexp.MustCompile(`^(\^)?\[([^\]]+)\](?:\[(\d+)\])?\s*(.*)$`)
+
+// CodeOwners is a parsed GitHub or GitLab CODEOWNERS file. A GitHub file has a single section without a name.
+type CodeOwners struct {
+	Sections []CodeOwnersSection
+}
+
+// CodeOwnersSection is a GitLab section of a CODEOWNERS file. Within a section the last matching rule applies,
+// and the owners of all sections are combined.
+type CodeOwnersSection struct {
+	Name string
+	// Optional sections start with ^ and do not require an approval
+	Optional  bool
+	Approvals int
+	// DefaultOwners apply to the rules of the section which have no owners
+	DefaultOwners []string
+	Rules         []CodeOwnersRule
+}
+
+// CodeOwnersRule assigns owners to the files matching a gitignore style pattern.
+type CodeOwnersRule struct {
+	Pattern string
+	Owners  []string
+
+	matcher *regexp.Regexp
+}
+
+// ParseCodeOwners parses a CODEOWNERS file in GitHub or GitLab syntax.
+func ParseCodeOwners(data []byte) (*CodeOwners, error) {
+	codeOwners := &CodeOwners{Sections: []CodeOwnersSection{{}}}
+	for idx, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if match := codeOwnersSectionHeader.FindStringSubmatch(line); match != nil {
+			section := CodeOwnersSection{Name: match[2], Optional: match[1] != "", Approvals: 1}
+			if match[3] != "" {
+				section.Approvals, _ = strconv.Atoi(match[3])
+			}
+			owners, err := parseCodeOwnersList(strings.Fields(match[4]))
+			if err != nil {
+				return nil, fmt.Errorf("couldn't parse the given CODEOWNERS file: line %d: %s", idx+1, err.Error())
+			}
+			section.DefaultOwners = owners
+			codeOwners.Sections = append(codeOwners.Sections, section)
+			continue
+		}
+
+		fields := splitCodeOwnersLine(line)
+		if strings.HasPrefix(fields[0], "!") {
+			return nil, fmt.Errorf("couldn't parse the given CODEOWNERS file: line %d: negated patterns are not supported", idx+1)
+		}
+		owners, err := parseCodeOwnersList(fields[1:])
+		if err != nil {
+			return nil, fmt.Errorf("couldn't parse the given CODEOWNERS file: line %d: %s", idx+1, err.Error())
+		}
+		section := &codeOwners.Sections[len(codeOwners.Sections)-1]
+		section.Rules = append(section.Rules, CodeOwnersRule{
+			Pattern: fields[0],
+			Owners:  owners,
+			matcher: compileCodeOwnersPattern(fields[0]),
+		})
+	}
+	return codeOwners, nil
+}
+
+// splitCodeOwnersLine splits a line at unescaped whitespace and removes a trailing comment.
+func splitCodeOwnersLine(line string) []string {
+	var fields []string
+	var current strings.Builder
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case c == '\\' && i+1 < len(line):
+			i++
+			current.WriteByte(line[i])
+		case c == ' ' || c == '\t':
+			if current.Len() > 0 {
+				fields = append(fields, current.String())
+				current.Reset()
+			}
+		case c == '#' && current.Len() == 0 && len(fields) > 0:
+			return fields
+		default:
+			current.WriteByte(c)
+		}
+	}
+	if current.Len() > 0 {
+		fields = append(fields, current.String())
+	}
+	return fields
+}
+
+// parseCodeOwnersList checks that the owners are users or groups like @org/team, or email addresses.
+func parseCodeOwnersList(owners []string) ([]string, error) {
+	for _, owner := range owners {
+		if !strings.Contains(owner, "@") {
+			return nil, fmt.Errorf("'%s' is no user, group or email address", owner)
+		}
+	}
+	return owners, nil
+}
+
+// compileCodeOwnersPattern converts a gitignore style pattern to a regular expression matching file paths relative
+// to the repository root. Patterns with a slash are anchored at the root, others match at any depth. A pattern
+// matching a directory matches all files below it, except for patterns ending in /* which only match direct children.
+// Patterns ending in /*/ match the subdirectories and therefore all files below them.
+func compileCodeOwnersPattern(pattern string) *regexp.Regexp {
+	trimmed := strings.Trim(pattern, "/")
+	anchored := strings.Contains(strings.TrimSuffix(pattern, "/"), "/")
+
+	var expression strings.Builder
+	if anchored {
+		expression.WriteString("^")
+	} else {
+		expression.WriteString("^(?:.*/)?")
+	}
+	for i := 0; i < len(trimmed); i++ {
+		switch {
+		case strings.HasPrefix(trimmed[i:], "**/"):
+			expression.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(trimmed[i:], "**"):
+			expression.WriteString(".*")
+			i++
+		case trimmed[i] == '*':
+			expression.WriteString("[^/]*")
+		case trimmed[i] == '?':
+			expression.WriteString("[^/]")
+		default:
+			expression.WriteString(regexp.QuoteMeta(string(trimmed[i])))
+		}
+	}
+	if !strings.HasSuffix(pattern, "/*") || strings.HasSuffix(pattern, "**/*") {
+		expression.WriteString("(?:/.*)?")
+	}
+	expression.WriteString("$")
+	return regexp.MustCompile(expression.String())
+}
+
+// OwnersOf returns the required and optional owners of the file with the given path relative to the repository root.
+func (codeOwners *CodeOwners) OwnersOf(file string) ([]string, []string) {
+	var required, optional []string
+	for _, section := range codeOwners.Sections {
+		var owners []string
+		matched := false
+		for _, rule := range section.Rules {
+			if rule.matcher.MatchString(file) {
+				matched = true
+				owners = rule.Owners
+				if len(owners) == 0 {
+					owners = section.DefaultOwners
+				}
+			}
+		}
+		if !matched {
+			continue
+		}
+		if section.Optional {
+			optional = appendUnique(optional, owners...)
+		} else {
+			required = appendUnique(required, owners...)
+		}
+	}
+	return required, optional
+}
+
+// AddCodeOwners attaches the owners of the location of every module and resource under the attributes Attribute_code_owners
+// and Attribute_optional_code_owners. The locationPrefix, e.g. the url of the repository, is removed from the locations to
+// get the paths relative to the repository root. Nodes without location use the location of their enclosing node.
+func AddCodeOwners(nodeTable map[string]Node, codeOwners *CodeOwners, locationPrefix string) {
+	parents := parentTable(nodeTable)
+	for _, address := range sortedAddresses(nodeTable) {
+		n := nodeTable[address]
+		switch n.(type) {
+		case *Module, *Resource, *ReferenceResource:
+		default:
+			continue
+		}
+
+		location := n.GetLocation()
+		for parent := parents[address]; location == "" && parent != ""; parent = parents[parent] {
+			location = nodeTable[parent].GetLocation()
+		}
+		if location == "" {
+			continue
+		}
+		directory := path.Clean("/" + strings.TrimPrefix(location, locationPrefix))
+		file := strings.TrimPrefix(path.Join(directory, codeowners_location_file), "/")
+
+		required, optional := codeOwners.OwnersOf(file)
+		if len(required) > 0 {
+			n.AddAttribute(Attribute_code_owners, required)
+		}
+		if len(optional) > 0 {
+			n.AddAttribute(Attribute_optional_code_owners, optional)
+		}
+	}
+}
+
+// attributeStrings returns the strings of a list attribute, which is a []string before and a []interface{} after
+// the node table was serialized.
+func attributeStrings(n Node, key string) []string {
+	switch casted := n.GetAttributes()[key].(type) {
+	case []string:
+		return casted
+	default:
+		return stringList(casted)
+	}
+}
+
+// sortedUnion returns the sorted distinct values of the lists.
+func sortedUnion(lists ...[]string) []string {
+	var union []string
+	for _, list := range lists {
+		union = appendUnique(union, list...)
+	}
+	sort.Strings(union)
+	return union
+}
@@ -0,0 +1,116 @@
+package preprocessor
+
+import (
+	"reflect"
+	"testing"
+)
+
+// gitHubCodeOwners is the example CODEOWNERS file of the GitHub documentation.
+const gitHubCodeOwners = `# These owners will be the default owners for everything in the repo.
+*       @global-owner1 @global-owner2
+*.js    @js-owner #This is an inline comment.
+*.go docs@example.com
+*.txt @octo-org/octocats
+/build/logs/ @doctocat
+docs/*  docs@example.com
+apps/ @octocat
+/docs/ @doctocat
+/scripts/ @doctocat @octocat
+**/logs @octocat
+/apps/ @octocat
+/apps/github
+`
+
+const gitLabCodeOwners = `* @admin
+
+[Documentation] @docs-team
+docs/
+README.md @tech-writer
+
+^[Review][2] @reviewers
+*.tf
+
+[Terraform]
+modules/**/*.tf @infra
+/environments/*/ @ops
+`
+
+func TestCodeOwnersOf(t *testing.T) {
+	tests := []struct {
+		codeOwners string
+		file       string
+		required   []string
+		optional   []string
+	}{
+		{codeOwners: gitHubCodeOwners, file: "README.md", required: []string{"@global-owner1", "@global-owner2"}},
+		{codeOwners: gitHubCodeOwners, file: "web/app.js", required: []string{"@js-owner"}},
+		{codeOwners: gitHubCodeOwners, file: "cmd/main.go", required: []string{"docs@example.com"}},
+		{codeOwners: gitHubCodeOwners, file: "notes/todo.txt", required: []string{"@octo-org/octocats"}},
+		// docs/* only matches direct children of the docs directory at the root
+		{codeOwners: "docs/* docs@example.com", file: "docs/getting-started.md", required: []string{"docs@example.com"}},
+		{codeOwners: "docs/* docs@example.com", file: "docs/build-app/troubleshooting.md"},
+		{codeOwners: "docs/* docs@example.com", file: "src/docs/getting-started.md"},
+		{codeOwners: "docs/**/* docs@example.com", file: "docs/build-app/troubleshooting.md", required: []string{"docs@example.com"}},
+		{codeOwners: gitHubCodeOwners, file: "docs/build-app/troubleshooting.md", required: []string{"@doctocat"}},
+		{codeOwners: gitHubCodeOwners, file: "src/docs/build-app/troubleshooting.md", required: []string{"@global-owner1", "@global-owner2"}},
+		// apps/ matches an apps directory anywhere, /apps/github without owners removes the owners again
+		{codeOwners: gitHubCodeOwners, file: "lib/apps/main.tf", required: []string{"@octocat"}},
+		{codeOwners: gitHubCodeOwners, file: "apps/main.tf", required: []string{"@octocat"}},
+		{codeOwners: gitHubCodeOwners, file: "apps/github/main.tf"},
+		{codeOwners: gitHubCodeOwners, file: "scripts/deploy/main.tf", required: []string{"@doctocat", "@octocat"}},
+		// **/logs matches a logs directory at any depth, also the one of /build/logs/
+		{codeOwners: gitHubCodeOwners, file: "build/logs/main.tf", required: []string{"@octocat"}},
+		{codeOwners: gitHubCodeOwners, file: "deeply/nested/logs/main.tf", required: []string{"@octocat"}},
+		{codeOwners: gitHubCodeOwners, file: "src/logs.tf", required: []string{"@global-owner1", "@global-owner2"}},
+		{codeOwners: "/build/logs/ @doctocat", file: "build/logs/main.tf", required: []string{"@doctocat"}},
+		{codeOwners: "/build/logs/ @doctocat", file: "src/build/logs/main.tf"},
+		{codeOwners: "modules/network/ @net", file: "modules/network/vpc/main.tf", required: []string{"@net"}},
+		{codeOwners: "modules/network/ @net", file: "live/modules/network/main.tf"},
+		{codeOwners: `path\ with\ spaces/ @spaces`, file: "path with spaces/main.tf", required: []string{"@spaces"}},
+		{codeOwners: gitLabCodeOwners, file: "main.tf", required: []string{"@admin"}, optional: []string{"@reviewers"}},
+		{codeOwners: gitLabCodeOwners, file: "docs/main.tf", required: []string{"@admin", "@docs-team"}, optional: []string{"@reviewers"}},
+		{codeOwners: gitLabCodeOwners, file: "README.md", required: []string{"@admin", "@tech-writer"}},
+		{codeOwners: gitLabCodeOwners, file: "modules/main.tf", required: []string{"@admin", "@infra"}, optional: []string{"@reviewers"}},
+		{codeOwners: gitLabCodeOwners, file: "modules/network/vpc/main.tf", required: []string{"@admin", "@infra"}, optional: []string{"@reviewers"}},
+		{codeOwners: gitLabCodeOwners, file: "environments/prod/main.tf", required: []string{"@admin", "@ops"}, optional: []string{"@reviewers"}},
+		{codeOwners: gitLabCodeOwners, file: "environments/prod/app/main.tf", required: []string{"@admin", "@ops"}, optional: []string{"@reviewers"}},
+		{codeOwners: gitLabCodeOwners, file: "live/environments/prod/main.tf", required: []string{"@admin"}, optional: []string{"@reviewers"}},
+	}
+	for _, test := range tests {
+		codeOwners, err := ParseCodeOwners([]byte(test.codeOwners))
+		if err != nil {
+			t.Fatal(err)
+		}
+		required, optional := codeOwners.OwnersOf(test.file)
+		if !reflect.DeepEqual(required, test.required) || !reflect.DeepEqual(optional, test.optional) {
+			t.Errorf("got owners %v and optional owners %v of %s, want %v and %v", required, optional, test.file, test.required, test.optional)
+		}
+	}
+}
+
+func TestParseCodeOwnersSections(t *testing.T) {
+	codeOwners, err := ParseCodeOwners([]byte(gitLabCodeOwners))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sections []CodeOwnersSection
+	for _, section := range codeOwners.Sections {
+		section.Rules = nil
+		sections = append(sections, section)
+	}
+	want := []CodeOwnersSection{
+		{},
+		{Name: "Documentation", Approvals: 1, DefaultOwners: []string{"@docs-team"}},
+		{Name: "Review", Optional: true, Approvals: 2, DefaultOwners: []string{"@reviewers"}},
+		{Name: "Terraform", Approvals: 1, DefaultOwners: []string{}},
+	}
+	if !reflect.DeepEqual(sections, want) {
+		t.Errorf("got sections %+v, want %+v", sections, want)
+	}
+
+	for _, data := range []string{"!docs/ @docs", "docs/ docs", "[Docs] docs"} {
+		if _, err := ParseCodeOwners([]byte(data)); err == nil {
+			t.Errorf("parsed the invalid CODEOWNERS file %s", data)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package preprocessor
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+//go:embed console_links.json
+var builtinConsoleLinkRules []byte
+
+// Attribute_console_url is the node attribute holding the link to a resource in the console of its cloud
+const Attribute_console_url = "consoleUrl"
+
+// templatePlaceholder matches the placeholders of url and import ID templates like {id} or {cluster|base}
+var templatePlaceholder = regexp.MustCompile(`\{([^{}|]+)(?:\|([a-z]+))?\}`)
+
+// ConsoleLinkRules maps resource types to url templates of their console pages. The file format is
+//
+//	{"variables": {"kubernetesDashboard": "https://dashboard.example.com"},
+//	 "rules": [{"pattern": "aws_instance", "url": "https://{region}.console.aws.amazon.com/ec2/home?region={region}#InstanceDetails:instanceId={id}"}]}
+//
+// Patterns are globs on the resource type and the first rule whose placeholders can all be resolved wins. A placeholder
+// is one of the variables derived from the state, which are region, account, project, zone, location and resourceId,
+// a dotted path into the state like metadata.name, or one of the variables of the file. The modifier |escape query
+// escapes the value, |base keeps its last path segment, e.g. {cluster|base}, and |join joins the elements of a list
+// with underscores, e.g. {cidr_blocks|join}. Without |join, lists are replaced by their first element.
+type ConsoleLinkRules struct {
+	Variables map[string]string `json:"variables,omitempty"`
+	Rules     []ConsoleLinkRule `json:"rules"`
+}
+
+// ConsoleLinkRule links the resources whose type matches the pattern to the expanded url template.
+type ConsoleLinkRule struct {
+	Pattern string `json:"pattern"`
+	URL     string `json:"url"`
+}
+
+// ConsoleLinkRegistry derives console links by a list of rules.
+type ConsoleLinkRegistry struct {
+	variables map[string]string
+	rules     globRules[ConsoleLinkRule]
+}
+
+// ParseConsoleLinkRules takes a json formatted console link file and validates it.
+func ParseConsoleLinkRules(data []byte) (*ConsoleLinkRules, error) {
+	rules := new(ConsoleLinkRules)
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(rules)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't parse the given console link file: %s", err.Error())
+	}
+	for idx, rule := range rules.Rules {
+		if rule.Pattern == "" || rule.URL == "" {
+			return nil, fmt.Errorf("console link rule %d has no pattern or url", idx)
+		}
+		if err := validateTemplate(rule.URL); err != nil {
+			return nil, fmt.Errorf("console link rule '%s' uses an %s", rule.Pattern, err.Error())
+		}
+	}
+	return rules, nil
+}
+
+// NewConsoleLinkRegistry returns a registry with the built-in rules for common aws, azurerm, google and kubernetes resources.
+func NewConsoleLinkRegistry() *ConsoleLinkRegistry {
+	rules, err := ParseConsoleLinkRules(builtinConsoleLinkRules)
+	if err != nil {
+		panic(err)
+	}
+	registry := &ConsoleLinkRegistry{variables: make(map[string]string)}
+	registry.Extend(rules)
+	return registry
+}
+
+// Extend adds the rules and variables to the registry. They take precedence over the ones which were added before.
+func (registry *ConsoleLinkRegistry) Extend(rules *ConsoleLinkRules) {
+	registry.rules.prepend(rules.Rules)
+	for key, value := range rules.Variables {
+		registry.variables[key] = value
+	}
+}
+
+// Link returns the console url of a resource of the given type and state, or the empty string if no rule matches
+// or the state lacks the values the url needs.
+func (registry *ConsoleLinkRegistry) Link(resourceType string, state map[string]interface{}) string {
+	var variables map[string]string
+	for _, rule := range registry.rules.matching(resourceType) {
+		if variables == nil {
+			variables = consoleVariables(resourceType, state)
+		}
+		link, resolved := expandTemplate(rule.URL, func(name string) interface{} {
+			if value := variables[name]; value != "" {
+				return value
+			}
+			if value, ok := lookupAttribute(state, strings.Split(name, ".")); ok && textAttribute(firstElement(value)) != "" {
+				return value
+			}
+			return registry.variables[name]
+		})
+		if resolved {
+			return link
+		}
+	}
+	return ""
+}
+
+// expandTemplate replaces the placeholders of a template like {name} or {cluster|base} with the values returned by the
+// lookup and applies their modifiers. It returns false if a placeholder has no value.
+func expandTemplate(template string, lookup func(string) interface{}) (string, bool) {
+	resolved := true
+	expanded := templatePlaceholder.ReplaceAllStringFunc(template, func(placeholder string) string {
+		match := templatePlaceholder.FindStringSubmatch(placeholder)
+		found := lookup(match[1])
+		value := textAttribute(firstElement(found))
+		switch match[2] {
+		case "join":
+			if list, ok := found.([]interface{}); ok {
+				elements := make([]string, 0, len(list))
+				for _, element := range list {
+					elements = append(elements, textAttribute(element))
+				}
+				value = strings.Join(elements, "_")
+			}
+		case "escape":
+			value = url.QueryEscape(value)
+		case "base":
+			value = path.Base(value)
+		}
+		if value == "" || value == "." {
+			resolved = false
+		}
+		return value
+	})
+	return expanded, resolved
+}
+
+// validateTemplate checks that the placeholders of a template only use known modifiers.
+func validateTemplate(template string) error {
+	for _, match := range templatePlaceholder.FindAllStringSubmatch(template, -1) {
+		if match[2] != "" && match[2] != "escape" && match[2] != "base" && match[2] != "join" {
+			return fmt.Errorf("unknown modifier '%s'", match[2])
+		}
+	}
+	return nil
+}
+
+// consoleVariables derives the region, account, project, zone, location and resource ID of a resource from its state.
+func consoleVariables(resourceType string, state map[string]interface{}) map[string]string {
+	variables := make(map[string]string)
+	placement, _, _, _ := placeResource(resourceAddress{Type: resourceType}, state)
+	switch providerOfType(resourceType) {
+	case "aws":
+		variables["region"] = placement.Region
+		variables["account"] = placement.Account
+		// some resources like aws_ecs_service only have their ARN as ID
+		if arn := strings.Split(stringAttribute(state, "id"), ":"); placement.Region == "" && len(arn) >= 5 && arn[0] == "arn" {
+			variables["region"] = arn[3]
+			variables["account"] = arn[4]
+		}
+	case "azurerm":
+		if id := stringAttribute(state, "id"); strings.HasPrefix(strings.ToLower(id), "/subscriptions/") {
+			variables["resourceId"] = id
+		}
+		variables["account"] = placement.Account
+		variables["location"] = placement.Region
+	case "google":
+		selfLink := googleResourcePath(stringAttribute(state, "self_link"))
+		variables["project"] = placement.Account
+		if segments := strings.Split(selfLink, "/"); variables["project"] == "" && len(segments) > 1 && segments[0] == "projects" {
+			variables["project"] = segments[1]
+		}
+		variables["region"] = path.Base(placement.Region)
+		variables["zone"] = path.Base(stringAttribute(state, "zone"))
+		variables["location"] = stringAttribute(state, "location")
+		if variables["location"] == "" {
+			variables["location"] = variables["region"]
+		}
+	}
+	for key, value := range variables {
+		if value == "" || value == "." || value == "global" {
+			delete(variables, key)
+		}
+	}
+	return variables
+}
+
+// AddConsoleLinks stores the console url of every resource which matches a rule of the registry in the attribute
+// Attribute_console_url. Resources which are only planned to be created have no link, as their identifiers are unknown.
+func AddConsoleLinks(nodeTable map[string]Node, registry *ConsoleLinkRegistry) int {
+	count := 0
+	for _, address := range sortedAddresses(nodeTable) {
+		resource, ok := nodeTable[address].(*Resource)
+		if !ok {
+			continue
+		}
+		parsed, ok := parseResourceAddress(address)
+		if !ok {
+			continue
+		}
+		state := resource.States[State_current]
+		if state == nil {
+			state = effectiveState(resource)
+		}
+		if link := registry.Link(parsed.Type, state); link != "" {
+			resource.AddAttribute(Attribute_console_url, link)
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,247 @@
+package preprocessor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+)
+
+// Attribute_monthly_cost is the node attribute holding the CostEstimate of a resource or module
+const Attribute_monthly_cost = "monthlyCost"
+
+// price_sheet_default_key is the key of the price which applies to all values of the key attribute
+const price_sheet_default_key = "*"
+
+// PriceSheet maps resource types and their sizing attributes to monthly prices. The file format is
+//
+//	{"currency": "USD", "prices": [
+//	  {"pattern": "aws_instance", "key": "instance_type", "monthly": {"t3.micro": 7.59, "m5.large": 70.08}},
+//	  {"pattern": "aws_ebs_volume", "key": "type", "monthly": {"gp3": 0.08, "*": 0.1}, "quantity": ["size"]},
+//	  {"pattern": "aws_nat_gateway", "monthly": {"*": 32.85}}]}
+//
+// Patterns are globs on the resource type. The value of the key attribute, a dotted path into the state, selects the
+// monthly price, and * is the price for all other values or entries without key. The price is multiplied by the first
+// of the quantity attributes which is set, e.g. the storage size or node count. The prices of all matching entries add up.
+type PriceSheet struct {
+	Currency string            `json:"currency,omitempty"`
+	Prices   []PriceSheetEntry `json:"prices"`
+}
+
+// PriceSheetEntry prices the resources whose type matches the pattern.
+type PriceSheetEntry struct {
+	Pattern  string             `json:"pattern"`
+	Key      string             `json:"key,omitempty"`
+	Monthly  map[string]float64 `json:"monthly"`
+	Quantity []string           `json:"quantity,omitempty"`
+
+	glob *regexp.Regexp
+}
+
+// CostEstimate is the monthly cost of a resource or module before and after a plan is applied.
+type CostEstimate struct {
+	Currency string  `json:"currency,omitempty"`
+	Current  float64 `json:"current"`
+	Planned  float64 `json:"planned"`
+	Delta    float64 `json:"delta"`
+}
+
+// ResourceCost is the cost estimate of a single resource.
+type ResourceCost struct {
+	// Address is the terraform address of the resource, prefixed with its stack if the document was merged from several stacks
+	Address string `json:"address"`
+	CostEstimate
+}
+
+// CostReport is the estimated monthly cost of a node table and the cost delta of a plan.
+type CostReport struct {
+	CostEstimate
+	// Resources contain the resources with a price
+	Resources []ResourceCost `json:"resources,omitempty"`
+	// Unpriced contain the resources matched by the price sheet whose sizing has no price, with the reason
+	Unpriced []string `json:"unpriced,omitempty"`
+}
+
+// ParsePriceSheet takes a json formatted price sheet and validates it.
+func ParsePriceSheet(data []byte) (*PriceSheet, error) {
+	sheet := new(PriceSheet)
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(sheet)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't parse the given price sheet: %s", err.Error())
+	}
+	for idx := range sheet.Prices {
+		entry := &sheet.Prices[idx]
+		if entry.Pattern == "" {
+			return nil, fmt.Errorf("price sheet entry %d has no pattern", idx)
+		}
+		if len(entry.Monthly) == 0 {
+			return nil, fmt.Errorf("price sheet entry '%s' has no monthly prices", entry.Pattern)
+		}
+		if _, ok := entry.Monthly[price_sheet_default_key]; entry.Key == "" && !ok {
+			return nil, fmt.Errorf("price sheet entry '%s' has no key, so it requires a '%s' price", entry.Pattern, price_sheet_default_key)
+		}
+		entry.glob = compileGlob(entry.Pattern)
+	}
+	return sheet, nil
+}
+
+// monthlyPrice returns the monthly price of a resource of the given type and state. It returns false and the reason
+// if an entry matches the resource type but has no price for its sizing.
+func (sheet *PriceSheet) monthlyPrice(resourceType string, state map[string]interface{}) (float64, bool, string) {
+	total := 0.0
+	for _, entry := range sheet.Prices {
+		if !entry.glob.MatchString(resourceType) {
+			continue
+		}
+		key := price_sheet_default_key
+		if entry.Key != "" {
+			if value := textAttribute(attributeAt(state, entry.Key)); value != "" {
+				key = value
+			}
+		}
+		price, ok := entry.Monthly[key]
+		if !ok {
+			price, ok = entry.Monthly[price_sheet_default_key]
+		}
+		if !ok {
+			return 0, false, fmt.Sprintf("no price for %s '%s'", entry.Key, key)
+		}
+		if len(entry.Quantity) > 0 {
+			quantity, ok := 0.0, false
+			for _, path := range entry.Quantity {
+				if quantity, ok = attributeAt(state, path).(float64); ok {
+					break
+				}
+			}
+			if !ok {
+				return 0, false, fmt.Sprintf("%s is not set", strings.Join(entry.Quantity, " or "))
+			}
+			price *= quantity
+		}
+		total += price
+	}
+	return total, true, ""
+}
+
+// matches reports whether an entry of the price sheet matches the resource type.
+func (sheet *PriceSheet) matches(resourceType string) bool {
+	for _, entry := range sheet.Prices {
+		if entry.glob.MatchString(resourceType) {
+			return true
+		}
+	}
+	return false
+}
+
+// EstimateCosts estimates the monthly cost of every managed resource matched by the price sheet in its current and
+// planned state and stores it with the delta in the attribute Attribute_monthly_cost. Modules and the parents of resource
+// instances get the sum of the resources they contain. States which are not plans have no changes, so their planned
+// cost equals the current cost.
+func EstimateCosts(nodeTable map[string]Node, sheet *PriceSheet) *CostReport {
+	report := &CostReport{CostEstimate: CostEstimate{Currency: sheet.Currency}}
+	isPlan := false
+	for _, n := range nodeTable {
+		if resource, ok := n.(*Resource); ok {
+			if _, ok := resource.States[State_planned]; ok {
+				isPlan = true
+				break
+			}
+		}
+	}
+
+	parents := parentTable(nodeTable)
+	totals := make(map[string]*CostEstimate)
+	for _, address := range sortedAddresses(nodeTable) {
+		resource, ok := nodeTable[address].(*Resource)
+		if !ok {
+			continue
+		}
+		parsed, ok := parseResourceAddress(address)
+		if !ok || parsed.Mode != Resource_mode_managed || len(resource.States) == 0 || !sheet.matches(parsed.Type) {
+			continue
+		}
+
+		estimate := CostEstimate{Currency: sheet.Currency}
+		priced := true
+		var reason string
+		if state := resource.States[State_current]; state != nil {
+			estimate.Current, priced, reason = sheet.monthlyPrice(parsed.Type, state)
+		}
+		estimate.Planned = estimate.Current
+		if isPlan {
+			estimate.Planned = 0
+			if state := resource.States[State_planned]; state != nil && priced {
+				estimate.Planned, priced, reason = sheet.monthlyPrice(parsed.Type, state)
+			}
+		}
+		if !priced {
+			report.Unpriced = append(report.Unpriced, displayAddress(address)+": "+reason)
+			continue
+		}
+		estimate.Current = roundCost(estimate.Current)
+		estimate.Planned = roundCost(estimate.Planned)
+		estimate.Delta = roundCost(estimate.Planned - estimate.Current)
+		resource.AddAttribute(Attribute_monthly_cost, estimate)
+		report.Resources = append(report.Resources, ResourceCost{Address: displayAddress(address), CostEstimate: estimate})
+
+		report.Current += estimate.Current
+		report.Planned += estimate.Planned
+		for parent := parents[address]; parent != ""; parent = parents[parent] {
+			switch nodeTable[parent].(type) {
+			case *Module, *ReferenceResource:
+			default:
+				continue
+			}
+			total, ok := totals[parent]
+			if !ok {
+				total = &CostEstimate{Currency: sheet.Currency}
+				totals[parent] = total
+			}
+			total.Current += estimate.Current
+			total.Planned += estimate.Planned
+		}
+	}
+
+	for address, total := range totals {
+		total.Current = roundCost(total.Current)
+		total.Planned = roundCost(total.Planned)
+		total.Delta = roundCost(total.Planned - total.Current)
+		nodeTable[address].AddAttribute(Attribute_monthly_cost, *total)
+	}
+	report.Current = roundCost(report.Current)
+	report.Planned = roundCost(report.Planned)
+	report.Delta = roundCost(report.Planned - report.Current)
+	return report
+}
+
+// Changed returns the resources whose cost changes with the plan.
+func (report *CostReport) Changed() []ResourceCost {
+	var changed []ResourceCost
+	for _, resource := range report.Resources {
+		if resource.Delta != 0 {
+			changed = append(changed, resource)
+		}
+	}
+	return changed
+}
+
+func roundCost(cost float64) float64 {
+	return math.Round(cost*100) / 100
+}
+
+// formatCost formats a cost with two decimals and the currency, and a sign if it is a delta.
+func formatCost(cost float64, currency string, delta bool) string {
+	format := "%.2f"
+	if delta {
+		format = "%+.2f"
+	}
+	formatted := fmt.Sprintf(format, cost)
+	if currency != "" {
+		formatted += " " + currency
+	}
+	return formatted
+}
@@ -0,0 +1,63 @@
+package preprocessor
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestParseTaintedAndDeposedObjects(t *testing.T) {
+	parsers := map[string]func([]byte) (map[string]Node, error){
+		"deposed_state.json": ParseStateFile,
+		"deposed.tfstate":    ParseRawStateFile,
+		"deposed_plan.json": func(data []byte) (map[string]Node, error) {
+			return ParsePlanFile(data, "", "")
+		},
+	}
+	for name, parse := range parsers {
+		t.Run(name, func(t *testing.T) {
+			data, err := os.ReadFile("testdata/" + name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			nodeTable, err := parse(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			address := RootAddress + ".aws_instance.web"
+			deposedAddress := DeposedObjectAddress(address, "00000001")
+			resource, ok := nodeTable[address].(*Resource)
+			if !ok {
+				t.Fatalf("the resource %s is missing", address)
+			}
+			if resource.Status != Instance_status_tainted {
+				t.Errorf("got status '%s', want %s", resource.Status, Instance_status_tainted)
+			}
+			if id := effectiveState(resource)["id"]; name != "deposed_plan.json" && id != "i-new" {
+				t.Errorf("got id %v of the current object, want i-new", id)
+			}
+			if !reflect.DeepEqual(resource.GetChildren(), []string{deposedAddress}) {
+				t.Errorf("got children %v, want the deposed object", resource.GetChildren())
+			}
+			deposed, ok := nodeTable[deposedAddress].(*DeposedObject)
+			if !ok {
+				t.Fatalf("the deposed object %s is missing", deposedAddress)
+			}
+			if deposed.DeposedKey != "00000001" {
+				t.Errorf("got deposed key '%s', want 00000001", deposed.DeposedKey)
+			}
+			if id := deposed.States[State_current]["id"]; id != "i-old" {
+				t.Errorf("got id %v of the deposed object, want i-old", id)
+			}
+			if name == "deposed_plan.json" {
+				if !reflect.DeepEqual(deposed.Actions, []string{Action_delete}) {
+					t.Errorf("got actions %v of the deposed object, want %s", deposed.Actions, Action_delete)
+				}
+				if !resource.HasAction(Action_replace) {
+					t.Errorf("got actions %v of the tainted resource, want it to be replaced", resource.Actions)
+				}
+			}
+		})
+	}
+}
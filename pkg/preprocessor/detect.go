@@ -0,0 +1,58 @@
+package preprocessor
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Input_kind_auto lets ParseDocument detect the kind of the input from its content
+const Input_kind_auto = "auto"
+
+// DetectInputKind detects from the content whether the data is the json output of 'terraform show' for a state or a plan,
+// a raw terraform.tfstate file or a karen document, with or without envelope.
+func DetectInputKind(data []byte) (string, error) {
+	var rawDocument map[string]json.RawMessage
+	err := json.Unmarshal(data, &rawDocument)
+	if err != nil {
+		return "", detectionError("the file is not a json object")
+	}
+
+	has := func(key string) bool {
+		_, ok := rawDocument[key]
+		return ok
+	}
+	switch {
+	case isKarenEnvelope(rawDocument):
+		return Input_kind_karen, nil
+	case has("format_version") && (has("planned_values") || has("resource_changes") || has("prior_state")):
+		return Input_kind_plan, nil
+	case has("format_version"):
+		// terraform show -json omits the values of an empty state
+		return Input_kind_state, nil
+	case has("version") && has("lineage"):
+		return Input_kind_tfstate, nil
+	case len(rawDocument) > 0 && isBareNodeTable(rawDocument):
+		return Input_kind_karen, nil
+	}
+	return "", detectionError("the file has none of the known shapes")
+}
+
+func detectionError(reason string) error {
+	return fmt.Errorf("couldn't detect the type of the given file, expected one of '%s', '%s', '%s' or '%s': %s",
+		Input_kind_state, Input_kind_tfstate, Input_kind_plan, Input_kind_karen, reason)
+}
+
+// isBareNodeTable reports whether every value of the json object looks like a karen node.
+func isBareNodeTable(rawDocument map[string]json.RawMessage) bool {
+	for _, rawNode := range rawDocument {
+		var header struct {
+			Address  *string `json:"address"`
+			NodeType *string `json:"nodeType"`
+		}
+		err := json.Unmarshal(rawNode, &header)
+		if err != nil || header.Address == nil || header.NodeType == nil {
+			return false
+		}
+	}
+	return true
+}
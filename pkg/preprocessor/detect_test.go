@@ -0,0 +1,47 @@
+package preprocessor
+
+import (
+	"testing"
+)
+
+func TestDetectInputKind(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{name: "state", data: `{"format_version": "1.0", "values": {"root_module": {}}}`, want: Input_kind_state},
+		{name: "empty state", data: `{"format_version": "1.0"}`, want: Input_kind_state},
+		{name: "plan", data: `{"format_version": "1.2", "resource_changes": []}`, want: Input_kind_plan},
+		{name: "raw state", data: `{"version": 4, "lineage": "abc", "resources": []}`, want: Input_kind_tfstate},
+		{name: "karen document", data: `{"karenVersion": "1.0", "metadata": {}, "nodes": {}}`, want: Input_kind_karen},
+		{name: "bare node table", data: `{"_root": {"address": "_root", "nodeType": "Module"}}`, want: Input_kind_karen},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			kind, err := DetectInputKind([]byte(test.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if kind != test.want {
+				t.Errorf("got %s, want %s", kind, test.want)
+			}
+		})
+	}
+
+	for _, data := range []string{`[]`, `{"serial": 1}`} {
+		if kind, err := DetectInputKind([]byte(data)); err == nil {
+			t.Errorf("detected %s for %s", kind, data)
+		}
+	}
+}
+
+func TestParseDocumentOfEmptyState(t *testing.T) {
+	document, err := ParseDocument([]byte(`{"format_version": "1.0"}`), Input_kind_auto, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := document.Nodes[RootAddress].(*Module); !ok || len(document.Nodes) != 1 {
+		t.Errorf("got nodes %v, want only the root module", sortedAddresses(document.Nodes))
+	}
+}
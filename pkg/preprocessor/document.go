@@ -0,0 +1,228 @@
+package preprocessor
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// KarenSchemaVersion is the version of the karen document format. The major version is increased on breaking changes.
+const KarenSchemaVersion = "1.0"
+
+// GeneratorVersion is the version of the preprocessor which is recorded in generated documents.
+// It is set at build time with -ldflags "-X github.com/bfrn/karen-preprocessor/pkg/preprocessor.GeneratorVersion=<version>".
+var GeneratorVersion = "dev"
+
+// Kinds of input a karen document can be generated from
+const (
+	Input_kind_state   = "state"
+	Input_kind_tfstate = "tfstate"
+	Input_kind_plan    = "plan"
+	Input_kind_karen   = "karen"
+	// Input_kind_merged is the input kind of node tables which were merged from several inputs by MergeDocuments
+	Input_kind_merged = "merged"
+)
+
+const (
+	Redaction_sensitive_removed = "removed"
+)
+
+// KarenDocument is the versioned envelope around a node table.
+type KarenDocument struct {
+	KarenVersion string           `json:"karenVersion"`
+	Metadata     DocumentMetadata `json:"metadata"`
+	Nodes        map[string]Node  `json:"nodes"`
+	// Schemas map the schema keys of the resources to the schemas of their resource types, if provider schemas were given
+	Schemas map[string]*ResourceSchema `json:"schemas,omitempty"`
+}
+
+// DocumentMetadata describes the input a karen document was generated from.
+type DocumentMetadata struct {
+	GeneratorVersion string `json:"generatorVersion"`
+	InputKind        string `json:"inputKind"`
+	TerraformVersion string `json:"terraformVersion,omitempty"`
+	// FormatVersion is the format_version of the terraform json output or the version of a raw state file
+	FormatVersion string `json:"formatVersion,omitempty"`
+	// Serial and Lineage are only known for raw state files
+	Serial    *uint64           `json:"serial,omitempty"`
+	Lineage   string            `json:"lineage,omitempty"`
+	ParsedAt  time.Time         `json:"parsedAt"`
+	Redaction RedactionSettings `json:"redaction"`
+	// Overlay reports how many nodes the patterns of the overlay matched, if one was applied
+	Overlay *OverlayReport `json:"overlay,omitempty"`
+}
+
+// RedactionSettings describe how sensitive values were treated during parsing.
+type RedactionSettings struct {
+	// SensitiveValues describes what happened to values terraform marks as sensitive
+	SensitiveValues string `json:"sensitiveValues"`
+}
+
+// terraformHeader contains the fields of terraform json outputs and raw state files that describe the file itself.
+type terraformHeader struct {
+	FormatVersion    string  `json:"format_version"`
+	TerraformVersion string  `json:"terraform_version"`
+	Serial           *uint64 `json:"serial"`
+	Lineage          string  `json:"lineage"`
+	Version          *int    `json:"version"`
+}
+
+// newDocumentMetadata reads the metadata of a terraform json output or raw state file.
+func newDocumentMetadata(data []byte, inputKind string) (DocumentMetadata, error) {
+	var header terraformHeader
+	err := json.Unmarshal(data, &header)
+	if err != nil {
+		return DocumentMetadata{}, fmt.Errorf("couldn't read the metadata of the given %s file: %s", inputKind, err.Error())
+	}
+	if header.FormatVersion == "" && header.Version != nil {
+		header.FormatVersion = strconv.Itoa(*header.Version)
+	}
+	return DocumentMetadata{
+		GeneratorVersion: GeneratorVersion,
+		InputKind:        inputKind,
+		TerraformVersion: header.TerraformVersion,
+		FormatVersion:    header.FormatVersion,
+		Serial:           header.Serial,
+		Lineage:          header.Lineage,
+		ParsedAt:         time.Now().UTC(),
+		Redaction: RedactionSettings{
+			SensitiveValues: Redaction_sensitive_removed,
+		},
+	}, nil
+}
+
+// NewKarenDocument wraps the node table with the given metadata.
+func NewKarenDocument(nodeTable map[string]Node, metadata DocumentMetadata) *KarenDocument {
+	return &KarenDocument{
+		KarenVersion: KarenSchemaVersion,
+		Metadata:     metadata,
+		Nodes:        nodeTable,
+	}
+}
+
+// ParseDocument parses the input of the given kind and wraps the resulting node table in a karen document.
+// The tfConfigUrl and tfConfigMainPath are only used for plan files. Karen documents are validated against the
+// karen schema and keep their metadata. With the input kind auto, the kind is detected from the content.
+func ParseDocument(data []byte, inputKind string, tfConfigUrl string, tfConfigMainPath string) (*KarenDocument, error) {
+	var nodeTable map[string]Node
+	var err error
+	if inputKind == Input_kind_auto {
+		inputKind, err = DetectInputKind(data)
+		if err != nil {
+			return nil, err
+		}
+	}
+	switch inputKind {
+	case Input_kind_karen:
+		return ValidateKarenDocument(data)
+	case Input_kind_state:
+		nodeTable, err = ParseStateFile(data)
+	case Input_kind_tfstate:
+		nodeTable, err = ParseRawStateFile(data)
+	case Input_kind_plan:
+		nodeTable, err = ParsePlanFile(data, tfConfigUrl, tfConfigMainPath)
+	default:
+		return nil, fmt.Errorf("unknown input kind '%s'", inputKind)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	metadata, err := newDocumentMetadata(data, inputKind)
+	if err != nil {
+		return nil, err
+	}
+	return NewKarenDocument(nodeTable, metadata), nil
+}
+
+// isKarenEnvelope reports whether the json object is a karen document envelope rather than a bare node table.
+func isKarenEnvelope(rawDocument map[string]json.RawMessage) bool {
+	_, hasVersion := rawDocument["karenVersion"]
+	_, hasNodes := rawDocument["nodes"]
+	return hasVersion && hasNodes
+}
+
+// ParseKarenDocument takes a json formatted karen document and restores it. Bare node tables
+// without an envelope are accepted as well and get metadata with the input kind karen.
+func ParseKarenDocument(karenFile []byte) (*KarenDocument, error) {
+	var rawDocument map[string]json.RawMessage
+	err := json.Unmarshal(karenFile, &rawDocument)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't parse the given karen file: %s", err.Error())
+	}
+
+	if !isKarenEnvelope(rawDocument) {
+		nodeTable, err := parseKarenNodes(rawDocument)
+		if err != nil {
+			return nil, err
+		}
+		metadata := DocumentMetadata{
+			GeneratorVersion: GeneratorVersion,
+			InputKind:        Input_kind_karen,
+			ParsedAt:         time.Now().UTC(),
+			Redaction: RedactionSettings{
+				SensitiveValues: Redaction_sensitive_removed,
+			},
+		}
+		return NewKarenDocument(nodeTable, metadata), nil
+	}
+
+	document := new(KarenDocument)
+	err = json.Unmarshal(rawDocument["karenVersion"], &document.KarenVersion)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't parse the karen version: %s", err.Error())
+	}
+	if !isCompatibleKarenVersion(document.KarenVersion) {
+		return nil, fmt.Errorf("karen version '%s' is not supported, expected version %s", document.KarenVersion, KarenSchemaVersion)
+	}
+	if rawMetadata, ok := rawDocument["metadata"]; ok {
+		err = json.Unmarshal(rawMetadata, &document.Metadata)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't parse the metadata of the given karen file: %s", err.Error())
+		}
+	}
+	var rawNodes map[string]json.RawMessage
+	err = json.Unmarshal(rawDocument["nodes"], &rawNodes)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't parse the nodes of the given karen file: %s", err.Error())
+	}
+	document.Nodes, err = parseKarenNodes(rawNodes)
+	if err != nil {
+		return nil, err
+	}
+	if rawSchemas, ok := rawDocument["schemas"]; ok {
+		err = json.Unmarshal(rawSchemas, &document.Schemas)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't parse the schemas of the given karen file: %s", err.Error())
+		}
+	}
+	return document, nil
+}
+
+// isCompatibleKarenVersion reports whether documents of the given version can be read, which is the case if the major versions match.
+func isCompatibleKarenVersion(version string) bool {
+	major := strings.SplitN(version, ".", 2)[0]
+	return major == strings.SplitN(KarenSchemaVersion, ".", 2)[0]
+}
+
+// parseKarenNodes restores the nodes of a node table from their json representation.
+func parseKarenNodes(rawNodes map[string]json.RawMessage) (map[string]Node, error) {
+	nodeTable := make(map[string]Node)
+	for address, rawNode := range rawNodes {
+		var header struct {
+			NodeType string `json:"nodeType"`
+		}
+		err := json.Unmarshal(rawNode, &header)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't parse the given karen file: %s", err.Error())
+		}
+		node, err := unmarshalNode(address, header.NodeType, rawNode)
+		if err != nil {
+			return nil, err
+		}
+		nodeTable[address] = node
+	}
+	return nodeTable, nil
+}
@@ -3,6 +3,9 @@ package preprocessor
 import (
 	"fmt"
 	"path"
+	"sort"
+	"strconv"
+	"strings"
 
 	tfjson "github.com/hashicorp/terraform-json"
 )
@@ -11,13 +14,51 @@ func addResourceChangesInformation(nodeTable map[string]Node, tfjsonResourceChan
 	var err error
 	for _, tfjsonResourceChange := range tfjsonResourceChanges {
 		address := RootAddress + "." + tfjsonResourceChange.Address
-		node := nodeTable[address]
+		previousAddress := ""
+		if tfjsonResourceChange.PreviousAddress != "" && tfjsonResourceChange.PreviousAddress != tfjsonResourceChange.Address {
+			previousAddress = RootAddress + "." + tfjsonResourceChange.PreviousAddress
+		}
+
+		if tfjsonResourceChange.DeposedKey != "" {
+			// changes of deposed objects do not concern the current instance
+			err = addDeposedObjectChange(nodeTable, tfjsonResourceChange, address, stateToAdd)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		node, ok := nodeTable[address]
+		if !ok {
+			// the resource is created, imported or was moved to the address, so the prior state does not contain it
+			node, err = addMissingResource(nodeTable, address, previousAddress)
+			if err != nil {
+				return nil, err
+			}
+		}
 		resource, ok := node.(*Resource)
 		if !ok {
-			err := fmt.Errorf("could not cast Node to Resource")
+			err := fmt.Errorf("could not cast Node '%s' to Resource", address)
 			return nil, err
 		}
 		resource = addActionsToNode(tfjsonResourceChange, resource)
+		if resource.Provider == "" {
+			resource.Provider = tfjsonResourceChange.ProviderName
+		}
+		if previousAddress != "" {
+			resource.addAction(Action_move)
+			resource.PreviousAddress = previousAddress
+		}
+		if tfjsonResourceChange.Change.Importing != nil {
+			resource.addAction(Action_import)
+			resource.ImportID = tfjsonResourceChange.Change.Importing.ID
+			if _, ok := resource.States[State_current]; !ok && tfjsonResourceChange.Change.Before != nil {
+				resource, err = addStateFromResourceChangeToNode(tfjsonResourceChange, resource, State_current)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
 
 		requestedStateIsNotPresent := (tfjsonResourceChange.Change.Before != nil && stateToAdd == State_current) ||
 			(tfjsonResourceChange.Change.After != nil && stateToAdd == State_planned)
@@ -33,30 +74,184 @@ func addResourceChangesInformation(nodeTable map[string]Node, tfjsonResourceChan
 	return nodeTable, nil
 }
 
+// addDeposedObjectChange adds the actions and the requested state of a change of a deposed object to the deposed object,
+// which is added as child of its resource instance if the node table does not contain it yet.
+func addDeposedObjectChange(nodeTable map[string]Node, tfjsonResourceChange *tfjson.ResourceChange, address string, stateToAdd string) error {
+	deposedAddress := DeposedObjectAddress(address, tfjsonResourceChange.DeposedKey)
+	node, ok := nodeTable[deposedAddress]
+	if !ok {
+		resource, ok := nodeTable[address].(*Resource)
+		if !ok {
+			var err error
+			resource, err = addMissingResource(nodeTable, address, "")
+			if err != nil {
+				return err
+			}
+		}
+		deposedObject, err := NewDeposedObject(address, tfjsonResourceChange.DeposedKey, resource.Dependencies)
+		if err != nil {
+			return err
+		}
+		resource.AddChild(deposedAddress)
+		nodeTable[deposedAddress] = deposedObject
+		node = deposedObject
+	}
+	deposedObject, ok := node.(*DeposedObject)
+	if !ok {
+		return fmt.Errorf("could not cast Node '%s' to DeposedObject", deposedAddress)
+	}
+
+	addActionsToNode(tfjsonResourceChange, deposedObject.Resource)
+	if deposedObject.Provider == "" {
+		deposedObject.Provider = tfjsonResourceChange.ProviderName
+	}
+	requestedStateIsNotPresent := (tfjsonResourceChange.Change.Before != nil && stateToAdd == State_current) ||
+		(tfjsonResourceChange.Change.After != nil && stateToAdd == State_planned)
+	if requestedStateIsNotPresent {
+		_, err := addStateFromResourceChangeToNode(tfjsonResourceChange, deposedObject.Resource, stateToAdd)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addMissingResource adds a resource which is not contained in the prior state to the node table, together with the
+// modules and the resource with count or for_each enclosing it. If the resource was moved and its previous address is
+// contained in the prior state, the resource takes over the dependencies and state of its previous address.
+func addMissingResource(nodeTable map[string]Node, address string, previousAddress string) (*Resource, error) {
+	resource, err := NewResource(address, nil)
+	if err != nil {
+		return nil, err
+	}
+	if previous, ok := nodeTable[previousAddress].(*Resource); ok {
+		resource.Dependencies = previous.Dependencies
+		resource.States = previous.States
+		resource.SensitiveAttributes = previous.SensitiveAttributes
+		removeNode(nodeTable, previousAddress)
+		replaceDependency(nodeTable, previousAddress, address)
+		previousParsed, previousOk := parseResourceAddress(previousAddress)
+		parsed, ok := parseResourceAddress(address)
+		if previousOk && ok && previousParsed.Index != "" && parsed.Index != "" {
+			previousReference := strings.TrimSuffix(previousAddress, previousParsed.Index)
+			if _, ok := nodeTable[previousReference]; !ok {
+				replaceDependency(nodeTable, previousReference, strings.TrimSuffix(address, parsed.Index))
+			}
+		}
+	}
+
+	parsed, ok := parseResourceAddress(address)
+	if !ok {
+		return nil, fmt.Errorf("could not parse the resource address '%s'", address)
+	}
+	parent := RootAddress
+	segments := splitAddress(parsed.Module)
+	for idx := 0; idx+1 < len(segments); idx += 2 {
+		moduleAddress := parent + "." + segments[idx] + "." + segments[idx+1]
+		if _, ok := nodeTable[moduleAddress]; !ok {
+			module, err := NewModule(moduleAddress, nil)
+			if err != nil {
+				return nil, err
+			}
+			nodeTable[moduleAddress] = module
+			nodeTable[parent].AddChild(moduleAddress)
+		}
+		parent = moduleAddress
+	}
+
+	if parsed.Index != "" {
+		referenceResourceAddress := strings.TrimSuffix(address, parsed.Index)
+		if _, ok := nodeTable[referenceResourceAddress]; !ok {
+			referenceResource, err := NewReferenceResource(referenceResourceAddress, nil, resource.Dependencies)
+			if err != nil {
+				return nil, err
+			}
+			nodeTable[referenceResourceAddress] = referenceResource
+			nodeTable[parent].AddChild(referenceResourceAddress)
+		}
+		parent = referenceResourceAddress
+	}
+	nodeTable[parent].AddChild(address)
+	nodeTable[address] = resource
+	return resource, nil
+}
+
+// replaceDependency replaces the address in the dependencies of all resources, for example after the resource was moved.
+func replaceDependency(nodeTable map[string]Node, address string, replacement string) {
+	replace := func(dependencies []string) {
+		for idx, dependency := range dependencies {
+			if dependency == address {
+				dependencies[idx] = replacement
+			}
+		}
+	}
+	for _, n := range nodeTable {
+		switch casted := n.(type) {
+		case *Resource:
+			replace(casted.Dependencies)
+		case *ReferenceResource:
+			replace(casted.Dependencies)
+		case *DeposedObject:
+			replace(casted.Dependencies)
+		}
+	}
+}
+
+// removeSubtree removes the node and all of its descendants from the node table, e.g. a view which is built again.
+func removeSubtree(nodeTable map[string]Node, address string) {
+	n, ok := nodeTable[address]
+	if !ok {
+		return
+	}
+	for _, child := range n.GetChildren() {
+		removeSubtree(nodeTable, child)
+	}
+	delete(nodeTable, address)
+}
+
+// removeNode removes the node from the node table and from the children of its parent. A resource with count or
+// for_each which has no instances left is removed as well.
+func removeNode(nodeTable map[string]Node, address string) {
+	delete(nodeTable, address)
+	for parentAddress, parent := range nodeTable {
+		data := parent.(nodeDataProvider).data()
+		for idx, child := range data.Children {
+			if child != address {
+				continue
+			}
+			data.Children = append(data.Children[:idx], data.Children[idx+1:]...)
+			if _, ok := parent.(*ReferenceResource); ok && len(data.Children) == 0 {
+				removeNode(nodeTable, parentAddress)
+			}
+			return
+		}
+	}
+}
+
 func addActionsToNode(tfjsonResourceChange *tfjson.ResourceChange, resource *Resource) *Resource {
 	if tfjsonResourceChange.Change.Actions.Create() {
-		resource.addAction("Create")
+		resource.addAction(Action_create)
 	}
 	if tfjsonResourceChange.Change.Actions.CreateBeforeDestroy() {
-		resource.addAction("CreateBeforeDestroy")
+		resource.addAction(Action_create_before_destroy)
 	}
 	if tfjsonResourceChange.Change.Actions.Delete() {
-		resource.addAction("Delete")
+		resource.addAction(Action_delete)
 	}
 	if tfjsonResourceChange.Change.Actions.DestroyBeforeCreate() {
-		resource.addAction("DestroyBeforeCreate")
+		resource.addAction(Action_destroy_before_create)
 	}
 	if tfjsonResourceChange.Change.Actions.NoOp() {
-		resource.addAction("NoOp")
+		resource.addAction(Action_no_op)
 	}
 	if tfjsonResourceChange.Change.Actions.Read() {
-		resource.addAction("Read")
+		resource.addAction(Action_read)
 	}
 	if tfjsonResourceChange.Change.Actions.Replace() {
-		resource.addAction("Replace")
+		resource.addAction(Action_replace)
 	}
 	if tfjsonResourceChange.Change.Actions.Update() {
-		resource.addAction("Update")
+		resource.addAction(Action_update)
 	}
 	return resource
 }
@@ -84,6 +279,7 @@ func addStateFromResourceChangeToNode(tfjsonResourceChange *tfjson.ResourceChang
 			return nil, fmt.Errorf("could not cast values \\'After\\' to map[string]interface{}")
 		}
 		resource.addState(stateToAdd, planedValuesMap)
+		resource.UnknownAttributes = unknownPaths("", tfjsonResourceChange.Change.AfterUnknown)
 		sensitiveValues, ok := tfjsonResourceChange.Change.AfterSensitive.(map[string]interface{})
 		if ok {
 			err := resource.removeSensitiveValues(stateToAdd, sensitiveValues)
@@ -97,6 +293,32 @@ func addStateFromResourceChangeToNode(tfjsonResourceChange *tfjson.ResourceChang
 	return resource, nil
 }
 
+// unknownPaths returns the paths of the attributes which the after_unknown value of a change marks as unknown, in the
+// format of the paths of sensitive attributes.
+func unknownPaths(prefix string, afterUnknown interface{}) []string {
+	var paths []string
+	switch casted := afterUnknown.(type) {
+	case map[string]interface{}:
+		for key, nested := range casted {
+			path := key
+			if prefix != "" {
+				path = prefix + "." + key
+			}
+			paths = append(paths, unknownPaths(path, nested)...)
+		}
+	case []interface{}:
+		for idx, nested := range casted {
+			paths = append(paths, unknownPaths(prefix+"["+strconv.Itoa(idx)+"]", nested)...)
+		}
+	case bool:
+		if casted && prefix != "" {
+			paths = append(paths, prefix)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
 func addConfigInformation(nodeTable map[string]Node, tfjsonConfig *tfjson.Config, url string, basepath string) (map[string]Node, error) {
 	var err error
 	if tfjsonConfig.ProviderConfigs != nil {
@@ -175,10 +397,65 @@ func addConfigResourceInfoToNodes(nodeTable map[string]Node, tfjsonConfigResourc
 			nodeTable[address] = module
 		}
 		nodeTable[address].SetLocation(location)
+
+		// resources which are not in the prior state have no dependencies yet, so they are taken from the configuration
+		references := configReferences(nodeTable, tfjsonConfigResource, parentAddress)
+		switch casted := nodeTable[address].(type) {
+		case *Resource:
+			casted.Dependencies = appendUnique(casted.Dependencies, references...)
+		case *ReferenceResource:
+			casted.Dependencies = appendUnique(casted.Dependencies, references...)
+			for _, child := range casted.GetChildren() {
+				if instance, ok := nodeTable[child].(*Resource); ok {
+					instance.Dependencies = appendUnique(instance.Dependencies, references...)
+				}
+			}
+		}
 	}
 	return nodeTable, nil
 }
 
+// configReferences returns the addresses of the nodes in the module of a configured resource which its expressions
+// and its depends_on argument reference.
+func configReferences(nodeTable map[string]Node, tfjsonConfigResource *tfjson.ConfigResource, parentAddress string) []string {
+	var references []string
+	var addExpressions func(expressions map[string]*tfjson.Expression)
+	addExpressions = func(expressions map[string]*tfjson.Expression) {
+		for _, expression := range expressions {
+			if expression == nil || expression.ExpressionData == nil {
+				continue
+			}
+			references = append(references, expression.References...)
+			for _, nestedBlock := range expression.NestedBlocks {
+				addExpressions(nestedBlock)
+			}
+		}
+	}
+	addExpressions(tfjsonConfigResource.Expressions)
+	references = append(references, tfjsonConfigResource.DependsOn...)
+
+	var addresses []string
+	for _, reference := range references {
+		segments := splitAddress(reference)
+		switch {
+		case segments[0] == Resource_mode_data && len(segments) >= 3:
+			segments = segments[:3]
+		case containsString([]string{"var", "local", "module", "each", "count", "path", "self", "terraform"}, segments[0]):
+			continue
+		case len(segments) >= 2:
+			segments = segments[:2]
+		default:
+			continue
+		}
+		address := parentAddress + "." + strings.Join(segments, ".")
+		if _, ok := nodeTable[address]; ok && address != parentAddress+"."+tfjsonConfigResource.Address {
+			addresses = appendUnique(addresses, address)
+		}
+	}
+	sort.Strings(addresses)
+	return addresses
+}
+
 func addProviderInfo(nodeTable map[string]Node, tfjsonProviderConfigs map[string]*tfjson.ProviderConfig, parentAdress string) (map[string]Node, error) {
 	for _, tfjsonProviderConfig := range tfjsonProviderConfigs {
 		address := parentAdress + ".provider." + tfjsonProviderConfig.Name
@@ -0,0 +1,49 @@
+package preprocessor
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePlanFileWithMovedAndImportedResources(t *testing.T) {
+	nodeTable := parseTestPlan(t, "moved_plan.json")
+
+	if _, ok := nodeTable[RootAddress+".aws_vpc.old"]; ok {
+		t.Errorf("the previous address of the moved resource is still in the node table")
+	}
+	vpc, ok := nodeTable[RootAddress+".aws_vpc.main"].(*Resource)
+	if !ok {
+		t.Fatalf("the moved resource is missing")
+	}
+	if vpc.PreviousAddress != RootAddress+".aws_vpc.old" {
+		t.Errorf("got previous address %s, want %s", vpc.PreviousAddress, RootAddress+".aws_vpc.old")
+	}
+	subnet := nodeTable[RootAddress+".aws_subnet.a"].(*Resource)
+	if !reflect.DeepEqual(subnet.Dependencies, []string{RootAddress + ".aws_vpc.main"}) {
+		t.Errorf("got dependencies %v of the subnet, want the new address of the moved resource", subnet.Dependencies)
+	}
+
+	summary := SummarizePlan(nodeTable)
+	wantMoves := []ResourceMove{{From: "aws_vpc.old", To: "aws_vpc.main"}}
+	if !reflect.DeepEqual(summary.Moves, wantMoves) {
+		t.Errorf("got moves %+v, want %+v", summary.Moves, wantMoves)
+	}
+	wantImports := []ImportBlock{{To: "aws_s3_bucket.logs", ID: "logs"}}
+	if !reflect.DeepEqual(summary.Imports, wantImports) {
+		t.Errorf("got imports %+v, want %+v", summary.Imports, wantImports)
+	}
+}
+
+func TestAddMissingResourceRewritesDependenciesOfMovedInstances(t *testing.T) {
+	nodeTable := newTestPlan(t, map[string][]string{"aws_instance.old[0]": nil, "aws_eip.web": nil})
+	eip := nodeTable[RootAddress+".aws_eip.web"].(*Resource)
+	eip.Dependencies = []string{RootAddress + ".aws_instance.old"}
+
+	_, err := addMissingResource(nodeTable, RootAddress+".aws_instance.web[0]", RootAddress+".aws_instance.old[0]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(eip.Dependencies, []string{RootAddress + ".aws_instance.web"}) {
+		t.Errorf("got dependencies %v, want the new address of the moved resource", eip.Dependencies)
+	}
+}
@@ -0,0 +1,938 @@
+package preprocessor
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Attribute_exposure is the node attribute under which the internet exposure of a resource is stored.
+const Attribute_exposure = "exposure"
+
+// google_default_firewall_priority is the priority of GCP firewall rules which do not set one.
+const google_default_firewall_priority = 1000
+
+// Exposure describes a resource which is reachable from the internet.
+type Exposure struct {
+	Address string `json:"address"`
+	// Ports are the reachable ports like tcp/22, tcp/80-443, udp/all or icmp
+	Ports []string `json:"ports"`
+	// NewPorts are the ports which only the planned state exposes
+	NewPorts []string `json:"newPorts,omitempty"`
+	// Chain contains the addresses of the resources which make the resource reachable, ordered from the
+	// internet towards the resource itself, which is the last element.
+	Chain []string `json:"chain"`
+
+	ports portSet
+}
+
+// ExposureReport contains the resources of a node table which are reachable from the internet.
+type ExposureReport struct {
+	State     string     `json:"state"`
+	Exposures []Exposure `json:"exposures,omitempty"`
+}
+
+// exposureAnalysis holds the indices needed to determine the exposure of the resources in one state.
+type exposureAnalysis struct {
+	nodeTable map[string]Node
+	state     string
+	// byType contains the sorted addresses of the managed resources by their type
+	byType map[string][]string
+	// byIdentifier maps the lower case ids, arns and self links of the resources to their addresses
+	byIdentifier map[string]string
+	exposures    map[string]*Exposure
+}
+
+// controlExposure contains the ports a security group, network ACL or firewall lets in from the internet and
+// the addresses of the resources defining the relevant rules.
+type controlExposure struct {
+	ports portSet
+	chain []string
+}
+
+// AnalyzeExposure determines which aws, azurerm and google resources are reachable from the internet, on which ports
+// and through which chain of resources. It considers public IPs, security groups, network ACLs, network security groups,
+// firewall rules and load balancers. Plans are analyzed in their planned state, and the ports which the current state
+// does not expose yet are reported as new ports. Identifiers of aws resources which are only known after apply are
+// resolved by the configuration references of the resources. The exposures are additionally attached to the resources
+// under the attribute Attribute_exposure.
+func AnalyzeExposure(nodeTable map[string]Node) *ExposureReport {
+	report := &ExposureReport{State: State_current}
+	for _, n := range nodeTable {
+		if resource, ok := n.(*Resource); ok {
+			if _, ok := resource.States[State_planned]; ok {
+				report.State = State_planned
+				break
+			}
+		}
+	}
+
+	report.Exposures = analyzeExposure(nodeTable, report.State)
+	if report.State == State_planned {
+		current := make(map[string]Exposure)
+		for _, exposure := range analyzeExposure(nodeTable, State_current) {
+			current[exposure.Address] = exposure
+		}
+		for idx := range report.Exposures {
+			exposure := &report.Exposures[idx]
+			newPorts := exposure.ports
+			if previous, ok := current[exposure.Address]; ok {
+				newPorts = newPorts.subtract(previous.ports)
+			}
+			exposure.NewPorts = newPorts.strings()
+		}
+	}
+
+	for _, exposure := range report.Exposures {
+		nodeTable[exposure.Address].AddAttribute(Attribute_exposure, exposure)
+	}
+	return report
+}
+
+// NewlyExposed returns the exposures with ports which only the planned state exposes.
+func (report *ExposureReport) NewlyExposed() []Exposure {
+	var exposures []Exposure
+	for _, exposure := range report.Exposures {
+		if len(exposure.NewPorts) > 0 {
+			exposures = append(exposures, exposure)
+		}
+	}
+	return exposures
+}
+
+// Text renders the exposure report as plain text.
+func (report *ExposureReport) Text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d resources are reachable from the internet (%s)\n", len(report.Exposures), report.State)
+	for _, exposure := range report.Exposures {
+		writeExposure(&b, exposure, exposure.Ports)
+	}
+	if report.State == State_planned {
+		newlyExposed := report.NewlyExposed()
+		fmt.Fprintf(&b, "%d resources are newly exposed by the plan\n", len(newlyExposed))
+		for _, exposure := range newlyExposed {
+			writeExposure(&b, exposure, exposure.NewPorts)
+		}
+	}
+	return b.String()
+}
+
+func writeExposure(b *strings.Builder, exposure Exposure, ports []string) {
+	chain := make([]string, len(exposure.Chain))
+	for idx, address := range exposure.Chain {
+		chain[idx] = displayAddress(address)
+	}
+	fmt.Fprintf(b, "  %s: %s\n", displayAddress(exposure.Address), strings.Join(ports, ", "))
+	fmt.Fprintf(b, "    via %s\n", strings.Join(chain, " -> "))
+}
+
+// displayAddress returns the terraform address of a node, prefixed with its stack if it belongs to one.
+func displayAddress(address string) string {
+	if stack := StackOf(address); stack != "" {
+		return stack + ":" + TerraformAddress(address)
+	}
+	return TerraformAddress(address)
+}
+
+// analyzeExposure returns the exposures of the resources in the given state, sorted by address.
+func analyzeExposure(nodeTable map[string]Node, state string) []Exposure {
+	analysis := &exposureAnalysis{
+		nodeTable:    nodeTable,
+		state:        state,
+		byType:       make(map[string][]string),
+		byIdentifier: make(map[string]string),
+		exposures:    make(map[string]*Exposure),
+	}
+	for _, address := range sortedAddresses(nodeTable) {
+		parsed, ok := parseResourceAddress(address)
+		if !ok || parsed.Mode != Resource_mode_managed {
+			continue
+		}
+		attributes := analysis.attributes(address)
+		if attributes == nil {
+			continue
+		}
+		analysis.byType[parsed.Type] = append(analysis.byType[parsed.Type], address)
+		for _, key := range []string{"id", "arn", "self_link"} {
+			if identifier := stringAttribute(attributes, key); identifier != "" {
+				analysis.byIdentifier[strings.ToLower(identifier)] = address
+			}
+		}
+	}
+
+	analysis.analyzeAWS()
+	analysis.analyzeAzure()
+	analysis.analyzeGoogle()
+
+	exposures := make([]Exposure, 0, len(analysis.exposures))
+	for _, exposure := range analysis.exposures {
+		exposure.Ports = exposure.ports.strings()
+		exposures = append(exposures, *exposure)
+	}
+	sort.Slice(exposures, func(i, j int) bool { return exposures[i].Address < exposures[j].Address })
+	return exposures
+}
+
+// attributes returns the attributes of the resource in the analyzed state or nil if it has none.
+func (analysis *exposureAnalysis) attributes(address string) map[string]interface{} {
+	resource, ok := analysis.nodeTable[address].(*Resource)
+	if !ok {
+		return nil
+	}
+	return resource.States[analysis.state]
+}
+
+// resourcesOfType returns the addresses of the resources of the given types.
+func (analysis *exposureAnalysis) resourcesOfType(types ...string) []string {
+	var addresses []string
+	for _, resourceType := range types {
+		addresses = append(addresses, analysis.byType[resourceType]...)
+	}
+	return addresses
+}
+
+// lookup returns the address of the resource with the given id, arn or self link.
+func (analysis *exposureAnalysis) lookup(identifier string) (string, bool) {
+	address, ok := analysis.byIdentifier[strings.ToLower(identifier)]
+	return address, ok && identifier != ""
+}
+
+// key returns the address of the resource with the given id, arn or self link, or the lower case identifier if no
+// resource of the node table has it. Controls and targets are indexed by these keys, so that they can be found by
+// identifiers as well as by configuration references.
+func (analysis *exposureAnalysis) key(identifier string) string {
+	if address, ok := analysis.lookup(identifier); ok {
+		return address
+	}
+	return strings.ToLower(identifier)
+}
+
+// resolve returns the keys of the resources the attribute of the resource identifies. If the attribute is not known
+// before apply, the resources of the given types the resource references in its configuration are returned as well.
+func (analysis *exposureAnalysis) resolve(address string, attribute string, types ...string) []string {
+	identifiers := stringList(analysis.attributes(address)[attribute])
+	keys := make([]string, 0, len(identifiers))
+	for _, identifier := range identifiers {
+		keys = appendUnique(keys, analysis.key(identifier))
+	}
+	if len(keys) == 0 || analysis.isUnknown(address, attribute) {
+		for _, resourceType := range types {
+			keys = appendUnique(keys, referencedResources(analysis.nodeTable, address, Resource_mode_managed, resourceType)...)
+		}
+	}
+	return keys
+}
+
+// resolveOne returns the key of the single resource the attribute of the resource identifies, see resolve.
+func (analysis *exposureAnalysis) resolveOne(address string, attribute string, types ...string) string {
+	if keys := analysis.resolve(address, attribute, types...); len(keys) == 1 {
+		return keys[0]
+	}
+	return ""
+}
+
+// isUnknown reports whether the attribute of the resource or a part of it is only known after apply.
+func (analysis *exposureAnalysis) isUnknown(address string, attribute string) bool {
+	resource, ok := analysis.nodeTable[address].(*Resource)
+	if !ok || analysis.state != State_planned {
+		return false
+	}
+	for _, path := range resource.UnknownAttributes {
+		if path == attribute || strings.HasPrefix(path, attribute+".") || strings.HasPrefix(path, attribute+"[") {
+			return true
+		}
+	}
+	return false
+}
+
+// isResource reports whether the key is the address of a resource rather than an identifier of an unknown resource.
+func (analysis *exposureAnalysis) isResource(key string) bool {
+	_, ok := analysis.nodeTable[key].(*Resource)
+	return ok
+}
+
+// expose records that the resource is reachable on the ports through the chain of resources, which is completed
+// with the resource itself. Multiple exposures of the same resource are merged.
+func (analysis *exposureAnalysis) expose(address string, ports portSet, chain []string) {
+	if ports.isEmpty() {
+		return
+	}
+	exposure, ok := analysis.exposures[address]
+	if !ok {
+		exposure = &Exposure{Address: address, ports: make(portSet)}
+		analysis.exposures[address] = exposure
+	}
+	exposure.ports.addAll(ports)
+	exposure.Chain = append(removeString(appendUnique(exposure.Chain, chain...), address), address)
+}
+
+// controlsExposure returns the union of the ports the controls with the given keys let in and the chains of the
+// controls which let in any port.
+func controlsExposure(controls map[string]*controlExposure, keys []string) (portSet, []string, bool) {
+	ports := make(portSet)
+	var chain []string
+	found := false
+	for _, key := range keys {
+		control, ok := controls[key]
+		if !ok {
+			continue
+		}
+		found = true
+		if !control.ports.isEmpty() {
+			ports.addAll(control.ports)
+			chain = appendUnique(chain, control.chain...)
+		}
+	}
+	return ports, chain, found
+}
+
+func (analysis *exposureAnalysis) analyzeAWS() {
+	groups := analysis.awsSecurityGroups()
+	acls := analysis.awsNetworkACLs()
+
+	elasticIPs := make(map[string][]string)
+	for _, address := range analysis.resourcesOfType("aws_eip") {
+		if instance := analysis.resolveOne(address, "instance", "aws_instance"); instance != "" {
+			elasticIPs[instance] = appendUnique(elasticIPs[instance], address)
+		}
+	}
+	for _, address := range analysis.resourcesOfType("aws_eip_association") {
+		instance := analysis.resolveOne(address, "instance_id", "aws_instance")
+		if instance == "" {
+			continue
+		}
+		if eip := analysis.resolveOne(address, "allocation_id", "aws_eip"); analysis.isResource(eip) {
+			elasticIPs[instance] = appendUnique(elasticIPs[instance], eip)
+		}
+		elasticIPs[instance] = appendUnique(elasticIPs[instance], address)
+	}
+
+	for _, address := range analysis.resourcesOfType("aws_instance") {
+		attributes := analysis.attributes(address)
+		public, _ := attributes["associate_public_ip_address"].(bool)
+		if !public && stringAttribute(attributes, "public_ip") == "" && len(elasticIPs[address]) == 0 {
+			continue
+		}
+		identifiers := append(analysis.resolve(address, "vpc_security_group_ids", awsSecurityGroupTypes...), analysis.resolve(address, "security_groups")...)
+		ports, groupChain, _ := controlsExposure(groups, identifiers)
+		chain := append([]string(nil), elasticIPs[address]...)
+		if acl, ok := acls[analysis.resolveOne(address, "subnet_id", "aws_subnet")]; ok {
+			ports = ports.intersect(acl.ports)
+			chain = appendUnique(chain, acl.chain...)
+		}
+		analysis.expose(address, ports, append(chain, groupChain...))
+	}
+
+	for _, address := range analysis.resourcesOfType("aws_db_instance", "aws_rds_cluster_instance") {
+		attributes := analysis.attributes(address)
+		if public, _ := attributes["publicly_accessible"].(bool); !public {
+			continue
+		}
+		ports, chain, _ := controlsExposure(groups, analysis.resolve(address, "vpc_security_group_ids", awsSecurityGroupTypes...))
+		if port, ok := intAttribute(attributes["port"]); ok && port > 0 {
+			listening := make(portSet)
+			listening.add(Protocol_tcp, port, port)
+			ports = ports.intersect(listening)
+		}
+		analysis.expose(address, ports, chain)
+	}
+
+	analysis.analyzeAWSLoadBalancers(groups)
+	analysis.analyzeAWSClassicLoadBalancers(groups)
+}
+
+// awsSecurityGroupTypes are the resource types of aws security groups.
+var awsSecurityGroupTypes = []string{"aws_security_group", "aws_default_security_group"}
+
+// awsSecurityGroups returns the ports every security group opens to the internet by the address and the lower case
+// name of the group.
+func (analysis *exposureAnalysis) awsSecurityGroups() map[string]*controlExposure {
+	groups := make(map[string]*controlExposure)
+	for _, address := range analysis.resourcesOfType(awsSecurityGroupTypes...) {
+		attributes := analysis.attributes(address)
+		group := &controlExposure{ports: make(portSet), chain: []string{address}}
+		for _, rule := range objectList(attributes["ingress"]) {
+			if hasPublicSource(rule["cidr_blocks"], rule["ipv6_cidr_blocks"]) {
+				group.ports.addAll(awsRulePorts(rule, "protocol"))
+			}
+		}
+		groups[address] = group
+		if name := stringAttribute(attributes, "name"); name != "" {
+			groups[strings.ToLower(name)] = group
+		}
+	}
+
+	addRule := func(address string, rule map[string]interface{}, protocolKey string) {
+		group, ok := groups[analysis.resolveOne(address, "security_group_id", awsSecurityGroupTypes...)]
+		if !ok {
+			return
+		}
+		group.ports.addAll(awsRulePorts(rule, protocolKey))
+		group.chain = appendUnique(group.chain, address)
+	}
+	for _, address := range analysis.resourcesOfType("aws_security_group_rule") {
+		attributes := analysis.attributes(address)
+		if stringAttribute(attributes, "type") == "ingress" && hasPublicSource(attributes["cidr_blocks"], attributes["ipv6_cidr_blocks"]) {
+			addRule(address, attributes, "protocol")
+		}
+	}
+	for _, address := range analysis.resourcesOfType("aws_vpc_security_group_ingress_rule") {
+		attributes := analysis.attributes(address)
+		if hasPublicSource(attributes["cidr_ipv4"], attributes["cidr_ipv6"]) {
+			addRule(address, attributes, "ip_protocol")
+		}
+	}
+	return groups
+}
+
+// awsNetworkACLs returns the ports the network ACLs let in from the internet by the keys of the associated subnets.
+// Rules for other sources than the internet are ignored.
+func (analysis *exposureAnalysis) awsNetworkACLs() map[string]*controlExposure {
+	type networkACL struct {
+		address string
+		rules   []orderedRule
+		subnets []string
+	}
+	acls := make(map[string]*networkACL)
+	var ordered []*networkACL
+	for _, address := range analysis.resourcesOfType("aws_network_acl", "aws_default_network_acl") {
+		attributes := analysis.attributes(address)
+		acl := &networkACL{address: address, subnets: analysis.resolve(address, "subnet_ids", "aws_subnet")}
+		for _, rule := range objectList(attributes["ingress"]) {
+			if parsed, ok := awsNetworkACLRule(rule, "rule_no", "action", address); ok {
+				acl.rules = append(acl.rules, parsed)
+			}
+		}
+		acls[address] = acl
+		ordered = append(ordered, acl)
+	}
+	for _, address := range analysis.resourcesOfType("aws_network_acl_rule") {
+		attributes := analysis.attributes(address)
+		acl, ok := acls[analysis.resolveOne(address, "network_acl_id", "aws_network_acl", "aws_default_network_acl")]
+		if egress, _ := attributes["egress"].(bool); !ok || egress {
+			continue
+		}
+		if parsed, ok := awsNetworkACLRule(attributes, "rule_number", "rule_action", address); ok {
+			acl.rules = append(acl.rules, parsed)
+		}
+	}
+	for _, address := range analysis.resourcesOfType("aws_network_acl_association") {
+		if acl, ok := acls[analysis.resolveOne(address, "network_acl_id", "aws_network_acl", "aws_default_network_acl")]; ok {
+			acl.subnets = appendUnique(acl.subnets, analysis.resolveOne(address, "subnet_id", "aws_subnet"))
+		}
+	}
+
+	subnets := make(map[string]*controlExposure)
+	for _, acl := range ordered {
+		ports, rules := evaluateOrderedRules(acl.rules)
+		control := &controlExposure{ports: ports, chain: appendUnique([]string{acl.address}, rules...)}
+		for _, subnet := range acl.subnets {
+			subnets[subnet] = control
+		}
+	}
+	return subnets
+}
+
+// awsNetworkACLRule converts a network ACL entry whose source is the internet to an ordered rule.
+func awsNetworkACLRule(rule map[string]interface{}, numberKey string, actionKey string, address string) (orderedRule, bool) {
+	if !hasPublicSource(rule["cidr_block"], rule["ipv6_cidr_block"]) {
+		return orderedRule{}, false
+	}
+	number, ok := intAttribute(rule[numberKey])
+	if !ok {
+		return orderedRule{}, false
+	}
+	return orderedRule{
+		priority: number,
+		allow:    stringAttribute(rule, actionKey) == "allow",
+		ports:    awsRulePorts(rule, "protocol"),
+		address:  address,
+	}, true
+}
+
+// awsRulePorts returns the ports of a security group or network ACL rule. The protocol -1 covers all ports.
+func awsRulePorts(rule map[string]interface{}, protocolKey string) portSet {
+	protocol := textAttribute(rule[protocolKey])
+	ports := make(portSet)
+	if len(protocolsOf(protocol)) == len(allProtocols) {
+		return allPorts()
+	}
+	from, ok := intAttribute(rule["from_port"])
+	to, ok2 := intAttribute(rule["to_port"])
+	if !ok || !ok2 {
+		from, to = 0, port_max
+	}
+	ports.addProtocol(protocol, from, to)
+	return ports
+}
+
+// analyzeAWSLoadBalancers exposes internet facing application and network load balancers and the targets
+// of their listeners.
+func (analysis *exposureAnalysis) analyzeAWSLoadBalancers(groups map[string]*controlExposure) {
+	listeners := make(map[string][]string)
+	for _, address := range analysis.resourcesOfType("aws_lb_listener", "aws_alb_listener") {
+		loadBalancer := analysis.resolveOne(address, "load_balancer_arn", "aws_lb", "aws_alb")
+		listeners[loadBalancer] = append(listeners[loadBalancer], address)
+	}
+	attachments := make(map[string][]string)
+	for _, address := range analysis.resourcesOfType("aws_lb_target_group_attachment", "aws_alb_target_group_attachment") {
+		targetGroup := analysis.resolveOne(address, "target_group_arn", awsTargetGroupTypes...)
+		attachments[targetGroup] = append(attachments[targetGroup], address)
+	}
+
+	for _, address := range analysis.resourcesOfType("aws_lb", "aws_alb") {
+		attributes := analysis.attributes(address)
+		if internal, _ := attributes["internal"].(bool); internal {
+			continue
+		}
+		securityGroups := analysis.resolve(address, "security_groups", awsSecurityGroupTypes...)
+		allowed, groupChain, _ := controlsExposure(groups, securityGroups)
+		if len(securityGroups) == 0 {
+			allowed = allPorts()
+		}
+
+		lbListeners := listeners[address]
+		if len(lbListeners) == 0 && len(securityGroups) > 0 {
+			analysis.expose(address, allowed, groupChain)
+		}
+		for _, listener := range lbListeners {
+			listenerAttributes := analysis.attributes(listener)
+			ports := make(portSet)
+			if port, ok := intAttribute(listenerAttributes["port"]); ok {
+				ports.addProtocol(protocolOrTCP(stringAttribute(listenerAttributes, "protocol")), port, port)
+			}
+			ports = ports.intersect(allowed)
+			if ports.isEmpty() {
+				continue
+			}
+			analysis.expose(address, ports, append(append([]string(nil), groupChain...), listener))
+
+			for _, targetGroupKey := range analysis.listenerTargetGroups(listener) {
+				targetGroup := ""
+				if analysis.isResource(targetGroupKey) {
+					targetGroup = targetGroupKey
+				}
+				for _, attachment := range attachments[targetGroupKey] {
+					attachmentAttributes := analysis.attributes(attachment)
+					target := analysis.resolveOne(attachment, "target_id", "aws_instance")
+					if !analysis.isResource(target) {
+						continue
+					}
+					targetPorts := ports
+					port, ok := intAttribute(attachmentAttributes["port"])
+					if !ok && targetGroup != "" {
+						port, ok = intAttribute(analysis.attributes(targetGroup)["port"])
+					}
+					if ok && port > 0 {
+						targetPorts = make(portSet)
+						targetPorts.add(Protocol_tcp, port, port)
+					}
+					chain := append(append([]string(nil), groupChain...), address, listener, targetGroup, attachment)
+					analysis.expose(target, targetPorts, chain)
+				}
+			}
+		}
+	}
+}
+
+// awsTargetGroupTypes are the resource types of aws load balancer target groups.
+var awsTargetGroupTypes = []string{"aws_lb_target_group", "aws_alb_target_group"}
+
+// listenerTargetGroups returns the keys of the target groups the default actions of a listener forward to. If their
+// arns are not known before apply, the target groups the listener references in its configuration are returned.
+func (analysis *exposureAnalysis) listenerTargetGroups(listener string) []string {
+	var keys []string
+	for _, action := range objectList(analysis.attributes(listener)["default_action"]) {
+		arns := []string{stringAttribute(action, "target_group_arn")}
+		for _, forward := range objectList(action["forward"]) {
+			for _, targetGroup := range objectList(forward["target_group"]) {
+				arns = append(arns, stringAttribute(targetGroup, "arn"))
+			}
+		}
+		for _, arn := range arns {
+			if arn != "" {
+				keys = appendUnique(keys, analysis.key(arn))
+			}
+		}
+	}
+	if len(keys) == 0 || analysis.isUnknown(listener, "default_action") {
+		for _, resourceType := range awsTargetGroupTypes {
+			keys = appendUnique(keys, referencedResources(analysis.nodeTable, listener, Resource_mode_managed, resourceType)...)
+		}
+	}
+	return keys
+}
+
+// analyzeAWSClassicLoadBalancers exposes internet facing classic load balancers and their instances.
+func (analysis *exposureAnalysis) analyzeAWSClassicLoadBalancers(groups map[string]*controlExposure) {
+	for _, address := range analysis.resourcesOfType("aws_elb") {
+		attributes := analysis.attributes(address)
+		if internal, _ := attributes["internal"].(bool); internal {
+			continue
+		}
+		securityGroups := analysis.resolve(address, "security_groups", awsSecurityGroupTypes...)
+		allowed, groupChain, _ := controlsExposure(groups, securityGroups)
+		if len(securityGroups) == 0 {
+			allowed = allPorts()
+		}
+
+		ports := make(portSet)
+		instancePorts := make(portSet)
+		for _, listener := range objectList(attributes["listener"]) {
+			port, ok := intAttribute(listener["lb_port"])
+			if !ok {
+				continue
+			}
+			listenerPorts := make(portSet)
+			listenerPorts.addProtocol(protocolOrTCP(stringAttribute(listener, "lb_protocol")), port, port)
+			if listenerPorts = listenerPorts.intersect(allowed); listenerPorts.isEmpty() {
+				continue
+			}
+			ports.addAll(listenerPorts)
+			if instancePort, ok := intAttribute(listener["instance_port"]); ok {
+				instancePorts.addProtocol(protocolOrTCP(stringAttribute(listener, "instance_protocol")), instancePort, instancePort)
+			}
+		}
+		analysis.expose(address, ports, groupChain)
+		if ports.isEmpty() {
+			continue
+		}
+		for _, target := range analysis.resolve(address, "instances", "aws_instance") {
+			if analysis.isResource(target) {
+				analysis.expose(target, instancePorts, append(append([]string(nil), groupChain...), address))
+			}
+		}
+	}
+}
+
+func (analysis *exposureAnalysis) analyzeAzure() {
+	publicIPs := make(map[string]string)
+	for _, address := range analysis.resourcesOfType("azurerm_public_ip") {
+		publicIPs[strings.ToLower(stringAttribute(analysis.attributes(address), "id"))] = address
+	}
+	securityGroups := analysis.azureSecurityGroups()
+
+	interfaceGroups := make(map[string][]string)
+	for _, address := range analysis.resourcesOfType("azurerm_network_interface_security_group_association") {
+		attributes := analysis.attributes(address)
+		nic := strings.ToLower(stringAttribute(attributes, "network_interface_id"))
+		interfaceGroups[nic] = append(interfaceGroups[nic], strings.ToLower(stringAttribute(attributes, "network_security_group_id")))
+	}
+	subnetGroups := make(map[string][]string)
+	for _, address := range analysis.resourcesOfType("azurerm_subnet_network_security_group_association") {
+		attributes := analysis.attributes(address)
+		subnet := strings.ToLower(stringAttribute(attributes, "subnet_id"))
+		subnetGroups[subnet] = append(subnetGroups[subnet], strings.ToLower(stringAttribute(attributes, "network_security_group_id")))
+	}
+	machines := make(map[string][]string)
+	for _, address := range analysis.resourcesOfType("azurerm_linux_virtual_machine", "azurerm_windows_virtual_machine", "azurerm_virtual_machine") {
+		for _, nic := range stringList(analysis.attributes(address)["network_interface_ids"]) {
+			machines[strings.ToLower(nic)] = append(machines[strings.ToLower(nic)], address)
+		}
+	}
+
+	for _, address := range analysis.resourcesOfType("azurerm_network_interface") {
+		attributes := analysis.attributes(address)
+		id := strings.ToLower(stringAttribute(attributes, "id"))
+		for _, configuration := range objectList(attributes["ip_configuration"]) {
+			publicIP, ok := publicIPs[strings.ToLower(stringAttribute(configuration, "public_ip_address_id"))]
+			if !ok {
+				continue
+			}
+			// Without network security groups azure lets in all traffic, with groups on the interface and the subnet
+			// the traffic has to pass both.
+			ports := allPorts()
+			chain := []string{publicIP}
+			subnet := strings.ToLower(stringAttribute(configuration, "subnet_id"))
+			for _, groupIDs := range [][]string{subnetGroups[subnet], interfaceGroups[id]} {
+				if groupPorts, groupChain, found := controlsExposure(securityGroups, groupIDs); found {
+					ports = ports.intersect(groupPorts)
+					chain = appendUnique(chain, groupChain...)
+				}
+			}
+			if len(machines[id]) == 0 {
+				analysis.expose(address, ports, chain)
+			}
+			for _, machine := range machines[id] {
+				analysis.expose(machine, ports, append(append([]string(nil), chain...), address))
+			}
+		}
+	}
+
+	rules := make(map[string][]string)
+	for _, address := range analysis.resourcesOfType("azurerm_lb_rule", "azurerm_lb_nat_rule") {
+		loadBalancer := strings.ToLower(stringAttribute(analysis.attributes(address), "loadbalancer_id"))
+		rules[loadBalancer] = append(rules[loadBalancer], address)
+	}
+	for _, address := range analysis.resourcesOfType("azurerm_lb") {
+		attributes := analysis.attributes(address)
+		var chain []string
+		for _, frontend := range objectList(attributes["frontend_ip_configuration"]) {
+			if publicIP, ok := publicIPs[strings.ToLower(stringAttribute(frontend, "public_ip_address_id"))]; ok {
+				chain = appendUnique(chain, publicIP)
+			}
+		}
+		if len(chain) == 0 {
+			continue
+		}
+		ports := make(portSet)
+		for _, rule := range rules[strings.ToLower(stringAttribute(attributes, "id"))] {
+			ruleAttributes := analysis.attributes(rule)
+			if port, ok := intAttribute(ruleAttributes["frontend_port"]); ok {
+				ports.addProtocol(stringAttribute(ruleAttributes, "protocol"), port, port)
+				chain = appendUnique(chain, rule)
+			}
+		}
+		analysis.expose(address, ports, chain)
+	}
+}
+
+// azureSecurityGroups returns the ports every network security group lets in from the internet by the lower case id of the group.
+func (analysis *exposureAnalysis) azureSecurityGroups() map[string]*controlExposure {
+	type securityGroup struct {
+		address string
+		id      string
+		rules   []orderedRule
+	}
+	var groups []*securityGroup
+	byName := make(map[string]*securityGroup)
+	for _, address := range analysis.resourcesOfType("azurerm_network_security_group") {
+		attributes := analysis.attributes(address)
+		group := &securityGroup{address: address, id: stringAttribute(attributes, "id")}
+		for _, rule := range objectList(attributes["security_rule"]) {
+			if parsed, ok := azureSecurityRule(rule, address); ok {
+				group.rules = append(group.rules, parsed)
+			}
+		}
+		groups = append(groups, group)
+		byName[strings.ToLower(stringAttribute(attributes, "resource_group_name")+"/"+stringAttribute(attributes, "name"))] = group
+	}
+	for _, address := range analysis.resourcesOfType("azurerm_network_security_rule") {
+		attributes := analysis.attributes(address)
+		group, ok := byName[strings.ToLower(stringAttribute(attributes, "resource_group_name")+"/"+stringAttribute(attributes, "network_security_group_name"))]
+		if !ok {
+			continue
+		}
+		if parsed, ok := azureSecurityRule(attributes, address); ok {
+			group.rules = append(group.rules, parsed)
+		}
+	}
+
+	controls := make(map[string]*controlExposure)
+	for _, group := range groups {
+		ports, rules := evaluateOrderedRules(group.rules)
+		controls[strings.ToLower(group.id)] = &controlExposure{ports: ports, chain: appendUnique([]string{group.address}, rules...)}
+	}
+	return controls
+}
+
+// azureSecurityRule converts an inbound security rule whose source is the internet to an ordered rule.
+func azureSecurityRule(rule map[string]interface{}, address string) (orderedRule, bool) {
+	if !strings.EqualFold(stringAttribute(rule, "direction"), "Inbound") ||
+		!hasPublicSource(rule["source_address_prefix"], rule["source_address_prefixes"]) {
+		return orderedRule{}, false
+	}
+	priority, ok := intAttribute(rule["priority"])
+	if !ok {
+		return orderedRule{}, false
+	}
+	ports := make(portSet)
+	ranges := append(stringList(rule["destination_port_range"]), stringList(rule["destination_port_ranges"])...)
+	if len(ranges) == 0 {
+		ranges = []string{"*"}
+	}
+	for _, portRange := range ranges {
+		if from, to, ok := parsePortRange(portRange); ok {
+			ports.addProtocol(stringAttribute(rule, "protocol"), from, to)
+		}
+	}
+	return orderedRule{
+		priority: priority,
+		allow:    strings.EqualFold(stringAttribute(rule, "access"), "Allow"),
+		ports:    ports,
+		address:  address,
+	}, true
+}
+
+func (analysis *exposureAnalysis) analyzeGoogle() {
+	type firewall struct {
+		network string
+		tags    []string
+		rules   []orderedRule
+	}
+	var firewalls []firewall
+	for _, address := range analysis.resourcesOfType("google_compute_firewall") {
+		attributes := analysis.attributes(address)
+		direction := stringAttribute(attributes, "direction")
+		disabled, _ := attributes["disabled"].(bool)
+		if disabled || (direction != "" && direction != "INGRESS") || !hasPublicSource(attributes["source_ranges"]) ||
+			len(stringList(attributes["target_service_accounts"])) > 0 {
+			continue
+		}
+		priority, ok := intAttribute(attributes["priority"])
+		if !ok {
+			priority = google_default_firewall_priority
+		}
+		current := firewall{network: googleResourceName(stringAttribute(attributes, "network")), tags: stringList(attributes["target_tags"])}
+		for _, key := range []string{"allow", "deny"} {
+			for _, block := range objectList(attributes[key]) {
+				rule := orderedRule{priority: priority, allow: key == "allow", ports: make(portSet), address: address}
+				ranges := stringList(block["ports"])
+				if len(ranges) == 0 {
+					ranges = []string{""}
+				}
+				for _, portRange := range ranges {
+					if from, to, ok := parsePortRange(portRange); ok {
+						rule.ports.addProtocol(stringAttribute(block, "protocol"), from, to)
+					}
+				}
+				current.rules = append(current.rules, rule)
+			}
+		}
+		firewalls = append(firewalls, current)
+	}
+
+	for _, address := range analysis.resourcesOfType("google_compute_instance") {
+		attributes := analysis.attributes(address)
+		public := false
+		for _, networkInterface := range objectList(attributes["network_interface"]) {
+			if len(objectList(networkInterface["access_config"])) > 0 {
+				public = true
+			}
+		}
+		if !public {
+			continue
+		}
+		network := googleResourceName(firstStringAttribute(attributes, "network_interface.network"))
+		tags := stringList(attributes["tags"])
+		var rules []orderedRule
+		for _, current := range firewalls {
+			if current.network == network && (len(current.tags) == 0 || containsString(current.tags, tags...)) {
+				rules = append(rules, current.rules...)
+			}
+		}
+		ports, chain := evaluateOrderedRules(rules)
+		analysis.expose(address, ports, chain)
+	}
+
+	for _, address := range analysis.resourcesOfType("google_compute_forwarding_rule", "google_compute_global_forwarding_rule") {
+		attributes := analysis.attributes(address)
+		scheme := stringAttribute(attributes, "load_balancing_scheme")
+		if scheme != "" && scheme != "EXTERNAL" && scheme != "EXTERNAL_MANAGED" {
+			continue
+		}
+		protocol := protocolOrTCP(stringAttribute(attributes, "ip_protocol"))
+		ports := make(portSet)
+		if allPortsEnabled, _ := attributes["all_ports"].(bool); allPortsEnabled {
+			ports.addProtocol(protocol, 0, port_max)
+		}
+		for _, portRange := range append(stringList(attributes["port_range"]), stringList(attributes["ports"])...) {
+			if from, to, ok := parsePortRange(portRange); ok {
+				ports.addProtocol(protocol, from, to)
+			}
+		}
+		analysis.expose(address, ports, nil)
+		if target, ok := analysis.lookup(stringAttribute(attributes, "target")); ok {
+			analysis.expose(target, ports, []string{address})
+		}
+	}
+}
+
+// googleResourceName returns the last segment of a self link or resource path, so that networks given by name and by self link match.
+func googleResourceName(selfLink string) string {
+	return selfLink[strings.LastIndex(selfLink, "/")+1:]
+}
+
+// protocolOrTCP returns the protocol or tcp if it is not set, which is the default of load balancers and forwarding rules.
+func protocolOrTCP(protocol string) string {
+	if protocol == "" {
+		return Protocol_tcp
+	}
+	return protocol
+}
+
+// isPublicSource reports whether the source of a rule stands for the whole internet.
+func isPublicSource(source string) bool {
+	switch strings.ToLower(strings.TrimSpace(source)) {
+	case "0.0.0.0/0", "::/0", "*", "internet", "any":
+		return true
+	}
+	return false
+}
+
+// hasPublicSource reports whether one of the values, strings or lists of strings, is a public source.
+func hasPublicSource(values ...interface{}) bool {
+	for _, value := range values {
+		for _, source := range stringList(value) {
+			if isPublicSource(source) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// stringList returns the non empty strings of a string or list attribute.
+func stringList(value interface{}) []string {
+	var list []string
+	switch casted := value.(type) {
+	case string:
+		if casted != "" {
+			list = append(list, casted)
+		}
+	case []interface{}:
+		for _, element := range casted {
+			if text, ok := element.(string); ok && text != "" {
+				list = append(list, text)
+			}
+		}
+	}
+	return list
+}
+
+// objectList returns the objects of a list of nested blocks.
+func objectList(value interface{}) []map[string]interface{} {
+	var objects []map[string]interface{}
+	list, _ := value.([]interface{})
+	for _, element := range list {
+		if object, ok := element.(map[string]interface{}); ok {
+			objects = append(objects, object)
+		}
+	}
+	return objects
+}
+
+// intAttribute returns a number or numeric string attribute as an integer.
+func intAttribute(value interface{}) (int, bool) {
+	switch casted := value.(type) {
+	case float64:
+		return int(casted), true
+	case string:
+		number, err := strconv.Atoi(casted)
+		return number, err == nil
+	}
+	return 0, false
+}
+
+// textAttribute returns a string or number attribute as text.
+func textAttribute(value interface{}) string {
+	switch casted := value.(type) {
+	case string:
+		return casted
+	case float64:
+		return strconv.FormatFloat(casted, 'f', -1, 64)
+	}
+	return ""
+}
+
+// removeString returns the list without the value.
+func removeString(list []string, value string) []string {
+	var result []string
+	for _, element := range list {
+		if element != value {
+			result = append(result, element)
+		}
+	}
+	return result
+}
@@ -0,0 +1,76 @@
+package preprocessor
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAnalyzeExposure(t *testing.T) {
+	nodeTable := map[string]Node{}
+	add := func(address string, current map[string]interface{}, planned map[string]interface{}) {
+		resource, _ := NewResource(RootAddress+"."+address, nil)
+		resource.addState(State_current, current)
+		resource.addState(State_planned, planned)
+		nodeTable[resource.Address] = resource
+	}
+	ingress := func(from float64, to float64) map[string]interface{} {
+		return map[string]interface{}{"protocol": "tcp", "from_port": from, "to_port": to, "cidr_blocks": []interface{}{"0.0.0.0/0"}}
+	}
+	add("aws_security_group.web",
+		map[string]interface{}{"id": "sg-1", "name": "web", "ingress": []interface{}{ingress(443, 443)}},
+		map[string]interface{}{"id": "sg-1", "name": "web", "ingress": []interface{}{ingress(443, 443), ingress(22, 22)}})
+	add("aws_security_group.internal",
+		map[string]interface{}{"id": "sg-2", "name": "internal", "ingress": []interface{}{
+			map[string]interface{}{"protocol": "-1", "from_port": 0.0, "to_port": 0.0, "cidr_blocks": []interface{}{"10.0.0.0/8"}},
+		}},
+		map[string]interface{}{"id": "sg-2", "name": "internal"})
+	instance := map[string]interface{}{"id": "i-1", "public_ip": "1.2.3.4", "vpc_security_group_ids": []interface{}{"sg-1", "sg-2"}}
+	add("aws_instance.web", instance, instance)
+	private := map[string]interface{}{"id": "i-2", "vpc_security_group_ids": []interface{}{"sg-1"}}
+	add("aws_instance.worker", private, private)
+
+	report := AnalyzeExposure(nodeTable)
+	want := []Exposure{{
+		Address:  RootAddress + ".aws_instance.web",
+		Ports:    []string{"tcp/22", "tcp/443"},
+		NewPorts: []string{"tcp/22"},
+		Chain:    []string{RootAddress + ".aws_security_group.web", RootAddress + ".aws_instance.web"},
+	}}
+	if report.State != State_planned {
+		t.Errorf("got state %s, want the planned state", report.State)
+	}
+	if len(report.Exposures) != len(want) {
+		t.Fatalf("got exposures %+v, want %+v", report.Exposures, want)
+	}
+	got := report.Exposures[0]
+	got.ports = nil
+	if !reflect.DeepEqual(got, want[0]) {
+		t.Errorf("got exposure %+v, want %+v", got, want[0])
+	}
+	if _, ok := nodeTable[RootAddress+".aws_instance.web"].GetAttributes()[Attribute_exposure]; !ok {
+		t.Errorf("the exposure is not attached to the instance")
+	}
+}
+
+func TestAnalyzeExposureOfPlanResolvesUnknownIdentifiersByReferences(t *testing.T) {
+	nodeTable := parseTestPlan(t, "exposure_plan.json")
+	report := AnalyzeExposure(nodeTable)
+
+	web := RootAddress + ".aws_instance.web"
+	var newlyExposed []Exposure
+	for _, exposure := range report.Exposures {
+		if len(exposure.NewPorts) > 0 {
+			exposure.ports = nil
+			newlyExposed = append(newlyExposed, exposure)
+		}
+	}
+	want := []Exposure{{
+		Address:  web,
+		Ports:    []string{"tcp/22"},
+		NewPorts: []string{"tcp/22"},
+		Chain:    []string{RootAddress + ".aws_security_group.ssh", web},
+	}}
+	if !reflect.DeepEqual(newlyExposed, want) {
+		t.Errorf("got newly exposed resources %+v, want %+v", newlyExposed, want)
+	}
+}
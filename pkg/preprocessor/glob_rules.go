@@ -0,0 +1,49 @@
+package preprocessor
+
+import (
+	"regexp"
+)
+
+// globRule is a rule of a registry which applies to the resource types matched by the glob of its pattern.
+type globRule interface {
+	rulePattern() string
+}
+
+// globRules is the list of rules of a registry with their compiled globs.
+type globRules[T globRule] struct {
+	rules []T
+	globs []*regexp.Regexp
+}
+
+// prepend adds the rules in front of the list, so that they take precedence over the rules which were added before.
+func (list *globRules[T]) prepend(rules []T) {
+	globs := make([]*regexp.Regexp, 0, len(rules))
+	for _, rule := range rules {
+		globs = append(globs, compileGlob(rule.rulePattern()))
+	}
+	list.rules = append(append([]T(nil), rules...), list.rules...)
+	list.globs = append(globs, list.globs...)
+}
+
+// matching returns the rules whose glob matches the resource type, in the order of their precedence.
+func (list *globRules[T]) matching(resourceType string) []T {
+	var matching []T
+	for idx, glob := range list.globs {
+		if glob.MatchString(resourceType) {
+			matching = append(matching, list.rules[idx])
+		}
+	}
+	return matching
+}
+
+func (rule ClassificationRule) rulePattern() string {
+	return rule.Pattern
+}
+
+func (rule ConsoleLinkRule) rulePattern() string {
+	return rule.Pattern
+}
+
+func (rule ImportIDRule) rulePattern() string {
+	return rule.Pattern
+}
@@ -0,0 +1,189 @@
+package preprocessor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	Guardrail_rule_delete           = "deny_delete"
+	Guardrail_rule_replace          = "deny_replace"
+	Guardrail_rule_max_changes      = "max_changes"
+	Guardrail_rule_protected_module = "protected_module"
+)
+
+// GuardrailConfig configures the guardrails a plan is checked against. Patterns are globs
+// with the wildcards * and ? which are matched against terraform addresses, e.g.
+//
+//	{
+//	  "denyDelete": ["*aws_db_instance.*", "module.data.*"],
+//	  "denyReplace": ["*aws_eks_cluster.*"],
+//	  "maxChanges": 50,
+//	  "protectedModules": ["module.iam"]
+//	}
+type GuardrailConfig struct {
+	// DenyDelete contains the patterns of resources which must not be deleted
+	DenyDelete []string `json:"denyDelete,omitempty"`
+	// DenyReplace contains the patterns of resources which must not be replaced
+	DenyReplace []string `json:"denyReplace,omitempty"`
+	// MaxChanges is the maximum number of resources which may be created, updated, replaced or deleted. Zero disables the limit.
+	MaxChanges int `json:"maxChanges,omitempty"`
+	// ProtectedModules contains the patterns of modules in which no resource may be changed. Nested modules are protected as well.
+	ProtectedModules []string `json:"protectedModules,omitempty"`
+}
+
+// GuardrailViolation describes a single violated guardrail.
+type GuardrailViolation struct {
+	Rule    string `json:"rule"`
+	Address string `json:"address,omitempty"`
+	Pattern string `json:"pattern,omitempty"`
+	Message string `json:"message"`
+}
+
+// GuardrailResult contains the outcome of checking a plan against guardrails.
+type GuardrailResult struct {
+	Passed     bool                 `json:"passed"`
+	Changes    int                  `json:"changes"`
+	Violations []GuardrailViolation `json:"violations,omitempty"`
+}
+
+// ParseGuardrailConfig takes a json formatted guardrail config and validates it.
+func ParseGuardrailConfig(data []byte) (*GuardrailConfig, error) {
+	config := new(GuardrailConfig)
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(config)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't parse the given guardrail config: %s", err.Error())
+	}
+	if config.MaxChanges < 0 {
+		return nil, fmt.Errorf("maxChanges must not be negative")
+	}
+	return config, nil
+}
+
+// isChanged reports whether the resource is created, updated, replaced or deleted.
+func isChanged(resource *Resource) bool {
+	switch summaryAction(resource) {
+	case Action_create, Action_update, Action_replace, Action_delete:
+		return true
+	default:
+		return false
+	}
+}
+
+// matchingPattern returns the first pattern that matches the value.
+func matchingPattern(value string, patterns []string, globs []*regexp.Regexp) (string, bool) {
+	for idx, glob := range globs {
+		if glob.MatchString(value) {
+			return patterns[idx], true
+		}
+	}
+	return "", false
+}
+
+func compileGlobs(patterns []string) []*regexp.Regexp {
+	globs := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		globs = append(globs, compileGlob(pattern))
+	}
+	return globs
+}
+
+// moduleAncestors returns the module path and the paths of all modules enclosing it,
+// e.g. module.a.module.b and module.a for module.a.module.b.
+func moduleAncestors(module string) []string {
+	segments := splitAddress(module)
+	var ancestors []string
+	for end := len(segments); end >= 2; end -= 2 {
+		ancestors = append(ancestors, strings.Join(segments[:end], "."))
+	}
+	return ancestors
+}
+
+// CheckGuardrails checks the changes of a plan node table against the given guardrails.
+func CheckGuardrails(nodeTable map[string]Node, config *GuardrailConfig) *GuardrailResult {
+	result := &GuardrailResult{}
+	denyDelete := compileGlobs(config.DenyDelete)
+	denyReplace := compileGlobs(config.DenyReplace)
+	protectedModules := compileGlobs(config.ProtectedModules)
+
+	for _, address := range sortedAddresses(nodeTable) {
+		resource, ok := nodeTable[address].(*Resource)
+		if !ok || !isChanged(resource) {
+			continue
+		}
+		result.Changes++
+		terraformAddress := TerraformAddress(address)
+
+		switch summaryAction(resource) {
+		case Action_delete:
+			if pattern, ok := matchingPattern(terraformAddress, config.DenyDelete, denyDelete); ok {
+				result.Violations = append(result.Violations, GuardrailViolation{
+					Rule:    Guardrail_rule_delete,
+					Address: terraformAddress,
+					Pattern: pattern,
+					Message: fmt.Sprintf("%s is deleted but matches the protected pattern '%s'", terraformAddress, pattern),
+				})
+			}
+		case Action_replace:
+			// a replacement destroys the object as well, so deletion guardrails apply to it too
+			if pattern, ok := matchingPattern(terraformAddress, config.DenyDelete, denyDelete); ok {
+				result.Violations = append(result.Violations, GuardrailViolation{
+					Rule:    Guardrail_rule_delete,
+					Address: terraformAddress,
+					Pattern: pattern,
+					Message: fmt.Sprintf("%s is replaced, which deletes it, but matches the protected pattern '%s'", terraformAddress, pattern),
+				})
+			}
+			if pattern, ok := matchingPattern(terraformAddress, config.DenyReplace, denyReplace); ok {
+				result.Violations = append(result.Violations, GuardrailViolation{
+					Rule:    Guardrail_rule_replace,
+					Address: terraformAddress,
+					Pattern: pattern,
+					Message: fmt.Sprintf("%s is replaced but matches the protected pattern '%s'", terraformAddress, pattern),
+				})
+			}
+		}
+
+		parsed, _ := parseResourceAddress(address)
+		for _, module := range moduleAncestors(parsed.Module) {
+			if pattern, ok := matchingPattern(module, config.ProtectedModules, protectedModules); ok {
+				result.Violations = append(result.Violations, GuardrailViolation{
+					Rule:    Guardrail_rule_protected_module,
+					Address: terraformAddress,
+					Pattern: pattern,
+					Message: fmt.Sprintf("%s is changed (%s) but lies in the protected module '%s'", terraformAddress, summaryAction(resource), module),
+				})
+				break
+			}
+		}
+	}
+
+	if config.MaxChanges > 0 && result.Changes > config.MaxChanges {
+		result.Violations = append(result.Violations, GuardrailViolation{
+			Rule:    Guardrail_rule_max_changes,
+			Message: fmt.Sprintf("the plan changes %d resources but at most %d changes are allowed", result.Changes, config.MaxChanges),
+		})
+	}
+
+	result.Passed = len(result.Violations) == 0
+	return result
+}
+
+// Text renders the result of a guardrail check as plain text.
+func (result *GuardrailResult) Text() string {
+	var b strings.Builder
+	if result.Passed {
+		fmt.Fprintf(&b, "PASSED: %d changes, no guardrail violated\n", result.Changes)
+		return b.String()
+	}
+	fmt.Fprintf(&b, "FAILED: %d changes, %d guardrail violations\n", result.Changes, len(result.Violations))
+	for _, violation := range result.Violations {
+		fmt.Fprintf(&b, "  [%s] %s\n", violation.Rule, violation.Message)
+	}
+	return b.String()
+}
@@ -0,0 +1,93 @@
+package preprocessor
+
+import (
+	"testing"
+)
+
+// newTestPlan returns a plan node table with a resource for every address and its actions.
+func newTestPlan(t *testing.T, actions map[string][]string) map[string]Node {
+	t.Helper()
+	nodeTable := map[string]Node{}
+	root, _ := NewModule(RootAddress, nil)
+	nodeTable[RootAddress] = root
+	for address, resourceActions := range actions {
+		resource, err := addMissingResource(nodeTable, RootAddress+"."+address, "")
+		if err != nil {
+			t.Fatalf("could not add resource %s: %s", address, err)
+		}
+		for _, action := range resourceActions {
+			resource.addAction(action)
+		}
+	}
+	return nodeTable
+}
+
+func TestCheckGuardrails(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     GuardrailConfig
+		actions    map[string][]string
+		violations []string
+	}{
+		{
+			name:       "deleted protected resource",
+			config:     GuardrailConfig{DenyDelete: []string{"aws_instance.*"}},
+			actions:    map[string][]string{"aws_instance.web": {Action_delete}},
+			violations: []string{Guardrail_rule_delete},
+		},
+		{
+			name:       "replaced resource protected from deletion",
+			config:     GuardrailConfig{DenyDelete: []string{"aws_instance.*"}},
+			actions:    map[string][]string{"aws_instance.web[0]": {Action_destroy_before_create, Action_replace}},
+			violations: []string{Guardrail_rule_delete},
+		},
+		{
+			name:       "resource replaced with create before destroy protected from deletion and replacement",
+			config:     GuardrailConfig{DenyDelete: []string{"aws_instance.*"}, DenyReplace: []string{"*.web"}},
+			actions:    map[string][]string{"aws_instance.web": {Action_create_before_destroy, Action_replace}},
+			violations: []string{Guardrail_rule_delete, Guardrail_rule_replace},
+		},
+		{
+			name:    "updated protected resource",
+			config:  GuardrailConfig{DenyDelete: []string{"aws_instance.*"}, DenyReplace: []string{"aws_instance.*"}},
+			actions: map[string][]string{"aws_instance.web": {Action_update}},
+		},
+		{
+			name:       "change in nested protected module",
+			config:     GuardrailConfig{ProtectedModules: []string{"module.iam"}},
+			actions:    map[string][]string{"module.iam.module.roles.aws_iam_role.admin": {Action_update}},
+			violations: []string{Guardrail_rule_protected_module},
+		},
+		{
+			name:   "too many changes",
+			config: GuardrailConfig{MaxChanges: 1},
+			actions: map[string][]string{
+				"aws_s3_bucket.a": {Action_create},
+				"aws_s3_bucket.b": {Action_create},
+				"aws_s3_bucket.c": {Action_no_op},
+			},
+			violations: []string{Guardrail_rule_max_changes},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := CheckGuardrails(newTestPlan(t, test.actions), &test.config)
+			var rules []string
+			for _, violation := range result.Violations {
+				rules = append(rules, violation.Rule)
+			}
+			if len(rules) != len(test.violations) {
+				t.Fatalf("got violations %v, want %v", rules, test.violations)
+			}
+			for idx := range rules {
+				if rules[idx] != test.violations[idx] {
+					t.Fatalf("got violations %v, want %v", rules, test.violations)
+				}
+			}
+			if result.Passed != (len(test.violations) == 0) {
+				t.Errorf("got passed %t with violations %v", result.Passed, rules)
+			}
+		})
+	}
+}
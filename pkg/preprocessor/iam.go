@@ -0,0 +1,530 @@
+package preprocessor
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// IAMPolicyDocument is a parsed AWS IAM policy document.
+type IAMPolicyDocument struct {
+	Statements []IAMStatement `json:"statements"`
+}
+
+// IAMStatement is a statement of an IAM policy document. Action, Resource and their negations may be given as
+// a string or a list in the document and are normalized to lists.
+type IAMStatement struct {
+	Effect       string   `json:"effect"`
+	Actions      []string `json:"actions,omitempty"`
+	NotActions   []string `json:"notActions,omitempty"`
+	Resources    []string `json:"resources,omitempty"`
+	NotResources []string `json:"notResources,omitempty"`
+}
+
+// IAMPermission grants a principal, an IAM role, user or group, actions on a resource.
+type IAMPermission struct {
+	Principal string `json:"principal"`
+	// Resource is the address of the resource node, or the ARN pattern of the policy if no node matches it
+	Resource string   `json:"resource"`
+	Actions  []string `json:"actions"`
+	// Policies are the addresses of the nodes whose policy documents grant the actions
+	Policies []string `json:"policies"`
+}
+
+// IAMUnresolvedPolicy is a managed policy attached to a principal whose document is not part of the node table,
+// e.g. a policy managed by AWS, or whose ARN is not known before apply and which the attachment does not reference.
+type IAMUnresolvedPolicy struct {
+	Principal string `json:"principal"`
+	PolicyArn string `json:"policyArn,omitempty"`
+	// Attachment is the address of the policy attachment if the ARN of the policy is not known
+	Attachment string `json:"attachment,omitempty"`
+}
+
+// IAMReport contains the permissions which the IAM policies of a node table grant.
+type IAMReport struct {
+	Permissions []IAMPermission       `json:"permissions,omitempty"`
+	Unresolved  []IAMUnresolvedPolicy `json:"unresolved,omitempty"`
+	// Assumptions map the addresses of compute resources like lambda functions to the addresses of the roles they assume
+	Assumptions map[string][]string `json:"assumptions,omitempty"`
+}
+
+// iamGrant is a policy document which applies to a principal.
+type iamGrant struct {
+	policy   string
+	document *IAMPolicyDocument
+}
+
+type iamPermissionKey struct {
+	principal string
+	resource  string
+}
+
+// ParseIAMPolicyDocument parses a json formatted IAM policy document.
+func ParseIAMPolicyDocument(document string) (*IAMPolicyDocument, error) {
+	var raw struct {
+		Statement json.RawMessage
+	}
+	err := json.Unmarshal([]byte(document), &raw)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't parse the given policy document: %s", err.Error())
+	}
+
+	var rawStatements []map[string]interface{}
+	if len(raw.Statement) > 0 && raw.Statement[0] == '{' {
+		var single map[string]interface{}
+		err = json.Unmarshal(raw.Statement, &single)
+		rawStatements = append(rawStatements, single)
+	} else if len(raw.Statement) > 0 {
+		err = json.Unmarshal(raw.Statement, &rawStatements)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("couldn't parse the given policy document: %s", err.Error())
+	}
+
+	parsed := new(IAMPolicyDocument)
+	for _, statement := range rawStatements {
+		parsed.Statements = append(parsed.Statements, IAMStatement{
+			Effect:       stringAttribute(statement, "Effect"),
+			Actions:      stringList(statement["Action"]),
+			NotActions:   stringList(statement["NotAction"]),
+			Resources:    stringList(statement["Resource"]),
+			NotResources: stringList(statement["NotResource"]),
+		})
+	}
+	return parsed, nil
+}
+
+// ExtractIAMPermissions derives from the IAM roles, users, groups, policies and policy attachments in the node table
+// which actions the principals may perform on which resources. Policy documents are read from the policy attributes
+// and, if those are not known yet as in plans, from the aws_iam_policy_document data sources the policies depend on.
+// Likewise principals, policies and roles referenced by attributes which are not known before apply are resolved by the
+// resources of the respective type which a resource references in its configuration, if it references exactly one.
+// Every permission on a resource of the node table is added as an edge of kind Edge_kind_iam from the principal to the
+// resource. Additionally lambda functions, ECS task definitions and EC2 instances get edges of kind Edge_kind_assumes_role
+// to the roles they assume. Statements with NotAction or NotResource are not evaluated. Deny statements only remove
+// actions they match literally, so the result may overstate what a principal can do.
+func ExtractIAMPermissions(nodeTable map[string]Node) *IAMReport {
+	report := &IAMReport{Assumptions: make(map[string][]string)}
+	byType := make(map[string][]string)
+	byArn := make(map[string]string)
+	for _, address := range sortedAddresses(nodeTable) {
+		resource, ok := nodeTable[address].(*Resource)
+		if !ok {
+			continue
+		}
+		parsed, ok := parseResourceAddress(address)
+		if !ok {
+			continue
+		}
+		byType[parsed.Type] = append(byType[parsed.Type], address)
+		// managed resources take precedence over data sources reading the same resource
+		if arn := stringAttribute(effectiveState(resource), "arn"); arn != "" {
+			if _, ok := byArn[arn]; !ok || parsed.Mode == Resource_mode_managed {
+				byArn[arn] = address
+			}
+		}
+	}
+	resourcesOfType := func(types ...string) []string {
+		var addresses []string
+		for _, resourceType := range types {
+			addresses = append(addresses, byType[resourceType]...)
+		}
+		return addresses
+	}
+	attributes := func(address string) map[string]interface{} {
+		return effectiveState(nodeTable[address].(*Resource))
+	}
+	soleReference := func(address string, resourceType string) string {
+		if references := referencedResources(nodeTable, address, Resource_mode_managed, resourceType); len(references) == 1 {
+			return references[0]
+		}
+		return ""
+	}
+
+	principalKinds := []string{"role", "user", "group"}
+	principals := map[string]map[string]string{"role": {}, "user": {}, "group": {}}
+	for _, kind := range principalKinds {
+		byName := principals[kind]
+		for _, address := range resourcesOfType("aws_iam_" + kind) {
+			byName[stringAttribute(attributes(address), "name")] = address
+			byName[stringAttribute(attributes(address), "arn")] = address
+		}
+		delete(byName, "")
+	}
+	// principalOf returns the principal of the given kind which the attribute of the resource names
+	principalOf := func(kind string, address string, attribute string) string {
+		if value := stringAttribute(attributes(address), attribute); value != "" {
+			return principals[kind][value]
+		}
+		return soleReference(address, "aws_iam_"+kind)
+	}
+
+	grants := make(map[string][]iamGrant)
+	addGrant := func(principal string, policy string, document *IAMPolicyDocument) {
+		if principal != "" && document != nil {
+			grants[principal] = append(grants[principal], iamGrant{policy: policy, document: document})
+		}
+	}
+	managedPolicies := make(map[string]string)
+	for _, address := range resourcesOfType("aws_iam_policy") {
+		managedPolicies[stringAttribute(attributes(address), "arn")] = address
+	}
+	attachManagedPolicy := func(principal string, policyArn string, attachment string) {
+		if principal == "" {
+			return
+		}
+		if policy, ok := managedPolicies[policyArn]; ok && policyArn != "" {
+			addGrant(principal, policy, iamPolicyDocument(nodeTable, policy, "policy"))
+			return
+		}
+		unresolved := IAMUnresolvedPolicy{Principal: principal, PolicyArn: policyArn}
+		if policyArn == "" {
+			// the ARN of a policy which is created by the plan is not known yet
+			if policy := soleReference(attachment, "aws_iam_policy"); policy != "" {
+				addGrant(principal, policy, iamPolicyDocument(nodeTable, policy, "policy"))
+				return
+			}
+			unresolved.Attachment = attachment
+		}
+		for _, existing := range report.Unresolved {
+			if existing == unresolved {
+				return
+			}
+		}
+		report.Unresolved = append(report.Unresolved, unresolved)
+	}
+
+	for _, address := range resourcesOfType("aws_iam_role") {
+		for _, inline := range objectList(attributes(address)["inline_policy"]) {
+			if document, err := ParseIAMPolicyDocument(stringAttribute(inline, "policy")); err == nil {
+				addGrant(address, address, document)
+			}
+		}
+		for _, policyArn := range stringList(attributes(address)["managed_policy_arns"]) {
+			attachManagedPolicy(address, policyArn, address)
+		}
+	}
+	for _, kind := range principalKinds {
+		byName := principals[kind]
+		for _, address := range resourcesOfType("aws_iam_" + kind + "_policy") {
+			addGrant(principalOf(kind, address, kind), address, iamPolicyDocument(nodeTable, address, "policy"))
+		}
+		for _, address := range resourcesOfType("aws_iam_" + kind + "_policy_attachment") {
+			attachManagedPolicy(principalOf(kind, address, kind), stringAttribute(attributes(address), "policy_arn"), address)
+		}
+		for _, address := range resourcesOfType("aws_iam_policy_attachment") {
+			members := referencedResources(nodeTable, address, Resource_mode_managed, "aws_iam_"+kind)
+			if names := stringList(attributes(address)[kind+"s"]); len(names) > 0 {
+				members = nil
+				for _, name := range names {
+					members = append(members, byName[name])
+				}
+			}
+			for _, member := range members {
+				attachManagedPolicy(member, stringAttribute(attributes(address), "policy_arn"), address)
+			}
+		}
+	}
+
+	permissions := make(map[iamPermissionKey]*IAMPermission)
+	var keys []iamPermissionKey
+	for _, principal := range sortedKeys(grants) {
+		var denies []IAMStatement
+		for _, grant := range grants[principal] {
+			for _, statement := range grant.document.Statements {
+				if statement.Effect == "Deny" {
+					denies = append(denies, statement)
+				}
+			}
+		}
+		for _, grant := range grants[principal] {
+			for _, statement := range grant.document.Statements {
+				if statement.Effect != "Allow" || len(statement.NotActions) > 0 || len(statement.NotResources) > 0 {
+					continue
+				}
+				for _, pattern := range statement.Resources {
+					targets := matchingArns(byArn, pattern, statement.Actions)
+					if len(targets) == 0 {
+						targets = map[string]string{pattern: pattern}
+					}
+					for arn, target := range targets {
+						actions := deniedActionsRemoved(actionsForArn(statement.Actions, arn), arn, denies)
+						if len(actions) == 0 {
+							continue
+						}
+						key := iamPermissionKey{principal: principal, resource: target}
+						permission, ok := permissions[key]
+						if !ok {
+							permission = &IAMPermission{Principal: principal, Resource: target}
+							permissions[key] = permission
+							keys = append(keys, key)
+						}
+						permission.Actions = appendUnique(permission.Actions, actions...)
+						permission.Policies = appendUnique(permission.Policies, grant.policy)
+					}
+				}
+			}
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].principal != keys[j].principal {
+			return keys[i].principal < keys[j].principal
+		}
+		return keys[i].resource < keys[j].resource
+	})
+	for _, key := range keys {
+		permission := permissions[key]
+		sort.Strings(permission.Actions)
+		report.Permissions = append(report.Permissions, *permission)
+		if _, ok := nodeTable[permission.Resource]; !ok {
+			continue
+		}
+		principal := nodeTable[permission.Principal].(*Resource)
+		principal.addEdge(Edge{
+			To:      permission.Resource,
+			Kind:    Edge_kind_iam,
+			Reason:  strings.Join(permission.Policies, ", "),
+			Actions: permission.Actions,
+		})
+	}
+
+	assume := func(address string, role string, reason string) {
+		if role == "" {
+			return
+		}
+		nodeTable[address].(*Resource).addEdge(Edge{To: role, Kind: Edge_kind_assumes_role, Reason: reason})
+		report.Assumptions[address] = appendUnique(report.Assumptions[address], role)
+	}
+	for _, address := range resourcesOfType("aws_lambda_function") {
+		assume(address, principalOf("role", address, "role"), "role")
+	}
+	for _, address := range resourcesOfType("aws_ecs_task_definition") {
+		assume(address, principalOf("role", address, "task_role_arn"), "task_role_arn")
+		assume(address, principalOf("role", address, "execution_role_arn"), "execution_role_arn")
+	}
+	profiles := make(map[string]string)
+	for _, address := range resourcesOfType("aws_iam_instance_profile") {
+		role := principalOf("role", address, "role")
+		assume(address, role, "role")
+		profiles[address] = role
+		profiles[stringAttribute(attributes(address), "name")] = role
+		profiles[stringAttribute(attributes(address), "arn")] = role
+	}
+	for _, address := range resourcesOfType("aws_instance") {
+		profile := stringAttribute(attributes(address), "iam_instance_profile")
+		if profile == "" {
+			profile = soleReference(address, "aws_iam_instance_profile")
+		}
+		assume(address, profiles[profile], "iam_instance_profile")
+	}
+	if len(report.Assumptions) == 0 {
+		report.Assumptions = nil
+	}
+	return report
+}
+
+// iamPolicyDocument returns the policy document stored in the attribute of the resource. If the attribute is not
+// known, the statements of the aws_iam_policy_document data sources the resource depends on are used.
+func iamPolicyDocument(nodeTable map[string]Node, address string, attribute string) *IAMPolicyDocument {
+	resource, ok := nodeTable[address].(*Resource)
+	if !ok {
+		return nil
+	}
+	if text := stringAttribute(effectiveState(resource), attribute); text != "" {
+		document, err := ParseIAMPolicyDocument(text)
+		if err != nil {
+			return nil
+		}
+		return document
+	}
+
+	var merged *IAMPolicyDocument
+	for _, dataSource := range referencedResources(nodeTable, address, Resource_mode_data, "aws_iam_policy_document") {
+		document := policyDocumentOfDataSource(effectiveState(nodeTable[dataSource].(*Resource)))
+		if document == nil {
+			continue
+		}
+		if merged == nil {
+			merged = new(IAMPolicyDocument)
+		}
+		merged.Statements = append(merged.Statements, document.Statements...)
+	}
+	return merged
+}
+
+// referencedResources returns the addresses of the resource instances of the given mode and type which the resource
+// depends on. Dependencies on resources with count or for_each stand for all of their instances.
+func referencedResources(nodeTable map[string]Node, address string, mode string, resourceType string) []string {
+	resource, ok := nodeTable[address].(*Resource)
+	if !ok {
+		return nil
+	}
+	var references []string
+	for _, dependency := range resource.Dependencies {
+		candidates := []string{dependency}
+		if referenceResource, ok := nodeTable[dependency].(*ReferenceResource); ok {
+			candidates = referenceResource.GetChildren()
+		}
+		for _, candidate := range candidates {
+			parsed, ok := parseResourceAddress(candidate)
+			if _, isResource := nodeTable[candidate].(*Resource); !ok || !isResource || parsed.Mode != mode || parsed.Type != resourceType {
+				continue
+			}
+			references = appendUnique(references, candidate)
+		}
+	}
+	return references
+}
+
+// policyDocumentOfDataSource returns the document of an aws_iam_policy_document data source from its json attribute
+// or, if that is not known, from its statement blocks.
+func policyDocumentOfDataSource(state map[string]interface{}) *IAMPolicyDocument {
+	if text := stringAttribute(state, "json"); text != "" {
+		if document, err := ParseIAMPolicyDocument(text); err == nil {
+			return document
+		}
+	}
+	statements := objectList(state["statement"])
+	if len(statements) == 0 {
+		return nil
+	}
+	document := new(IAMPolicyDocument)
+	for _, statement := range statements {
+		effect := stringAttribute(statement, "effect")
+		if effect == "" {
+			effect = "Allow"
+		}
+		document.Statements = append(document.Statements, IAMStatement{
+			Effect:       effect,
+			Actions:      stringList(statement["actions"]),
+			NotActions:   stringList(statement["not_actions"]),
+			Resources:    stringList(statement["resources"]),
+			NotResources: stringList(statement["not_resources"]),
+		})
+	}
+	return document
+}
+
+// matchingArns returns the ARNs and addresses of the resources which match the resource pattern of a statement and
+// belong to a service of its actions. Patterns for objects of a resource like arn:aws:s3:::bucket/* match the resource.
+func matchingArns(byArn map[string]string, pattern string, actions []string) map[string]string {
+	glob := compileGlob(pattern)
+	matches := make(map[string]string)
+	for arn, address := range byArn {
+		if !glob.MatchString(arn) && !strings.HasPrefix(pattern, arn+"/") {
+			continue
+		}
+		if len(actionsForArn(actions, arn)) > 0 {
+			matches[arn] = address
+		}
+	}
+	return matches
+}
+
+// actionsForArn returns the actions which belong to the service of the ARN. Patterns which are no ARN keep all actions.
+func actionsForArn(actions []string, arn string) []string {
+	segments := strings.SplitN(arn, ":", 4)
+	if len(segments) < 3 || segments[0] != "arn" {
+		return actions
+	}
+	service := strings.ToLower(segments[2])
+	var matching []string
+	for _, action := range actions {
+		prefix, _, _ := strings.Cut(strings.ToLower(action), ":")
+		if action == "*" || compileGlob(prefix).MatchString(service) {
+			matching = append(matching, action)
+		}
+	}
+	return matching
+}
+
+// deniedActionsRemoved removes the actions which a deny statement matching the ARN matches literally.
+func deniedActionsRemoved(actions []string, arn string, denies []IAMStatement) []string {
+	var allowed []string
+	for _, action := range actions {
+		denied := false
+		for _, deny := range denies {
+			if matchesAnyGlob(deny.Resources, arn, false) && matchesAnyGlob(deny.Actions, action, true) {
+				denied = true
+				break
+			}
+		}
+		if !denied {
+			allowed = append(allowed, action)
+		}
+	}
+	return allowed
+}
+
+func matchesAnyGlob(patterns []string, value string, ignoreCase bool) bool {
+	for _, pattern := range patterns {
+		var glob *regexp.Regexp
+		if ignoreCase {
+			glob = compileGlob(strings.ToLower(pattern))
+			value = strings.ToLower(value)
+		} else {
+			glob = compileGlob(pattern)
+		}
+		if glob.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// ForPrincipal returns the part of the report which concerns the principal with the given address. The address may also be
+// the address of a resource which assumes roles, in which case the permissions of the assumed roles are returned.
+func (report *IAMReport) ForPrincipal(address string) *IAMReport {
+	principals := append([]string{address}, report.Assumptions[address]...)
+	filtered := new(IAMReport)
+	for _, permission := range report.Permissions {
+		if containsString(principals, permission.Principal) {
+			filtered.Permissions = append(filtered.Permissions, permission)
+		}
+	}
+	for _, unresolved := range report.Unresolved {
+		if containsString(principals, unresolved.Principal) {
+			filtered.Unresolved = append(filtered.Unresolved, unresolved)
+		}
+	}
+	if roles, ok := report.Assumptions[address]; ok {
+		filtered.Assumptions = map[string][]string{address: roles}
+	}
+	return filtered
+}
+
+// Text renders the permissions as plain text grouped by principal.
+func (report *IAMReport) Text() string {
+	var b strings.Builder
+	principal := ""
+	for _, permission := range report.Permissions {
+		if permission.Principal != principal {
+			principal = permission.Principal
+			fmt.Fprintf(&b, "%s\n", displayAddress(principal))
+		}
+		resource := permission.Resource
+		if strings.HasPrefix(resource, RootAddress) || strings.HasPrefix(resource, StackAddressPrefix+".") {
+			resource = displayAddress(resource)
+		}
+		fmt.Fprintf(&b, "  %s: %s\n", resource, strings.Join(permission.Actions, ", "))
+	}
+	for _, unresolved := range report.Unresolved {
+		if unresolved.PolicyArn == "" {
+			fmt.Fprintf(&b, "%s: the policy attached by %s is not known before apply\n", displayAddress(unresolved.Principal), displayAddress(unresolved.Attachment))
+			continue
+		}
+		fmt.Fprintf(&b, "%s: policy %s is not part of the input\n", displayAddress(unresolved.Principal), unresolved.PolicyArn)
+	}
+	return b.String()
+}
+
+func sortedKeys(grants map[string][]iamGrant) []string {
+	keys := make([]string, 0, len(grants))
+	for key := range grants {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
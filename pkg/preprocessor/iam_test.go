@@ -0,0 +1,109 @@
+package preprocessor
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+// parseTestPlan parses a plan file of the testdata directory.
+func parseTestPlan(t *testing.T, name string) map[string]Node {
+	t.Helper()
+	data, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodeTable, err := ParsePlanFile(data, "", "")
+	if err != nil {
+		t.Fatalf("could not parse %s: %s", name, err)
+	}
+	return nodeTable
+}
+
+func TestParseIAMPolicyDocument(t *testing.T) {
+	tests := []struct {
+		name     string
+		document string
+		want     []IAMStatement
+	}{
+		{
+			name:     "single statement with string values",
+			document: `{"Statement": {"Effect": "Allow", "Action": "s3:GetObject", "Resource": "*"}}`,
+			want:     []IAMStatement{{Effect: "Allow", Actions: []string{"s3:GetObject"}, Resources: []string{"*"}}},
+		},
+		{
+			name:     "statement list with negations",
+			document: `{"Statement": [{"Effect": "Deny", "NotAction": ["iam:*"], "NotResource": ["arn:aws:iam::1:role/a"]}]}`,
+			want:     []IAMStatement{{Effect: "Deny", NotActions: []string{"iam:*"}, NotResources: []string{"arn:aws:iam::1:role/a"}}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			document, err := ParseIAMPolicyDocument(test.document)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(document.Statements, test.want) {
+				t.Errorf("got %+v, want %+v", document.Statements, test.want)
+			}
+		})
+	}
+}
+
+func TestExtractIAMPermissionsFromState(t *testing.T) {
+	nodeTable := map[string]Node{}
+	add := func(address string, state map[string]interface{}) {
+		resource, _ := NewResource(RootAddress+"."+address, nil)
+		resource.addState(State_current, state)
+		nodeTable[resource.Address] = resource
+	}
+	add("aws_iam_role.app", map[string]interface{}{"name": "app", "arn": "arn:aws:iam::1:role/app"})
+	add("aws_iam_role_policy.app", map[string]interface{}{
+		"role":   "app",
+		"policy": `{"Statement": [{"Effect": "Allow", "Action": ["s3:*", "sqs:SendMessage"], "Resource": "*"}, {"Effect": "Deny", "Action": "s3:DeleteBucket", "Resource": "*"}]}`,
+	})
+	add("aws_iam_role_policy_attachment.readonly", map[string]interface{}{"role": "app", "policy_arn": "arn:aws:iam::aws:policy/ReadOnlyAccess"})
+	add("aws_s3_bucket.data", map[string]interface{}{"arn": "arn:aws:s3:::data"})
+	add("aws_lambda_function.api", map[string]interface{}{"role": "arn:aws:iam::1:role/app"})
+
+	report := ExtractIAMPermissions(nodeTable)
+	bucket := RootAddress + ".aws_s3_bucket.data"
+	role := RootAddress + ".aws_iam_role.app"
+	var bucketActions []string
+	for _, permission := range report.Permissions {
+		if permission.Principal == role && permission.Resource == bucket {
+			bucketActions = permission.Actions
+		}
+	}
+	if !reflect.DeepEqual(bucketActions, []string{"s3:*"}) {
+		t.Errorf("got actions %v on the bucket, want only the s3 actions", bucketActions)
+	}
+	wantUnresolved := []IAMUnresolvedPolicy{{Principal: role, PolicyArn: "arn:aws:iam::aws:policy/ReadOnlyAccess"}}
+	if !reflect.DeepEqual(report.Unresolved, wantUnresolved) {
+		t.Errorf("got unresolved %+v, want %+v", report.Unresolved, wantUnresolved)
+	}
+	lambda := RootAddress + ".aws_lambda_function.api"
+	if !reflect.DeepEqual(report.Assumptions[lambda], []string{role}) {
+		t.Errorf("got assumed roles %v, want %s", report.Assumptions[lambda], role)
+	}
+}
+
+func TestExtractIAMPermissionsFromPlan(t *testing.T) {
+	nodeTable := parseTestPlan(t, "iam_plan.json")
+	report := ExtractIAMPermissions(nodeTable).ForPrincipal(RootAddress + ".aws_lambda_function.f")
+
+	role := RootAddress + ".aws_iam_role.lambda"
+	wantPermissions := []IAMPermission{{
+		Principal: role,
+		Resource:  "arn:aws:s3:::reports/*",
+		Actions:   []string{"s3:GetObject"},
+		Policies:  []string{RootAddress + ".aws_iam_policy.access"},
+	}}
+	if !reflect.DeepEqual(report.Permissions, wantPermissions) {
+		t.Errorf("got permissions %+v, want %+v", report.Permissions, wantPermissions)
+	}
+	wantUnresolved := []IAMUnresolvedPolicy{{Principal: role, Attachment: RootAddress + ".aws_iam_role_policy_attachment.unknown"}}
+	if !reflect.DeepEqual(report.Unresolved, wantUnresolved) {
+		t.Errorf("got unresolved %+v, want %+v", report.Unresolved, wantUnresolved)
+	}
+}
@@ -0,0 +1,237 @@
+package preprocessor
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:embed import_ids.json
+var builtinImportIDRules []byte
+
+// ImportIDRules maps resource types to templates of the ID terraform imports them by. The file format is
+//
+//	{"rules": [{"pattern": "aws_iam_role_policy_attachment", "id": "{role}/{policy_arn}"}]}
+//
+// Patterns are globs on the resource type and the first rule whose placeholders can all be resolved wins. Placeholders
+// are dotted paths into the state with the same modifiers as console link templates. Resource types without a rule are
+// imported by their id attribute.
+type ImportIDRules struct {
+	Rules []ImportIDRule `json:"rules"`
+}
+
+// ImportIDRule derives the import ID of the resources whose type matches the pattern.
+type ImportIDRule struct {
+	Pattern string `json:"pattern"`
+	ID      string `json:"id"`
+}
+
+// ImportIDRegistry derives import IDs by a list of rules.
+type ImportIDRegistry struct {
+	rules globRules[ImportIDRule]
+}
+
+// ImportBlock imports a resource instance of a state by its ID.
+type ImportBlock struct {
+	// Stack is the stack of the resource if the node table was merged from several stacks
+	Stack string `json:"stack,omitempty"`
+	To    string `json:"to"`
+	ID    string `json:"id"`
+}
+
+// ImportReport contains the import blocks of the selected resources and the resources without an import ID.
+type ImportReport struct {
+	Imports []ImportBlock `json:"imports"`
+	// Unresolved contain the addresses of the resources whose import ID couldn't be derived from their state
+	Unresolved []string `json:"unresolved,omitempty"`
+}
+
+// ParseImportIDRules takes a json formatted import ID file and validates it.
+func ParseImportIDRules(data []byte) (*ImportIDRules, error) {
+	rules := new(ImportIDRules)
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(rules)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't parse the given import ID file: %s", err.Error())
+	}
+	for idx, rule := range rules.Rules {
+		if rule.Pattern == "" || rule.ID == "" {
+			return nil, fmt.Errorf("import ID rule %d has no pattern or id", idx)
+		}
+		if err := validateTemplate(rule.ID); err != nil {
+			return nil, fmt.Errorf("import ID rule '%s' uses an %s", rule.Pattern, err.Error())
+		}
+	}
+	return rules, nil
+}
+
+// NewImportIDRegistry returns a registry with the built-in rules, which cover the aws and kubernetes resources whose
+// import ID differs from their id attribute.
+func NewImportIDRegistry() *ImportIDRegistry {
+	rules, err := ParseImportIDRules(builtinImportIDRules)
+	if err != nil {
+		panic(err)
+	}
+	registry := new(ImportIDRegistry)
+	registry.Extend(rules)
+	return registry
+}
+
+// Extend adds the rules to the registry. They take precedence over the rules which were added before.
+func (registry *ImportIDRegistry) Extend(rules *ImportIDRules) {
+	registry.rules.prepend(rules.Rules)
+}
+
+// ImportID returns the import ID of a resource of the given type and state, or the empty string if no rule can be resolved.
+func (registry *ImportIDRegistry) ImportID(resourceType string, state map[string]interface{}) string {
+	for _, rule := range registry.rules.matching(resourceType) {
+		id, resolved := expandTemplate(rule.ID, func(name string) interface{} {
+			value, _ := lookupAttribute(state, strings.Split(name, "."))
+			return value
+		})
+		if resolved {
+			return id
+		}
+	}
+	return ""
+}
+
+// GenerateImports returns an import block for every managed resource instance in the current state whose terraform
+// address matches one of the patterns, or for all of them if no pattern is given. Nodes of merged stacks can
+// additionally be matched as stack:address.
+func GenerateImports(nodeTable map[string]Node, registry *ImportIDRegistry, patterns []string) *ImportReport {
+	globs := compileGlobs(patterns)
+	report := &ImportReport{Imports: []ImportBlock{}}
+	for _, address := range sortedAddresses(nodeTable) {
+		resource, ok := nodeTable[address].(*Resource)
+		if !ok {
+			continue
+		}
+		parsed, ok := parseResourceAddress(address)
+		if !ok || parsed.Mode != Resource_mode_managed {
+			continue
+		}
+		state := resource.States[State_current]
+		if state == nil {
+			continue
+		}
+		if len(globs) > 0 && !matchesAddress(globs, address) {
+			continue
+		}
+		id := registry.ImportID(parsed.Type, state)
+		if id == "" {
+			report.Unresolved = append(report.Unresolved, displayAddress(address))
+			continue
+		}
+		report.Imports = append(report.Imports, ImportBlock{Stack: StackOf(address), To: TerraformAddress(address), ID: id})
+	}
+	return report
+}
+
+// matchesAddress reports whether one of the globs matches the terraform address of a node or its address as stack:address.
+func matchesAddress(globs []*regexp.Regexp, address string) bool {
+	for _, glob := range globs {
+		if glob.MatchString(TerraformAddress(address)) || glob.MatchString(displayAddress(address)) {
+			return true
+		}
+	}
+	return false
+}
+
+// HCL renders the import blocks and, if skeleton is set, an empty resource block for every imported resource, which
+// declares count or for_each if the resource has several instances. Resource blocks of child modules belong into the
+// source of the module, they are preceded by a comment naming the module.
+func (report *ImportReport) HCL(skeleton bool) string {
+	var b strings.Builder
+	stack := ""
+	for _, block := range report.Imports {
+		if block.Stack != stack {
+			stack = block.Stack
+			fmt.Fprintf(&b, "# stack %s\n\n", stack)
+		}
+		fmt.Fprintf(&b, "import {\n  to = %s\n  id = %s\n}\n\n", block.To, strconv.Quote(block.ID))
+	}
+	for _, address := range report.Unresolved {
+		fmt.Fprintf(&b, "# no import ID could be derived for %s\n", address)
+	}
+	if len(report.Unresolved) > 0 {
+		b.WriteString("\n")
+	}
+	if skeleton {
+		b.WriteString(report.skeletons())
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// skeletons renders a resource block for every resource of the import blocks.
+func (report *ImportReport) skeletons() string {
+	type skeleton struct {
+		stack  string
+		module string
+		typ    string
+		name   string
+		keys   []string
+	}
+	var order []string
+	skeletons := make(map[string]*skeleton)
+	for _, block := range report.Imports {
+		parsed, _ := parseResourceAddress(block.To)
+		key := block.Stack + " " + parsed.Module + " " + parsed.Type + "." + parsed.Name
+		s, ok := skeletons[key]
+		if !ok {
+			s = &skeleton{stack: block.Stack, module: parsed.Module, typ: parsed.Type, name: parsed.Name}
+			skeletons[key] = s
+			order = append(order, key)
+		}
+		if parsed.Index != "" {
+			s.keys = append(s.keys, strings.TrimSuffix(strings.TrimPrefix(parsed.Index, "["), "]"))
+		}
+	}
+	sort.Strings(order)
+
+	var b strings.Builder
+	for _, key := range order {
+		s := skeletons[key]
+		var location []string
+		if s.stack != "" {
+			location = append(location, "stack "+s.stack)
+		}
+		if s.module != "" {
+			location = append(location, s.module)
+		}
+		if len(location) > 0 {
+			fmt.Fprintf(&b, "# %s\n", strings.Join(location, ", "))
+		}
+		fmt.Fprintf(&b, "resource %s %s {\n", strconv.Quote(s.typ), strconv.Quote(s.name))
+		if len(s.keys) > 0 {
+			if count, ok := instanceCount(s.keys); ok {
+				fmt.Fprintf(&b, "  count = %d\n\n", count)
+			} else {
+				fmt.Fprintf(&b, "  for_each = toset([%s])\n\n", strings.Join(s.keys, ", "))
+			}
+		}
+		b.WriteString("  # add the arguments of the imported resource\n}\n\n")
+	}
+	return b.String()
+}
+
+// instanceCount returns the count of a resource with the given numeric instance keys, or false if the keys are for_each keys.
+func instanceCount(keys []string) (int, bool) {
+	count := 0
+	for _, key := range keys {
+		idx, err := strconv.Atoi(key)
+		if err != nil {
+			return 0, false
+		}
+		if idx+1 > count {
+			count = idx + 1
+		}
+	}
+	return count, true
+}
@@ -0,0 +1,43 @@
+package preprocessor
+
+import (
+	"testing"
+)
+
+func TestImportID(t *testing.T) {
+	registry := NewImportIDRegistry()
+	tests := []struct {
+		resourceType string
+		state        map[string]interface{}
+		want         string
+	}{
+		{
+			resourceType: "aws_s3_bucket_versioning",
+			state:        map[string]interface{}{"id": "logs", "bucket": "logs"},
+			want:         "logs",
+		},
+		{
+			resourceType: "aws_s3_bucket_object",
+			state:        map[string]interface{}{"id": "reports/2024.csv", "bucket": "logs", "key": "reports/2024.csv"},
+			want:         "reports/2024.csv",
+		},
+		{
+			resourceType: "aws_security_group_rule",
+			state: map[string]interface{}{
+				"security_group_id": "sg-1", "type": "ingress", "protocol": "tcp", "from_port": 443.0, "to_port": 443.0,
+				"cidr_blocks": []interface{}{"10.0.0.0/16", "10.1.0.0/16"},
+			},
+			want: "sg-1_ingress_tcp_443_443_10.0.0.0/16_10.1.0.0/16",
+		},
+		{
+			resourceType: "kubernetes_deployment",
+			state:        map[string]interface{}{"metadata": []interface{}{map[string]interface{}{"namespace": "web", "name": "api"}}},
+			want:         "web/api",
+		},
+	}
+	for _, test := range tests {
+		if id := registry.ImportID(test.resourceType, test.state); id != test.want {
+			t.Errorf("got import ID %s for %s, want %s", id, test.resourceType, test.want)
+		}
+	}
+}
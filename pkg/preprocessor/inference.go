@@ -0,0 +1,101 @@
+package preprocessor
+
+import (
+	"sort"
+)
+
+// inference_identifier_attributes are the attributes whose values identify a resource, e.g. the id of an AWS resource,
+// the resource ID of an Azure resource or the self link of a GCP resource.
+var inference_identifier_attributes = []string{"id", "arn", "self_link"}
+
+// inference_min_identifier_length is the minimal length of indexed identifiers. Shorter values like counters are too likely to match by accident.
+const inference_min_identifier_length = 6
+
+// InferEdges adds inferred edges between resources which terraform does not record as dependencies. The identifiers of all
+// resources are indexed and every resource whose current or planned state contains the identifier of another resource gets
+// an edge to that resource. The reason of the edge is the path of the attribute that contains the identifier.
+// Edges to resources which are already dependencies are not added. It returns the number of added edges.
+func InferEdges(nodeTable map[string]Node) int {
+	owners := make(map[string][]string)
+	for _, address := range sortedAddresses(nodeTable) {
+		resource, ok := nodeTable[address].(*Resource)
+		if !ok {
+			continue
+		}
+		for _, identifier := range resourceIdentifiers(resource) {
+			owners[identifier] = append(owners[identifier], address)
+		}
+	}
+
+	parents := parentTable(nodeTable)
+	added := 0
+	for _, address := range sortedAddresses(nodeTable) {
+		resource, ok := nodeTable[address].(*Resource)
+		if !ok {
+			continue
+		}
+		values := make(map[string]interface{})
+		for _, state := range []string{State_current, State_planned} {
+			flattenAttributes("", resource.States[state], values)
+		}
+		paths := make([]string, 0, len(values))
+		for path := range values {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+
+		for _, path := range paths {
+			if isIdentifierAttribute(path) {
+				continue
+			}
+			value, ok := values[path].(string)
+			if !ok {
+				continue
+			}
+			for _, owner := range owners[value] {
+				if owner == address || containsString(resource.Dependencies, owner, parents[owner]) || hasEdgeTo(resource, owner) {
+					continue
+				}
+				resource.addEdge(Edge{To: owner, Kind: Edge_kind_inferred, Reason: path})
+				added++
+			}
+		}
+	}
+	return added
+}
+
+// resourceIdentifiers returns the distinct values of the identifier attributes of the current and planned state of the resource.
+func resourceIdentifiers(resource *Resource) []string {
+	var identifiers []string
+	seen := make(map[string]bool)
+	for _, state := range []string{State_current, State_planned} {
+		for _, attribute := range inference_identifier_attributes {
+			identifier, ok := resource.States[state][attribute].(string)
+			if !ok || len(identifier) < inference_min_identifier_length || seen[identifier] {
+				continue
+			}
+			seen[identifier] = true
+			identifiers = append(identifiers, identifier)
+		}
+	}
+	return identifiers
+}
+
+func isIdentifierAttribute(path string) bool {
+	for _, attribute := range inference_identifier_attributes {
+		if path == attribute {
+			return true
+		}
+	}
+	return false
+}
+
+// hasEdgeTo reports whether the resource already has an edge of any kind to the node.
+func hasEdgeTo(resource *Resource, address string) bool {
+	for _, edge := range resource.Edges {
+		if edge.To == address {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,69 @@
+package preprocessor
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestInferEdges(t *testing.T) {
+	nodeTable := map[string]Node{}
+	add := func(address string, dependencies []string, current map[string]interface{}) *Resource {
+		resource, _ := NewResource(address, dependencies)
+		resource.addState(State_current, current)
+		nodeTable[address] = resource
+		return resource
+	}
+	network := StackAddress("network") + "." + RootAddress
+	app := StackAddress("app") + "." + RootAddress
+
+	add(network+".aws_vpc.main", nil, map[string]interface{}{"id": "vpc-123456", "arn": "arn:aws:ec2:eu-west-1:111122223333:vpc/vpc-123456"})
+	add(network+".aws_subnet.private[0]", nil, map[string]interface{}{"id": "subnet-a1", "vpc_id": "vpc-123456"})
+	reference, _ := NewReferenceResource(network+".aws_subnet.private", []string{network + ".aws_subnet.private[0]"}, nil)
+	nodeTable[reference.Address] = reference
+	// the counter is shorter than the minimum identifier length
+	add(network+".aws_route_table.main", nil, map[string]interface{}{"id": "rtb-1", "vpc_id": "vpc-123456"})
+	// the bucket refers to itself by its name
+	add(app+".aws_s3_bucket.logs", nil, map[string]interface{}{"id": "app-logs", "arn": "arn:aws:s3:::app-logs", "bucket": "app-logs"})
+	add(app+".aws_s3_bucket_policy.logs", nil, map[string]interface{}{"id": "policy-app-logs", "bucket": "app-logs"})
+	// the instance depends on the subnets as a whole and already has an edge to the vpc
+	instance := add(app+".aws_instance.web", []string{network + ".aws_subnet.private"}, map[string]interface{}{
+		"id":                     "i-0abc123",
+		"subnet_id":              "subnet-a1",
+		"route_table":            "rtb-1",
+		"vpc_security_group_ids": []interface{}{"sg-0def456"},
+		"tags":                   map[string]interface{}{"vpc": "vpc-123456"},
+	})
+	instance.addEdge(Edge{To: network + ".aws_vpc.main", Kind: Edge_kind_remote_state})
+	// the load balancer refers to the vpc of the other stack
+	add(app+".aws_lb.web", nil, map[string]interface{}{"id": "arn:aws:elasticloadbalancing:eu-west-1:111122223333:loadbalancer/app/web", "vpc_id": "vpc-123456"})
+	security := add(app+".aws_security_group.web", []string{network + ".aws_vpc.main"}, map[string]interface{}{"id": "sg-0def456", "vpc_id": "vpc-123456"})
+	security.addState(State_planned, map[string]interface{}{"id": "sg-0def456", "vpc_id": "vpc-123456", "description": "arn:aws:s3:::app-logs"})
+
+	added := InferEdges(nodeTable)
+
+	want := map[string][]Edge{
+		network + ".aws_vpc.main":          nil,
+		network + ".aws_subnet.private[0]": {{To: network + ".aws_vpc.main", Kind: Edge_kind_inferred, Reason: "vpc_id"}},
+		network + ".aws_route_table.main":  {{To: network + ".aws_vpc.main", Kind: Edge_kind_inferred, Reason: "vpc_id"}},
+		app + ".aws_s3_bucket.logs":        nil,
+		app + ".aws_s3_bucket_policy.logs": {{To: app + ".aws_s3_bucket.logs", Kind: Edge_kind_inferred, Reason: "bucket"}},
+		app + ".aws_instance.web": {
+			{To: network + ".aws_vpc.main", Kind: Edge_kind_remote_state},
+			{To: app + ".aws_security_group.web", Kind: Edge_kind_inferred, Reason: "vpc_security_group_ids[0]"},
+		},
+		app + ".aws_lb.web":             {{To: network + ".aws_vpc.main", Kind: Edge_kind_inferred, Reason: "vpc_id"}},
+		app + ".aws_security_group.web": {{To: app + ".aws_s3_bucket.logs", Kind: Edge_kind_inferred, Reason: "description"}},
+	}
+	for address, edges := range want {
+		if got := nodeTable[address].(*Resource).Edges; !reflect.DeepEqual(got, edges) {
+			t.Errorf("got edges %+v of %s, want %+v", got, address, edges)
+		}
+	}
+	if added != 6 {
+		t.Errorf("got %d added edges, want 6", added)
+	}
+
+	if added := InferEdges(nodeTable); added != 0 {
+		t.Errorf("got %d added edges when inferring the edges again, want 0", added)
+	}
+}
@@ -0,0 +1,168 @@
+package preprocessor
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// DefaultMoveSimilarity is the share of equal attributes from which a deleted and a created resource are considered
+// to be the same resource under another address.
+const DefaultMoveSimilarity = 0.8
+
+// MoveSuggestion proposes a moved block for a resource which a plan deletes under one address and creates under another.
+type MoveSuggestion struct {
+	// Stack is the stack of the resources if the node table was merged from several stacks
+	Stack string `json:"stack,omitempty"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+	// Similarity is the share of the known planned attributes which equal the current attributes of the deleted resource
+	Similarity float64 `json:"similarity"`
+	// Differences are the paths of the attributes which differ
+	Differences []string `json:"differences,omitempty"`
+}
+
+// MoveReport lists the moved blocks which would turn deletions and creations of a plan into moves.
+type MoveReport struct {
+	Suggestions []MoveSuggestion `json:"suggestions"`
+}
+
+// moveCandidate is a resource which is only deleted or only created by a plan.
+type moveCandidate struct {
+	address string
+	stack   string
+	typ     string
+	values  map[string]interface{}
+}
+
+// SuggestMoves pairs the resources which a plan only deletes with the resources of the same type which it only creates,
+// if the known attributes of the planned state match the current state with at least the given similarity. Every resource
+// is paired at most once, the most similar pairs first.
+func SuggestMoves(nodeTable map[string]Node, minSimilarity float64) *MoveReport {
+	var deleted, created []moveCandidate
+	for _, address := range sortedAddresses(nodeTable) {
+		resource, ok := nodeTable[address].(*Resource)
+		if !ok {
+			continue
+		}
+		parsed, ok := parseResourceAddress(address)
+		if !ok || parsed.Mode != Resource_mode_managed {
+			continue
+		}
+		candidate := moveCandidate{address: address, stack: StackOf(address), typ: parsed.Type}
+		switch {
+		case resource.HasAction(Action_delete) && !resource.HasAction(Action_create):
+			candidate.values = resource.States[State_current]
+			deleted = append(deleted, candidate)
+		case resource.HasAction(Action_create) && !resource.HasAction(Action_delete):
+			candidate.values = resource.States[State_planned]
+			created = append(created, candidate)
+		}
+	}
+
+	var pairs []MoveSuggestion
+	for _, from := range deleted {
+		for _, to := range created {
+			if from.typ != to.typ || from.stack != to.stack {
+				continue
+			}
+			similarity, differences := stateSimilarity(from.values, to.values)
+			if similarity < minSimilarity {
+				continue
+			}
+			pairs = append(pairs, MoveSuggestion{
+				Stack:       from.stack,
+				From:        from.address,
+				To:          to.address,
+				Similarity:  similarity,
+				Differences: differences,
+			})
+		}
+	}
+	sort.SliceStable(pairs, func(i, j int) bool {
+		return pairs[i].Similarity > pairs[j].Similarity
+	})
+
+	report := &MoveReport{Suggestions: []MoveSuggestion{}}
+	paired := make(map[string]bool)
+	for _, pair := range pairs {
+		if paired[pair.From] || paired[pair.To] {
+			continue
+		}
+		paired[pair.From] = true
+		paired[pair.To] = true
+		pair.From = TerraformAddress(pair.From)
+		pair.To = TerraformAddress(pair.To)
+		report.Suggestions = append(report.Suggestions, pair)
+	}
+	sort.Slice(report.Suggestions, func(i, j int) bool {
+		if report.Suggestions[i].Stack != report.Suggestions[j].Stack {
+			return report.Suggestions[i].Stack < report.Suggestions[j].Stack
+		}
+		return report.Suggestions[i].From < report.Suggestions[j].From
+	})
+	return report
+}
+
+// stateSimilarity compares the attributes of the planned state, which only contains the attributes known before the
+// apply, with the current state. It returns the share of equal attributes and the paths of the differing ones.
+func stateSimilarity(current map[string]interface{}, planned map[string]interface{}) (float64, []string) {
+	flattenedCurrent := make(map[string]interface{})
+	flattenedPlanned := make(map[string]interface{})
+	flattenAttributes("", current, flattenedCurrent)
+	flattenAttributes("", planned, flattenedPlanned)
+	if len(flattenedPlanned) == 0 {
+		return 0, nil
+	}
+
+	equal := 0
+	var differences []string
+	for path, value := range flattenedPlanned {
+		if currentValue, ok := flattenedCurrent[path]; ok && reflect.DeepEqual(currentValue, value) {
+			equal++
+		} else {
+			differences = append(differences, path)
+		}
+	}
+	sort.Strings(differences)
+	return float64(equal) / float64(len(flattenedPlanned)), differences
+}
+
+// HCL renders the suggestions as moved blocks which can be pasted into the root module of the configuration.
+func (report *MoveReport) HCL() string {
+	var b strings.Builder
+	stack := ""
+	for idx, suggestion := range report.Suggestions {
+		if idx > 0 {
+			b.WriteString("\n")
+		}
+		if suggestion.Stack != stack {
+			stack = suggestion.Stack
+			fmt.Fprintf(&b, "# stack %s\n", stack)
+		}
+		fmt.Fprintf(&b, "# %.0f%% of the attributes match\n", suggestion.Similarity*100)
+		fmt.Fprintf(&b, "moved {\n  from = %s\n  to   = %s\n}\n", suggestion.From, suggestion.To)
+	}
+	return b.String()
+}
+
+// Text renders the report as plain text, e.g. to print it in a terminal.
+func (report *MoveReport) Text() string {
+	if len(report.Suggestions) == 0 {
+		return "No resource is deleted and created under another address.\n"
+	}
+	var b strings.Builder
+	b.WriteString("Resources which are deleted and created under another address:\n")
+	for _, suggestion := range report.Suggestions {
+		from, to := suggestion.From, suggestion.To
+		if suggestion.Stack != "" {
+			from, to = suggestion.Stack+":"+from, suggestion.Stack+":"+to
+		}
+		fmt.Fprintf(&b, "\n  %s -> %s (%.0f%% similar)\n", from, to, suggestion.Similarity*100)
+		if len(suggestion.Differences) > 0 {
+			fmt.Fprintf(&b, "    differences: %s\n", strings.Join(suggestion.Differences, ", "))
+		}
+	}
+	return b.String()
+}
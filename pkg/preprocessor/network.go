@@ -0,0 +1,318 @@
+package preprocessor
+
+import (
+	"strconv"
+	"strings"
+)
+
+const (
+	// NetworkViewAddress is the address of the root of the network view
+	NetworkViewAddress = "_network"
+)
+
+// Kinds of groups in the network view. The levels are named after the terms of the respective cloud.
+const (
+	Group_kind_network_view = "network_view"
+	Group_kind_account      = "account"
+	Group_kind_subscription = "subscription"
+	Group_kind_project      = "project"
+	Group_kind_region       = "region"
+	Group_kind_vpc          = "vpc"
+	Group_kind_vnet         = "vnet"
+	Group_kind_network      = "network"
+	Group_kind_subnet       = "subnet"
+)
+
+const network_unknown = "unknown"
+
+// networkLevels are the kinds of the levels of the network view per cloud, from the account to the subnet.
+var networkLevels = map[string][4]string{
+	"aws":     {Group_kind_account, Group_kind_region, Group_kind_vpc, Group_kind_subnet},
+	"azurerm": {Group_kind_subscription, Group_kind_region, Group_kind_vnet, Group_kind_subnet},
+	"google":  {Group_kind_project, Group_kind_region, Group_kind_network, Group_kind_subnet},
+}
+
+// networkPlacement is the position of a resource in the network topology of its cloud.
+type networkPlacement struct {
+	Cloud   string
+	Account string
+	Region  string
+	Network string
+	Subnet  string
+}
+
+// inherit fills the unknown parts of the placement from the placement of the enclosing network or subnet.
+func (placement *networkPlacement) inherit(enclosing networkPlacement) {
+	if placement.Account == "" {
+		placement.Account = enclosing.Account
+	}
+	if placement.Region == "" {
+		placement.Region = enclosing.Region
+	}
+	if placement.Network == "" {
+		placement.Network = enclosing.Network
+	}
+}
+
+// AddNetworkView adds groups which arrange the resources of the aws, azurerm and google providers by their network
+// containment: account, subscription or project, region, VPC, VNet or network and subnet. The placement is derived from
+// the attribute values in the planned or current state, e.g. ARNs, Azure resource IDs, self links, vpc_id and subnet_id.
+// Resources are members of the most specific group, so security groups and route tables are attached to their VPC.
+// The groups are children of the root group NetworkViewAddress and exist alongside the module hierarchy. A network view
+// which the node table already contains, e.g. of a karen document, is replaced.
+func AddNetworkView(nodeTable map[string]Node) (map[string]Node, error) {
+	placements := make(map[string]networkPlacement)
+	networks := make(map[string]networkPlacement)
+	subnets := make(map[string]networkPlacement)
+	names := make(map[string]string)
+
+	for _, address := range sortedAddresses(nodeTable) {
+		resource, ok := nodeTable[address].(*Resource)
+		if !ok {
+			continue
+		}
+		parsed, ok := parseResourceAddress(address)
+		if !ok {
+			continue
+		}
+		state := effectiveState(resource)
+		placement, identifiers, isNetwork, isSubnet := placeResource(parsed, state)
+		if placement.Cloud == "" {
+			continue
+		}
+		placements[address] = placement
+		for _, identifier := range identifiers {
+			if isNetwork {
+				networks[networkKey(placement.Cloud, identifier)] = placement
+			}
+			if isSubnet {
+				subnets[networkKey(placement.Cloud, identifier)] = placement
+			}
+		}
+		if isNetwork || isSubnet {
+			names[networkKey(placement.Cloud, identifiers[0])] = networkName(state, identifiers[0])
+		}
+	}
+
+	removeSubtree(nodeTable, NetworkViewAddress)
+	view, err := NewGroup(NetworkViewAddress, Group_kind_network_view, "network")
+	if err != nil {
+		return nil, err
+	}
+	nodeTable[NetworkViewAddress] = view
+
+	for _, address := range sortedAddresses(nodeTable) {
+		placement, ok := placements[address]
+		if !ok {
+			continue
+		}
+		if placement.Subnet != "" {
+			if subnet, ok := subnets[networkKey(placement.Cloud, placement.Subnet)]; ok {
+				placement.inherit(subnet)
+			}
+		}
+		if placement.Network != "" {
+			if network, ok := networks[networkKey(placement.Cloud, placement.Network)]; ok {
+				placement.inherit(network)
+			}
+		}
+		if placement.Account == "" && placement.Region == "" && placement.Network == "" && placement.Subnet == "" {
+			continue
+		}
+
+		levels := networkLevels[placement.Cloud]
+		values := [4]string{placement.Account, placement.Region, placement.Network, placement.Subnet}
+		depth := 2
+		if placement.Subnet != "" {
+			depth = 4
+		} else if placement.Network != "" {
+			depth = 3
+		}
+
+		parent := view
+		for level := 0; level < depth; level++ {
+			value := values[level]
+			name := value
+			if value == "" {
+				value = network_unknown
+				name = network_unknown
+			} else if level >= 2 {
+				if friendlyName, ok := names[networkKey(placement.Cloud, value)]; ok {
+					name = friendlyName
+				}
+			}
+			groupAddress := parent.Address + "." + levels[level] + "[" + strconv.Quote(value) + "]"
+			group, ok := nodeTable[groupAddress].(*Group)
+			if !ok {
+				group, err = NewGroup(groupAddress, levels[level], name)
+				if err != nil {
+					return nil, err
+				}
+				nodeTable[groupAddress] = group
+				parent.AddChild(groupAddress)
+			}
+			parent = group
+		}
+		parent.AddMember(address)
+	}
+	return nodeTable, nil
+}
+
+// placeResource derives the placement of a resource from its state. It additionally returns the identifiers of the
+// resource and whether it is a network or a subnet itself.
+func placeResource(parsed resourceAddress, state map[string]interface{}) (networkPlacement, []string, bool, bool) {
+	placement := networkPlacement{Cloud: providerOfType(parsed.Type)}
+	switch placement.Cloud {
+	case "aws":
+		return placeAWSResource(parsed, state, placement)
+	case "azurerm":
+		return placeAzureResource(parsed, state, placement)
+	case "google":
+		return placeGoogleResource(parsed, state, placement)
+	}
+	return networkPlacement{}, nil, false, false
+}
+
+func placeAWSResource(parsed resourceAddress, state map[string]interface{}, placement networkPlacement) (networkPlacement, []string, bool, bool) {
+	id := stringAttribute(state, "id")
+	if arn := strings.Split(stringAttribute(state, "arn"), ":"); len(arn) >= 5 && arn[0] == "arn" {
+		placement.Region = arn[3]
+		placement.Account = arn[4]
+	}
+	if placement.Account == "" {
+		placement.Account = stringAttribute(state, "owner_id")
+	}
+	if zone := stringAttribute(state, "availability_zone"); placement.Region == "" && len(zone) > 1 {
+		placement.Region = zone[:len(zone)-1]
+	}
+
+	switch parsed.Type {
+	case "aws_vpc", "aws_default_vpc":
+		placement.Network = id
+		return placement, []string{id}, id != "", false
+	case "aws_subnet", "aws_default_subnet":
+		placement.Network = stringAttribute(state, "vpc_id")
+		placement.Subnet = id
+		return placement, []string{id}, false, id != ""
+	}
+	placement.Network = stringAttribute(state, "vpc_id")
+	placement.Subnet = firstStringAttribute(state, "subnet_id", "subnet_ids", "subnets", "vpc_config.subnet_ids")
+	return placement, nil, false, false
+}
+
+func placeAzureResource(parsed resourceAddress, state map[string]interface{}, placement networkPlacement) (networkPlacement, []string, bool, bool) {
+	id := strings.ToLower(stringAttribute(state, "id"))
+	segments := strings.Split(strings.Trim(id, "/"), "/")
+	if len(segments) >= 2 && segments[0] == "subscriptions" {
+		placement.Account = segments[1]
+	}
+	placement.Region = stringAttribute(state, "location")
+
+	switch parsed.Type {
+	case "azurerm_virtual_network":
+		placement.Network = id
+		return placement, []string{id}, id != "", false
+	case "azurerm_subnet":
+		placement.Network = azureVirtualNetworkOf(id)
+		placement.Subnet = id
+		return placement, []string{id}, false, id != ""
+	}
+	placement.Subnet = strings.ToLower(firstStringAttribute(state, "subnet_id", "ip_configuration.subnet_id", "virtual_network_subnet_id"))
+	placement.Network = azureVirtualNetworkOf(placement.Subnet)
+	if placement.Network == "" {
+		placement.Network = strings.ToLower(stringAttribute(state, "virtual_network_id"))
+	}
+	return placement, nil, false, false
+}
+
+// azureVirtualNetworkOf returns the ID of the virtual network of a subnet ID.
+func azureVirtualNetworkOf(subnetID string) string {
+	idx := strings.Index(subnetID, "/subnets/")
+	if idx < 0 {
+		return ""
+	}
+	return subnetID[:idx]
+}
+
+func placeGoogleResource(parsed resourceAddress, state map[string]interface{}, placement networkPlacement) (networkPlacement, []string, bool, bool) {
+	selfLink := googleResourcePath(stringAttribute(state, "self_link"))
+	placement.Account = stringAttribute(state, "project")
+	placement.Region = stringAttribute(state, "region")
+	if zone := stringAttribute(state, "zone"); placement.Region == "" && zone != "" {
+		placement.Region = zone
+		if idx := strings.LastIndex(zone, "-"); idx > 0 {
+			placement.Region = zone[:idx]
+		}
+	}
+
+	switch parsed.Type {
+	case "google_compute_network":
+		placement.Region = "global"
+		placement.Network = selfLink
+		return placement, []string{selfLink}, selfLink != "", false
+	case "google_compute_subnetwork":
+		placement.Network = googleResourcePath(stringAttribute(state, "network"))
+		placement.Subnet = selfLink
+		return placement, []string{selfLink}, false, selfLink != ""
+	}
+	placement.Network = googleResourcePath(firstStringAttribute(state, "network", "network_interface.network"))
+	placement.Subnet = googleResourcePath(firstStringAttribute(state, "subnetwork", "network_interface.subnetwork"))
+	return placement, nil, false, false
+}
+
+// googleResourcePath removes the API endpoint from a self link, so that self links of different API versions match.
+func googleResourcePath(selfLink string) string {
+	if idx := strings.Index(selfLink, "/projects/"); idx >= 0 {
+		return selfLink[idx+1:]
+	}
+	return selfLink
+}
+
+func networkKey(cloud string, identifier string) string {
+	return cloud + " " + identifier
+}
+
+// networkName returns the name of a network or subnet resource, taken from its Name tag or name attribute.
+func networkName(state map[string]interface{}, identifier string) string {
+	if tags, ok := state["tags"].(map[string]interface{}); ok {
+		if name, ok := tags["Name"].(string); ok && name != "" {
+			return name
+		}
+	}
+	if name := stringAttribute(state, "name"); name != "" {
+		return name
+	}
+	return identifier
+}
+
+// stringAttribute returns the top level attribute if it is a string.
+func stringAttribute(state map[string]interface{}, key string) string {
+	value, _ := state[key].(string)
+	return value
+}
+
+// firstStringAttribute returns the first non empty string found under the dotted paths.
+func firstStringAttribute(state map[string]interface{}, paths ...string) string {
+	for _, path := range paths {
+		if text, ok := attributeAt(state, path).(string); ok && text != "" {
+			return text
+		}
+	}
+	return ""
+}
+
+// attributeAt returns the value under a dotted path of the state, or the first element if the value is a list.
+func attributeAt(state map[string]interface{}, path string) interface{} {
+	value, _ := lookupAttribute(state, strings.Split(path, "."))
+	return firstElement(value)
+}
+
+func firstElement(value interface{}) interface{} {
+	if list, ok := value.([]interface{}); ok {
+		if len(list) == 0 {
+			return nil
+		}
+		return list[0]
+	}
+	return value
+}
@@ -0,0 +1,54 @@
+package preprocessor
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAddNetworkViewReplacesExistingView(t *testing.T) {
+	nodeTable := map[string]Node{}
+	add := func(address string, state map[string]interface{}) {
+		resource, _ := NewResource(RootAddress+"."+address, nil)
+		resource.addState(State_current, state)
+		nodeTable[resource.Address] = resource
+	}
+	add("aws_vpc.main", map[string]interface{}{"id": "vpc-1", "arn": "arn:aws:ec2:eu-central-1:123:vpc/vpc-1", "tags": map[string]interface{}{"Name": "main"}})
+	add("aws_subnet.a", map[string]interface{}{"id": "subnet-1", "vpc_id": "vpc-1", "arn": "arn:aws:ec2:eu-central-1:123:subnet/subnet-1"})
+	add("aws_instance.web", map[string]interface{}{"id": "i-1", "subnet_id": "subnet-1", "arn": "arn:aws:ec2:eu-central-1:123:instance/i-1"})
+
+	nodeTable, err := AddNetworkView(nodeTable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := networkViewMembers(nodeTable)
+	if members := first[RootAddress+".aws_instance.web"]; len(members) != 1 {
+		t.Fatalf("got the instance in the groups %v, want it in its subnet group", members)
+	}
+
+	nodeTable, err = AddNetworkView(nodeTable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if second := networkViewMembers(nodeTable); !reflect.DeepEqual(second, first) {
+		t.Errorf("got groups %v after adding the network view again, want %v", second, first)
+	}
+	parents := parentTable(nodeTable)
+	for address, n := range nodeTable {
+		if _, ok := n.(*Group); ok && address != NetworkViewAddress && parents[address] == "" {
+			t.Errorf("the group %s is orphaned", address)
+		}
+	}
+}
+
+// networkViewMembers maps the members of the groups in the network view to the addresses of the groups they are in.
+func networkViewMembers(nodeTable map[string]Node) map[string][]string {
+	members := make(map[string][]string)
+	for _, address := range sortedAddresses(nodeTable) {
+		if group, ok := nodeTable[address].(*Group); ok {
+			for _, member := range group.Members {
+				members[member] = append(members[member], address)
+			}
+		}
+	}
+	return members
+}
@@ -12,11 +12,18 @@ const (
 	Node_type_resource           = "Resource"
 	Node_type_reference_resource = "ReferenceResource"
 	Node_type_provider           = "Provider"
+	Node_type_stack              = "Stack"
+	Node_type_output             = "Output"
+	Node_type_group              = "Group"
+	Node_type_deposed_object     = "DeposedObject"
 )
 
 type Node interface {
 	GetNodeType() string
 	GetAddress() string
+	GetLocation() string
+	GetChildren() []string
+	GetAttributes() map[string]interface{}
 	SetLocation(location string)
 	AddChild(address string)
 	AddAttribute(key string, attribute interface{})
@@ -48,6 +55,18 @@ func (nodeData *node) GetAddress() string {
 	return nodeData.Address
 }
 
+func (nodeData *node) GetLocation() string {
+	return nodeData.Location
+}
+
+func (nodeData *node) GetChildren() []string {
+	return nodeData.Children
+}
+
+func (nodeData *node) GetAttributes() map[string]interface{} {
+	return nodeData.Attributes
+}
+
 func (nodeData *node) SetLocation(location string) {
 	nodeData.Location = location
 }
@@ -64,6 +83,117 @@ func (nodeData *node) MarshalBinary() ([]byte, error) {
 	return json.Marshal(nodeData)
 }
 
+// nodeDataProvider is implemented by all node types, since they embed the node data.
+type nodeDataProvider interface {
+	data() *node
+}
+
+func (nodeData *node) data() *node {
+	return nodeData
+}
+
+// clone returns a copy of the node data with its own children slice and attribute map.
+func (nodeData *node) clone() *node {
+	cloned := *nodeData
+	cloned.Children = append([]string(nil), nodeData.Children...)
+	cloned.Attributes = make(map[string]interface{}, len(nodeData.Attributes))
+	for key, attribute := range nodeData.Attributes {
+		cloned.Attributes[key] = attribute
+	}
+	return &cloned
+}
+
+// cloneNode returns a shallow copy of the given node. Children, attributes, dependencies and actions
+// of the copy can be modified without affecting the original node.
+func cloneNode(n Node) (Node, error) {
+	switch casted := n.(type) {
+	case *Module:
+		return &Module{node: casted.node.clone()}, nil
+	case *Resource:
+		cloned := *casted
+		cloned.node = casted.node.clone()
+		cloned.Dependencies = append([]string(nil), casted.Dependencies...)
+		cloned.Actions = append([]string(nil), casted.Actions...)
+		cloned.SensitiveAttributes = make(map[string][]string, len(casted.SensitiveAttributes))
+		for state, paths := range casted.SensitiveAttributes {
+			cloned.SensitiveAttributes[state] = append([]string(nil), paths...)
+		}
+		cloned.UnknownAttributes = append([]string(nil), casted.UnknownAttributes...)
+		cloned.Edges = append([]Edge(nil), casted.Edges...)
+		cloned.States = make(map[string]map[string]interface{}, len(casted.States))
+		for state, attributes := range casted.States {
+			cloned.States[state] = attributes
+		}
+		return &cloned, nil
+	case *ReferenceResource:
+		cloned := *casted
+		cloned.node = casted.node.clone()
+		cloned.Dependencies = append([]string(nil), casted.Dependencies...)
+		return &cloned, nil
+	case *Provider:
+		return &Provider{node: casted.node.clone()}, nil
+	case *Output:
+		cloned := *casted
+		cloned.node = casted.node.clone()
+		return &cloned, nil
+	case *DeposedObject:
+		resource, err := cloneNode(casted.Resource)
+		if err != nil {
+			return nil, err
+		}
+		return &DeposedObject{Resource: resource.(*Resource), DeposedKey: casted.DeposedKey}, nil
+	case *Group:
+		cloned := *casted
+		cloned.node = casted.node.clone()
+		cloned.Members = append([]string(nil), casted.Members...)
+		return &cloned, nil
+	case *Stack:
+		cloned := *casted
+		cloned.node = casted.node.clone()
+		if casted.Metadata != nil {
+			metadata := *casted.Metadata
+			cloned.Metadata = &metadata
+		}
+		if casted.Backend != nil {
+			backend := *casted.Backend
+			cloned.Backend = &backend
+		}
+		return &cloned, nil
+	default:
+		return nil, fmt.Errorf("cannot clone node of type %T", n)
+	}
+}
+
+// unmarshalNode restores a node of the given node type from its json representation.
+func unmarshalNode(address string, nodeType string, data []byte) (Node, error) {
+	var n Node
+	switch nodeType {
+	case Node_type_module:
+		n, _ = NewModule(address, nil)
+	case Node_type_resource:
+		n, _ = NewResource(address, nil)
+	case Node_type_reference_resource:
+		n, _ = NewReferenceResource(address, nil, nil)
+	case Node_type_provider:
+		n, _ = NewProvider(address, nil)
+	case Node_type_stack:
+		n, _ = NewStack("", nil)
+	case Node_type_output:
+		n, _ = NewOutput(address, false, nil)
+	case Node_type_group:
+		n, _ = NewGroup(address, "", "")
+	case Node_type_deposed_object:
+		n, _ = NewDeposedObject(address, "", nil)
+	default:
+		return nil, fmt.Errorf("unknown node type '%s' of node '%s'", nodeType, address)
+	}
+	err := json.Unmarshal(data, n)
+	if err != nil {
+		return nil, fmt.Errorf("could not unmarshal node '%s': %s", address, err.Error())
+	}
+	return n, nil
+}
+
 // Module represents a terraform module
 type Module struct {
 	*node
@@ -84,6 +214,28 @@ const (
 	Resource_action_created = "created"
 )
 
+// Actions which are performed on a resource when a plan is applied
+const (
+	Action_create                = "Create"
+	Action_create_before_destroy = "CreateBeforeDestroy"
+	Action_delete                = "Delete"
+	Action_destroy_before_create = "DestroyBeforeCreate"
+	Action_import                = "Import"
+	Action_move                  = "Move"
+	Action_no_op                 = "NoOp"
+	Action_read                  = "Read"
+	Action_replace               = "Replace"
+	Action_update                = "Update"
+)
+
+// Statuses of a resource instance
+const (
+	// Instance_status_tainted marks an instance whose creation failed or which was tainted by the user, so the next apply replaces it
+	Instance_status_tainted = "Tainted"
+	// Instance_status_deposed is the status of a DeposedObject, which the query language matches like a status of an instance
+	Instance_status_deposed = "Deposed"
+)
+
 const (
 	State_current = "Current_State"
 	State_planned = "Planned_State"
@@ -102,6 +254,44 @@ type Resource struct {
 	Actions []string `json:"actions,omitempty"`
 	// States contain the attributes of a resource that are associated with a specific state
 	States map[string]map[string]interface{} `json:"states,omitempty"`
+	// SensitiveAttributes contain the paths of the attributes that were removed from a state because they are sensitive
+	SensitiveAttributes map[string][]string `json:"sensitiveAttributes,omitempty"`
+	// UnknownAttributes contain the paths of the attributes of the planned state which are only known after apply
+	UnknownAttributes []string `json:"unknownAttributes,omitempty"`
+	// Edges contain relationships to other nodes which terraform does not record as dependencies
+	Edges []Edge `json:"edges,omitempty"`
+	// Provider is the source address of the provider which manages the resource, e.g. registry.terraform.io/hashicorp/aws
+	Provider string `json:"provider,omitempty"`
+	// SchemaKey is the key of the schema of the resource type in the schemas of the document, if provider schemas were given
+	SchemaKey string `json:"schemaKey,omitempty"`
+	// PreviousAddress is the address the resource had before the plan moves it to its address
+	PreviousAddress string `json:"previousAddress,omitempty"`
+	// ImportID is the ID by which the plan imports the resource
+	ImportID string `json:"importId,omitempty"`
+	// Status is the status of the instance, e.g. Instance_status_tainted, or empty if the instance is ready
+	Status string `json:"status,omitempty"`
+}
+
+// Kinds of edges
+const (
+	// Edge_kind_remote_state links a resource to the outputs of another stack which it reads via terraform_remote_state
+	Edge_kind_remote_state = "remote_state"
+	// Edge_kind_inferred links a resource to another resource whose identifier occurs in its attributes
+	Edge_kind_inferred = "inferred"
+	// Edge_kind_iam links an IAM role, user or group to a resource on which its policies allow actions
+	Edge_kind_iam = "iam"
+	// Edge_kind_assumes_role links a resource like a lambda function to the IAM role it assumes
+	Edge_kind_assumes_role = "assumes_role"
+)
+
+// Edge is a relationship from a resource to another node which was derived by the preprocessor.
+type Edge struct {
+	To   string `json:"to"`
+	Kind string `json:"kind"`
+	// Reason describes why the edge exists, e.g. the terraform_remote_state data source it was derived from
+	Reason string `json:"reason,omitempty"`
+	// Actions are the IAM actions an edge of kind Edge_kind_iam allows
+	Actions []string `json:"actions,omitempty"`
 }
 
 func NewResource(
@@ -126,19 +316,25 @@ func (resource *Resource) removeSensitiveValues(stateName string, sensitiveValue
 	var remove func(interface{}, []string) error
 	remove = func(state interface{}, key []string) error {
 		currentKey := key[0]
+		if state == nil {
+			// the value is not set, so there is nothing to remove
+			return nil
+		}
 		if len(key) == 1 {
 			switch casted := state.(type) {
 			case map[string]interface{}:
 				delete(casted, currentKey)
-				state = casted
 			case []interface{}:
-				idx, err := strconv.Atoi(currentKey)
+				// list elements are replaced instead of removed to keep the indices of the other elements
+				idx, err := strconv.Atoi(strings.Trim(currentKey, "[]"))
 				if err != nil {
 					return err
 				}
-				state = append(casted[:idx], casted[idx+1:]...)
+				if idx < len(casted) {
+					casted[idx] = nil
+				}
 			default:
-				return fmt.Errorf("cannot remove value from type %t", casted)
+				return fmt.Errorf("cannot remove value from type %T", casted)
 			}
 		} else {
 			if strings.HasPrefix(currentKey, "[") && strings.HasSuffix(currentKey, "]") {
@@ -146,10 +342,13 @@ func (resource *Resource) removeSensitiveValues(stateName string, sensitiveValue
 				if !ok {
 					return fmt.Errorf("cannot cast variable of type %T to type %T", state, nested)
 				}
-				idx, err := strconv.Atoi(currentKey)
+				idx, err := strconv.Atoi(strings.Trim(currentKey, "[]"))
 				if err != nil {
 					return err
 				}
+				if idx >= len(nested) {
+					return nil
+				}
 				next := nested[idx]
 				return remove(next, key[1:])
 			} else {
@@ -192,6 +391,7 @@ func (resource *Resource) removeSensitiveValues(stateName string, sensitiveValue
 				if err != nil {
 					return err
 				}
+				resource.addSensitiveAttribute(stateName, strings.ReplaceAll(key, ".[", "["))
 			}
 			return nil
 		default:
@@ -213,6 +413,34 @@ func (resource *Resource) addAction(action string) {
 	resource.Actions = append(resource.Actions, action)
 }
 
+// HasAction reports whether the given action is performed on the resource.
+func (resource *Resource) HasAction(action string) bool {
+	for _, resourceAction := range resource.Actions {
+		if resourceAction == action {
+			return true
+		}
+	}
+	return false
+}
+
+// addEdge adds the edge to the resource unless the resource already has an edge of the same kind to the same node.
+func (resource *Resource) addEdge(edge Edge) {
+	for _, existing := range resource.Edges {
+		if existing.To == edge.To && existing.Kind == edge.Kind {
+			return
+		}
+	}
+	resource.Edges = append(resource.Edges, edge)
+}
+
+// addSensitiveAttribute records that the attribute with the given path was removed from the state.
+func (resource *Resource) addSensitiveAttribute(state string, path string) {
+	if resource.SensitiveAttributes == nil {
+		resource.SensitiveAttributes = make(map[string][]string)
+	}
+	resource.SensitiveAttributes[state] = append(resource.SensitiveAttributes[state], path)
+}
+
 func (resource *Resource) MarshalBinary() ([]byte, error) {
 	return json.Marshal(resource)
 }
@@ -251,3 +479,117 @@ func NewProvider(
 func (provider *Provider) MarshalBinary() ([]byte, error) {
 	return json.Marshal(provider)
 }
+
+// Output represents an output value of a root module
+type Output struct {
+	*node
+	Sensitive bool `json:"sensitive,omitempty"`
+	// Value is omitted for sensitive outputs
+	Value interface{} `json:"value,omitempty"`
+}
+
+func NewOutput(
+	address string,
+	sensitive bool,
+	value interface{},
+) (*Output, error) {
+	output := new(Output)
+	output.node = newNodeData(address, Node_type_output, nil)
+	output.Sensitive = sensitive
+	if !sensitive {
+		output.Value = value
+	}
+	return output, nil
+}
+
+func (output *Output) MarshalBinary() ([]byte, error) {
+	return json.Marshal(output)
+}
+
+// DeposedObject is a remote object of a resource instance which was replaced with create before destroy, but whose
+// deletion failed or is pending. It is a child of the resource instance and its address is the address of the instance
+// followed by .deposed. and the deposed key.
+type DeposedObject struct {
+	*Resource
+	DeposedKey string `json:"deposedKey"`
+}
+
+func NewDeposedObject(
+	resourceAddress string,
+	deposedKey string,
+	dependencies []string,
+) (*DeposedObject, error) {
+	resource, err := NewResource(DeposedObjectAddress(resourceAddress, deposedKey), dependencies)
+	if err != nil {
+		return nil, err
+	}
+	resource.NodeType = Node_type_deposed_object
+	deposedObject := new(DeposedObject)
+	deposedObject.Resource = resource
+	deposedObject.DeposedKey = deposedKey
+	return deposedObject, nil
+}
+
+// DeposedObjectAddress returns the address of the deposed object with the given key of a resource instance.
+func DeposedObjectAddress(resourceAddress string, deposedKey string) string {
+	return resourceAddress + ".deposed." + deposedKey
+}
+
+func (deposedObject *DeposedObject) MarshalBinary() ([]byte, error) {
+	return json.Marshal(deposedObject)
+}
+
+// Stack represents the root module of one of several node tables which were merged into one, e.g. a workspace.
+type Stack struct {
+	*node
+	Name string `json:"name"`
+	// Metadata describes the input the nodes of the stack were generated from
+	Metadata *DocumentMetadata `json:"metadata,omitempty"`
+	// Backend describes where the state of the stack is stored. It is used to resolve terraform_remote_state data sources of other stacks.
+	Backend *StateBackend `json:"backend,omitempty"`
+}
+
+func NewStack(
+	name string,
+	metadata *DocumentMetadata,
+) (*Stack, error) {
+	stack := new(Stack)
+	stack.node = newNodeData(StackAddress(name), Node_type_stack, nil)
+	stack.Name = name
+	stack.Metadata = metadata
+	return stack, nil
+}
+
+func (stack *Stack) MarshalBinary() ([]byte, error) {
+	return json.Marshal(stack)
+}
+
+// Group is a virtual node which groups nodes by another criterion than the module hierarchy, e.g. their network.
+// Its children are nested groups and its members are the grouped nodes.
+type Group struct {
+	*node
+	Kind    string   `json:"kind"`
+	Name    string   `json:"name"`
+	Members []string `json:"members,omitempty"`
+}
+
+func NewGroup(
+	address string,
+	kind string,
+	name string,
+) (*Group, error) {
+	group := new(Group)
+	group.node = newNodeData(address, Node_type_group, nil)
+	group.Kind = kind
+	group.Name = name
+	return group, nil
+}
+
+// AddMember adds the node with the given address to the group.
+func (group *Group) AddMember(address string) {
+	group.Members = append(group.Members, address)
+}
+
+func (group *Group) MarshalBinary() ([]byte, error) {
+	return json.Marshal(group)
+}
@@ -0,0 +1,102 @@
+package preprocessor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Overlay attaches user supplied metadata like runbook links, criticality or cost centers to the nodes of a node table.
+type Overlay struct {
+	Entries []OverlayEntry `json:"entries"`
+}
+
+// OverlayEntry attaches the attributes to the nodes whose address matches the pattern. Patterns are terraform
+// addresses like module.payments.aws_db_instance.main in which * matches any characters and ? a single character.
+// Nodes of merged stacks can additionally be matched as stack:address.
+type OverlayEntry struct {
+	Match      string                 `json:"match"`
+	Attributes map[string]interface{} `json:"attributes"`
+
+	glob *regexp.Regexp
+}
+
+// OverlayReport lists how many nodes every pattern of an overlay matched.
+type OverlayReport struct {
+	Matches map[string]int `json:"matches"`
+	// Unmatched contains the patterns which matched no node
+	Unmatched []string `json:"unmatched,omitempty"`
+}
+
+// ParseOverlay takes a json formatted overlay file like
+//
+//	{"entries": [{"match": "module.payments.*", "attributes": {"criticality": "high"}}]}
+//
+// and validates it.
+func ParseOverlay(data []byte) (*Overlay, error) {
+	overlay := new(Overlay)
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(overlay)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't parse the given overlay file: %s", err.Error())
+	}
+	for idx := range overlay.Entries {
+		entry := &overlay.Entries[idx]
+		if entry.Match == "" {
+			return nil, fmt.Errorf("overlay entry %d has no match pattern", idx+1)
+		}
+		if len(entry.Attributes) == 0 {
+			return nil, fmt.Errorf("overlay entry '%s' has no attributes", entry.Match)
+		}
+		entry.glob = compileGlob(entry.Match)
+	}
+	return overlay, nil
+}
+
+// isExact reports whether the pattern of the entry matches a single address.
+func (entry *OverlayEntry) isExact() bool {
+	return !strings.ContainsAny(entry.Match, "*?")
+}
+
+// ApplyOverlay adds the attributes of the overlay entries to the matching nodes with AddAttribute. If several entries set
+// the same attribute of a node, entries without wildcards take precedence over entries with wildcards, and later entries
+// over earlier ones. Overlay attributes replace attributes of the same name which the preprocessor added.
+func ApplyOverlay(nodeTable map[string]Node, overlay *Overlay) *OverlayReport {
+	report := &OverlayReport{Matches: make(map[string]int)}
+	entries := make([]*OverlayEntry, len(overlay.Entries))
+	for idx := range overlay.Entries {
+		entries[idx] = &overlay.Entries[idx]
+		report.Matches[entries[idx].Match] = 0
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return !entries[i].isExact() && entries[j].isExact()
+	})
+
+	addresses := sortedAddresses(nodeTable)
+	for _, entry := range entries {
+		for _, address := range addresses {
+			terraformAddress := TerraformAddress(address)
+			if terraformAddress == "" {
+				terraformAddress = address
+			}
+			if !entry.glob.MatchString(terraformAddress) && !entry.glob.MatchString(displayAddress(address)) {
+				continue
+			}
+			report.Matches[entry.Match]++
+			for key, value := range entry.Attributes {
+				nodeTable[address].AddAttribute(key, value)
+			}
+		}
+	}
+
+	for _, entry := range overlay.Entries {
+		if report.Matches[entry.Match] == 0 {
+			report.Unmatched = appendUnique(report.Unmatched, entry.Match)
+		}
+	}
+	return report
+}
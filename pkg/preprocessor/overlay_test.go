@@ -0,0 +1,64 @@
+package preprocessor
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestApplyOverlay(t *testing.T) {
+	nodeTable := newTestPlan(t, map[string][]string{
+		"module.payments.aws_db_instance.main": nil,
+		"module.payments.aws_s3_bucket.logs":   nil,
+	})
+	overlay, err := ParseOverlay([]byte(`{"entries": [
+		{"match": "module.payments.aws_db_instance.main", "attributes": {"criticality": "critical"}},
+		{"match": "module.payments.*", "attributes": {"criticality": "high", "team": "payments"}},
+		{"match": "module.payments.aws_*", "attributes": {"team": "billing"}},
+		{"match": "aws_rds_cluster.*", "attributes": {"notes": "none"}}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	report := ApplyOverlay(nodeTable, overlay)
+
+	tests := []struct {
+		address    string
+		attributes map[string]interface{}
+	}{
+		{address: "module.payments.aws_db_instance.main", attributes: map[string]interface{}{"criticality": "critical", "team": "billing"}},
+		{address: "module.payments.aws_s3_bucket.logs", attributes: map[string]interface{}{"criticality": "high", "team": "billing"}},
+	}
+	for _, test := range tests {
+		attributes := nodeTable[RootAddress+"."+test.address].GetAttributes()
+		for key, want := range test.attributes {
+			if attributes[key] != want {
+				t.Errorf("got %s %v of %s, want %v", key, attributes[key], test.address, want)
+			}
+		}
+	}
+
+	wantMatches := map[string]int{
+		"module.payments.aws_db_instance.main": 1,
+		"module.payments.*":                    2,
+		"module.payments.aws_*":                2,
+		"aws_rds_cluster.*":                    0,
+	}
+	if !reflect.DeepEqual(report.Matches, wantMatches) {
+		t.Errorf("got matches %v, want %v", report.Matches, wantMatches)
+	}
+	if !reflect.DeepEqual(report.Unmatched, []string{"aws_rds_cluster.*"}) {
+		t.Errorf("got unmatched patterns %v", report.Unmatched)
+	}
+}
+
+func TestParseOverlayRejectsInvalidEntries(t *testing.T) {
+	for _, data := range []string{
+		`{"entries": [{"attributes": {"a": "b"}}]}`,
+		`{"entries": [{"match": "*"}]}`,
+		`{"entries": [{"match": "*", "attributes": {"a": "b"}, "unknown": true}]}`,
+	} {
+		if _, err := ParseOverlay([]byte(data)); err == nil {
+			t.Errorf("parsed the invalid overlay %s", data)
+		}
+	}
+}
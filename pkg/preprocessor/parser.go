@@ -2,6 +2,7 @@ package preprocessor
 
 import (
 	"encoding/json"
+	"sort"
 	"strings"
 
 	tfjson "github.com/hashicorp/terraform-json"
@@ -37,53 +38,139 @@ func parseTfjsonStateModule(tfjsonModule *tfjson.StateModule, nodeTable map[stri
 }
 
 func parseTfjsonStateResource(tfjsonResources []*tfjson.StateResource, nodeTable map[string]Node, state string, parent string) (map[string]Node, error) {
+	var deposedResources []*tfjson.StateResource
 	for _, tfjsonRessource := range tfjsonResources {
-
-		var dependencies []string
-		for _, dependency := range tfjsonRessource.DependsOn {
-			dependencyAddress := RootAddress + "." + dependency
-			dependencies = append(dependencies, dependencyAddress)
+		if tfjsonRessource.DeposedKey != "" {
+			// deposed objects share the address of the current instance, so they are added as its children afterwards
+			deposedResources = append(deposedResources, tfjsonRessource)
+			continue
 		}
 
+		dependencies := stateResourceDependencies(tfjsonRessource)
 		resource, err := NewResource(RootAddress+"."+tfjsonRessource.Address, dependencies)
 		if err != nil {
 			return nil, err
 		}
-		resource.addState(state, tfjsonRessource.AttributeValues)
+		resource.Provider = tfjsonRessource.ProviderName
+		err = addStateFromStateResource(tfjsonRessource, resource, state)
+		if err != nil {
+			return nil, err
+		}
+		if tfjsonRessource.Tainted {
+			resource.Status = Instance_status_tainted
+		}
+		err = addResourceToParent(nodeTable, resource, parent)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-		if tfjsonRessource.SensitiveValues != nil {
-			var sensitiveValues map[string]interface{}
-			jsonData, err := tfjsonRessource.SensitiveValues.MarshalJSON()
+	for _, tfjsonRessource := range deposedResources {
+		dependencies := stateResourceDependencies(tfjsonRessource)
+		address := RootAddress + "." + tfjsonRessource.Address
+		node, ok := nodeTable[address]
+		if !ok {
+			// the current instance was deleted or never created, only its deposed objects are left
+			resource, err := NewResource(address, dependencies)
 			if err != nil {
 				return nil, err
 			}
-			err = json.Unmarshal(jsonData, &sensitiveValues)
+			resource.Provider = tfjsonRessource.ProviderName
+			err = addResourceToParent(nodeTable, resource, parent)
 			if err != nil {
 				return nil, err
 			}
-			err = resource.removeSensitiveValues(state, sensitiveValues)
+			node = resource
+		}
+		deposedObject, err := NewDeposedObject(address, tfjsonRessource.DeposedKey, dependencies)
+		if err != nil {
+			return nil, err
+		}
+		deposedObject.Provider = tfjsonRessource.ProviderName
+		err = addStateFromStateResource(tfjsonRessource, deposedObject.Resource, state)
+		if err != nil {
+			return nil, err
+		}
+		node.AddChild(deposedObject.Address)
+		nodeTable[deposedObject.Address] = deposedObject
+	}
+	return nodeTable, nil
+}
+
+func stateResourceDependencies(tfjsonRessource *tfjson.StateResource) []string {
+	var dependencies []string
+	for _, dependency := range tfjsonRessource.DependsOn {
+		dependencyAddress := RootAddress + "." + dependency
+		dependencies = append(dependencies, dependencyAddress)
+	}
+	return dependencies
+}
+
+// addStateFromStateResource adds the attribute values of the state resource without its sensitive values as the given state.
+func addStateFromStateResource(tfjsonRessource *tfjson.StateResource, resource *Resource, state string) error {
+	resource.addState(state, tfjsonRessource.AttributeValues)
+
+	if tfjsonRessource.SensitiveValues != nil {
+		var sensitiveValues map[string]interface{}
+		jsonData, err := tfjsonRessource.SensitiveValues.MarshalJSON()
+		if err != nil {
+			return err
+		}
+		err = json.Unmarshal(jsonData, &sensitiveValues)
+		if err != nil {
+			return err
+		}
+		err = resource.removeSensitiveValues(state, sensitiveValues)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addResourceToParent adds the resource to the node table as a child of its parent module. Instances of resources with
+// count or for_each become children of a reference resource, which is created with the first instance.
+func addResourceToParent(nodeTable map[string]Node, resource *Resource, parent string) error {
+	if strings.HasSuffix(resource.Address, "]") {
+		splittedAddress := strings.Split(resource.Address, "[")
+		referenceResourceAddress := strings.Join(splittedAddress[0:len(splittedAddress)-1], "[")
+
+		if referenceResource, containsReferenceResource := nodeTable[referenceResourceAddress]; containsReferenceResource {
+			referenceResource.AddChild(resource.Address)
+		} else {
+			referenceResource, err := NewReferenceResource(referenceResourceAddress, []string{resource.Address}, resource.Dependencies)
 			if err != nil {
-				return nil, err
+				return err
 			}
+			nodeTable[referenceResource.Address] = referenceResource
+			nodeTable[parent].AddChild(referenceResource.Address)
 		}
-		if strings.HasSuffix(resource.Address, "]") {
-			splittedAddress := strings.Split(resource.Address, "[")
-			referenceResourceAddress := strings.Join(splittedAddress[0:len(splittedAddress)-1], "[")
-
-			if referenceResource, containsReferenceResource := nodeTable[referenceResourceAddress]; containsReferenceResource {
-				referenceResource.AddChild(resource.Address)
-			} else {
-				referenceResource, err := NewReferenceResource(referenceResourceAddress, []string{resource.Address}, dependencies)
-				if err != nil {
-					return nil, err
-				}
-				nodeTable[referenceResource.Address] = referenceResource
-				nodeTable[parent].AddChild(referenceResource.Address)
-			}
-		} else {
-			nodeTable[parent].AddChild(resource.Address)
+	} else {
+		nodeTable[parent].AddChild(resource.Address)
+	}
+	nodeTable[resource.Address] = resource
+	return nil
+}
+
+// parseTfjsonStateOutputs adds the outputs of the root module as children of the root module. Values of sensitive outputs are omitted.
+func parseTfjsonStateOutputs(tfjsonOutputs map[string]*tfjson.StateOutput, nodeTable map[string]Node) (map[string]Node, error) {
+	names := make([]string, 0, len(tfjsonOutputs))
+	for name := range tfjsonOutputs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		tfjsonOutput := tfjsonOutputs[name]
+		if tfjsonOutput == nil {
+			continue
+		}
+		output, err := NewOutput(RootAddress+".output."+name, tfjsonOutput.Sensitive, tfjsonOutput.Value)
+		if err != nil {
+			return nil, err
 		}
-		nodeTable[resource.Address] = resource
+		nodeTable[output.Address] = output
+		nodeTable[RootAddress].AddChild(output.Address)
 	}
 	return nodeTable, nil
 }
@@ -0,0 +1,523 @@
+package preprocessor
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	Severity_info     = "info"
+	Severity_low      = "low"
+	Severity_medium   = "medium"
+	Severity_high     = "high"
+	Severity_critical = "critical"
+)
+
+// Attribute_findings is the node attribute under which the policy findings of a resource are stored.
+const Attribute_findings = "findings"
+
+// severityLevels orders the severities from the least to the most severe.
+var severityLevels = map[string]int{
+	Severity_info:     0,
+	Severity_low:      1,
+	Severity_medium:   2,
+	Severity_high:     3,
+	Severity_critical: 4,
+}
+
+// Operators of policy conditions
+const (
+	Policy_operator_exists       = "exists"
+	Policy_operator_not_exists   = "not_exists"
+	Policy_operator_empty        = "empty"
+	Policy_operator_not_empty    = "not_empty"
+	Policy_operator_equals       = "equals"
+	Policy_operator_not_equals   = "not_equals"
+	Policy_operator_contains     = "contains"
+	Policy_operator_not_contains = "not_contains"
+	Policy_operator_in           = "in"
+	Policy_operator_matches      = "matches"
+	Policy_operator_gt           = "gt"
+	Policy_operator_gte          = "gte"
+	Policy_operator_lt           = "lt"
+	Policy_operator_lte          = "lte"
+)
+
+// PolicySet is a set of declarative rules which resources have to satisfy. Policy sets are read from json files
+// of the following format:
+//
+//	{
+//	  "rules": [
+//	    {
+//	      "id": "s3-encryption",
+//	      "description": "every aws_s3_bucket must have server-side encryption",
+//	      "severity": "high",
+//	      "resourceTypes": ["aws_s3_bucket"],
+//	      "assert": {"attribute": "server_side_encryption_configuration", "operator": "not_empty"}
+//	    },
+//	    {
+//	      "id": "no-public-ssh",
+//	      "description": "no security group ingress from 0.0.0.0/0 on port 22",
+//	      "severity": "critical",
+//	      "resourceTypes": ["aws_security_group"],
+//	      "filter": "tags.env == prod",
+//	      "assert": {"not": {"attribute": "ingress", "some": {"all": [
+//	        {"attribute": "cidr_blocks", "operator": "contains", "value": "0.0.0.0/0"},
+//	        {"attribute": "from_port", "operator": "lte", "value": 22},
+//	        {"attribute": "to_port", "operator": "gte", "value": 22}
+//	      ]}}}
+//	    }
+//	  ],
+//	  "exemptions": [
+//	    {"address": "aws_s3_bucket.public_assets", "rules": ["s3-encryption"], "reason": "served by the CDN"}
+//	  ]
+//	}
+//
+// A rule applies to all resources whose type matches one of the globs in resourceTypes and which match the optional
+// filter, a query expression as described for Query, which is evaluated on the same state as the rules. If neither is given, the rule applies to all resources.
+// The severity is one of info, low, medium, high or critical.
+//
+// The assert condition must hold for every resource a rule applies to. A condition is one of
+//   - {"attribute": path, "operator": operator, "value": value} which compares the attribute at the dotted path with
+//     the operators exists, not_exists, empty, not_empty, equals, not_equals, contains, not_contains, in, matches (regular expression),
+//     gt, gte, lt or lte. An empty path refers to the value the condition is evaluated on.
+//   - {"attribute": path, "some": condition} or {"attribute": path, "every": condition} which evaluate the condition on the
+//     elements of the list at path. Attributes of nested conditions are relative to the list element.
+//   - {"all": [conditions]}, {"any": [conditions]} and {"not": condition}
+//
+// Exemptions skip the rules with the given ids, or all rules if none are given, for the resources whose terraform address matches the address glob.
+type PolicySet struct {
+	Rules      []PolicyRule      `json:"rules"`
+	Exemptions []PolicyExemption `json:"exemptions,omitempty"`
+}
+
+// PolicyRule is a single rule of a policy set.
+type PolicyRule struct {
+	ID            string           `json:"id"`
+	Description   string           `json:"description,omitempty"`
+	Severity      string           `json:"severity"`
+	ResourceTypes []string         `json:"resourceTypes,omitempty"`
+	Filter        string           `json:"filter,omitempty"`
+	Assert        *PolicyCondition `json:"assert"`
+
+	resourceTypes []*regexp.Regexp
+	filter        *Query
+}
+
+// PolicyCondition is a condition which is evaluated on the attributes of a resource.
+type PolicyCondition struct {
+	Attribute string             `json:"attribute,omitempty"`
+	Operator  string             `json:"operator,omitempty"`
+	Value     interface{}        `json:"value,omitempty"`
+	Some      *PolicyCondition   `json:"some,omitempty"`
+	Every     *PolicyCondition   `json:"every,omitempty"`
+	All       []*PolicyCondition `json:"all,omitempty"`
+	Any       []*PolicyCondition `json:"any,omitempty"`
+	Not       *PolicyCondition   `json:"not,omitempty"`
+
+	regexp *regexp.Regexp
+}
+
+// PolicyExemption exempts resources from rules.
+type PolicyExemption struct {
+	Address string   `json:"address"`
+	Rules   []string `json:"rules,omitempty"`
+	Reason  string   `json:"reason,omitempty"`
+
+	address *regexp.Regexp
+}
+
+// PolicyFinding is the result of a rule that does not hold for a resource.
+type PolicyFinding struct {
+	Rule        string `json:"rule"`
+	Severity    string `json:"severity"`
+	Description string `json:"description,omitempty"`
+	Address     string `json:"address"`
+	State       string `json:"state"`
+	// Exempted is set if the resource is exempted from the rule
+	Exempted bool   `json:"exempted,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+}
+
+// PolicyReport contains the findings of evaluating a policy set on a node table.
+type PolicyReport struct {
+	State     string          `json:"state"`
+	Evaluated int             `json:"evaluated"`
+	Findings  []PolicyFinding `json:"findings,omitempty"`
+}
+
+// ParsePolicySet takes a json formatted policy set and validates it.
+func ParsePolicySet(data []byte) (*PolicySet, error) {
+	policySet := new(PolicySet)
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(policySet)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't parse the given policy set: %s", err.Error())
+	}
+
+	ids := make(map[string]bool)
+	for idx := range policySet.Rules {
+		rule := &policySet.Rules[idx]
+		if rule.ID == "" {
+			return nil, fmt.Errorf("rule %d has no id", idx+1)
+		}
+		if ids[rule.ID] {
+			return nil, fmt.Errorf("rule id '%s' is not unique", rule.ID)
+		}
+		ids[rule.ID] = true
+		if _, ok := severityLevels[rule.Severity]; !ok {
+			return nil, fmt.Errorf("rule '%s' has the unknown severity '%s'", rule.ID, rule.Severity)
+		}
+		if rule.Assert == nil {
+			return nil, fmt.Errorf("rule '%s' has no assert condition", rule.ID)
+		}
+		err = rule.Assert.compile()
+		if err != nil {
+			return nil, fmt.Errorf("rule '%s': %s", rule.ID, err.Error())
+		}
+		rule.resourceTypes = compileGlobs(rule.ResourceTypes)
+		if rule.Filter != "" {
+			rule.filter, err = ParseQuery(rule.Filter)
+			if err != nil {
+				return nil, fmt.Errorf("rule '%s': %s", rule.ID, err.Error())
+			}
+		}
+	}
+	for idx := range policySet.Exemptions {
+		exemption := &policySet.Exemptions[idx]
+		if exemption.Address == "" {
+			return nil, fmt.Errorf("exemption %d has no address", idx+1)
+		}
+		for _, id := range exemption.Rules {
+			if !ids[id] {
+				return nil, fmt.Errorf("exemption for '%s' refers to the unknown rule '%s'", exemption.Address, id)
+			}
+		}
+		exemption.address = compileGlob(exemption.Address)
+	}
+	return policySet, nil
+}
+
+// compile validates the condition and compiles its regular expressions.
+func (condition *PolicyCondition) compile() error {
+	set := 0
+	for _, isSet := range []bool{condition.Operator != "", condition.Some != nil, condition.Every != nil, condition.All != nil, condition.Any != nil, condition.Not != nil} {
+		if isSet {
+			set++
+		}
+	}
+	if set != 1 {
+		return fmt.Errorf("a condition needs exactly one of operator, some, every, all, any or not")
+	}
+
+	switch {
+	case condition.Some != nil:
+		return condition.Some.compile()
+	case condition.Every != nil:
+		return condition.Every.compile()
+	case condition.Not != nil:
+		return condition.Not.compile()
+	case condition.All != nil || condition.Any != nil:
+		for _, nested := range append(condition.All, condition.Any...) {
+			err := nested.compile()
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	switch condition.Operator {
+	case Policy_operator_exists, Policy_operator_not_exists, Policy_operator_empty, Policy_operator_not_empty:
+	case Policy_operator_equals, Policy_operator_not_equals, Policy_operator_contains, Policy_operator_not_contains:
+	case Policy_operator_in:
+		if _, ok := condition.Value.([]interface{}); !ok {
+			return fmt.Errorf("operator 'in' of attribute '%s' requires a list value", condition.Attribute)
+		}
+	case Policy_operator_matches:
+		pattern, ok := condition.Value.(string)
+		if !ok {
+			return fmt.Errorf("operator 'matches' of attribute '%s' requires a string value", condition.Attribute)
+		}
+		var err error
+		condition.regexp, err = regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid regular expression of attribute '%s': %s", condition.Attribute, err.Error())
+		}
+	case Policy_operator_gt, Policy_operator_gte, Policy_operator_lt, Policy_operator_lte:
+		if _, ok := condition.Value.(float64); !ok {
+			return fmt.Errorf("operator '%s' of attribute '%s' requires a numeric value", condition.Operator, condition.Attribute)
+		}
+	default:
+		return fmt.Errorf("unknown operator '%s'", condition.Operator)
+	}
+	return nil
+}
+
+// lookupPolicyAttribute returns the value at the dotted path. An empty path refers to the value itself.
+func lookupPolicyAttribute(value interface{}, path string) (interface{}, bool) {
+	if path == "" {
+		return value, true
+	}
+	return lookupAttribute(value, strings.Split(path, "."))
+}
+
+// evaluate reports whether the condition holds for the given value.
+func (condition *PolicyCondition) evaluate(value interface{}) bool {
+	switch {
+	case condition.Not != nil:
+		return !condition.Not.evaluate(value)
+	case condition.All != nil:
+		for _, nested := range condition.All {
+			if !nested.evaluate(value) {
+				return false
+			}
+		}
+		return true
+	case condition.Any != nil:
+		for _, nested := range condition.Any {
+			if nested.evaluate(value) {
+				return true
+			}
+		}
+		return false
+	}
+
+	attribute, ok := lookupPolicyAttribute(value, condition.Attribute)
+	exists := ok && attribute != nil
+
+	switch {
+	case condition.Some != nil:
+		elements, _ := attribute.([]interface{})
+		for _, element := range elements {
+			if condition.Some.evaluate(element) {
+				return true
+			}
+		}
+		return false
+	case condition.Every != nil:
+		elements, _ := attribute.([]interface{})
+		for _, element := range elements {
+			if !condition.Every.evaluate(element) {
+				return false
+			}
+		}
+		return true
+	}
+
+	switch condition.Operator {
+	case Policy_operator_exists:
+		return exists
+	case Policy_operator_not_exists:
+		return !exists
+	case Policy_operator_empty:
+		return isEmptyValue(attribute)
+	case Policy_operator_not_empty:
+		return !isEmptyValue(attribute)
+	case Policy_operator_equals:
+		return exists && reflect.DeepEqual(attribute, condition.Value)
+	case Policy_operator_not_equals:
+		return !exists || !reflect.DeepEqual(attribute, condition.Value)
+	case Policy_operator_contains:
+		return containsValue(attribute, condition.Value)
+	case Policy_operator_not_contains:
+		return !containsValue(attribute, condition.Value)
+	case Policy_operator_in:
+		return exists && containsValue(condition.Value, attribute)
+	case Policy_operator_matches:
+		text, ok := attribute.(string)
+		return ok && condition.regexp.MatchString(text)
+	case Policy_operator_gt, Policy_operator_gte, Policy_operator_lt, Policy_operator_lte:
+		number, ok := attribute.(float64)
+		if !ok {
+			return false
+		}
+		expected := condition.Value.(float64)
+		switch condition.Operator {
+		case Policy_operator_gt:
+			return number > expected
+		case Policy_operator_gte:
+			return number >= expected
+		case Policy_operator_lt:
+			return number < expected
+		default:
+			return number <= expected
+		}
+	}
+	return false
+}
+
+func isEmptyValue(value interface{}) bool {
+	switch casted := value.(type) {
+	case nil:
+		return true
+	case string:
+		return casted == ""
+	case []interface{}:
+		return len(casted) == 0
+	case map[string]interface{}:
+		return len(casted) == 0
+	default:
+		return false
+	}
+}
+
+// containsValue reports whether the list contains the value or the string contains the substring.
+func containsValue(container interface{}, value interface{}) bool {
+	switch casted := container.(type) {
+	case []interface{}:
+		for _, element := range casted {
+			if reflect.DeepEqual(element, value) {
+				return true
+			}
+		}
+	case map[string]interface{}:
+		key, ok := value.(string)
+		if ok {
+			_, ok = casted[key]
+		}
+		return ok
+	case string:
+		substring, ok := value.(string)
+		return ok && strings.Contains(casted, substring)
+	}
+	return false
+}
+
+// appliesTo reports whether the rule applies to the resource in the given state. The filter only sees the attributes
+// of that state, so that it does not filter on planned values while the assertion checks current ones.
+func (rule *PolicyRule) appliesTo(resource *Resource, state string) bool {
+	if len(rule.resourceTypes) > 0 {
+		parsed, ok := parseResourceAddress(resource.Address)
+		if !ok {
+			return false
+		}
+		if _, ok := matchingPattern(parsed.Type, rule.ResourceTypes, rule.resourceTypes); !ok {
+			return false
+		}
+	}
+	if rule.filter == nil {
+		return true
+	}
+	view := *resource
+	view.States = map[string]map[string]interface{}{state: resource.States[state]}
+	return rule.filter.Match(&view)
+}
+
+// exemption returns the exemption of the resource from the rule if there is one.
+func (policySet *PolicySet) exemption(terraformAddress string, rule string) (*PolicyExemption, bool) {
+	for idx := range policySet.Exemptions {
+		exemption := &policySet.Exemptions[idx]
+		if !exemption.address.MatchString(terraformAddress) {
+			continue
+		}
+		if len(exemption.Rules) == 0 {
+			return exemption, true
+		}
+		for _, id := range exemption.Rules {
+			if id == rule {
+				return exemption, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// EvaluatePolicies evaluates the rules of the policy set on the given state, State_current or State_planned,
+// of every resource in the node table. Resources without the given state are skipped.
+// The findings are returned and additionally attached to the resources under the attribute Attribute_findings.
+func EvaluatePolicies(nodeTable map[string]Node, policySet *PolicySet, state string) (*PolicyReport, error) {
+	if state != State_current && state != State_planned {
+		return nil, fmt.Errorf("provided state '%s' is not valid", state)
+	}
+	report := &PolicyReport{State: state}
+
+	for _, address := range sortedAddresses(nodeTable) {
+		resource, ok := nodeTable[address].(*Resource)
+		if !ok {
+			continue
+		}
+		attributes, ok := resource.States[state]
+		if !ok || attributes == nil {
+			continue
+		}
+		report.Evaluated++
+
+		terraformAddress := TerraformAddress(address)
+		var findings []PolicyFinding
+		for idx := range policySet.Rules {
+			rule := &policySet.Rules[idx]
+			if !rule.appliesTo(resource, state) || rule.Assert.evaluate(attributes) {
+				continue
+			}
+			finding := PolicyFinding{
+				Rule:        rule.ID,
+				Severity:    rule.Severity,
+				Description: rule.Description,
+				Address:     terraformAddress,
+				State:       state,
+			}
+			if exemption, ok := policySet.exemption(terraformAddress, rule.ID); ok {
+				finding.Exempted = true
+				finding.Reason = exemption.Reason
+			}
+			findings = append(findings, finding)
+		}
+		if len(findings) > 0 {
+			resource.AddAttribute(Attribute_findings, findings)
+			report.Findings = append(report.Findings, findings...)
+		}
+	}
+	return report, nil
+}
+
+// Violations returns the findings which are not exempted and have at least the given severity.
+func (report *PolicyReport) Violations(minSeverity string) []PolicyFinding {
+	var violations []PolicyFinding
+	for _, finding := range report.Findings {
+		if !finding.Exempted && severityLevels[finding.Severity] >= severityLevels[minSeverity] {
+			violations = append(violations, finding)
+		}
+	}
+	return violations
+}
+
+// IsValidSeverity reports whether the severity is one of info, low, medium, high or critical.
+func IsValidSeverity(severity string) bool {
+	_, ok := severityLevels[severity]
+	return ok
+}
+
+// Text renders the policy report as plain text with the most severe findings first.
+func (report *PolicyReport) Text() string {
+	var b strings.Builder
+	findings := append([]PolicyFinding(nil), report.Findings...)
+	sort.SliceStable(findings, func(i, j int) bool {
+		return severityLevels[findings[i].Severity] > severityLevels[findings[j].Severity]
+	})
+
+	violations := report.Violations(Severity_info)
+	fmt.Fprintf(&b, "Evaluated %d resources (%s): %d findings, %d exempted\n",
+		report.Evaluated, report.State, len(violations), len(report.Findings)-len(violations))
+	for _, finding := range findings {
+		status := strings.ToUpper(finding.Severity)
+		if finding.Exempted {
+			status = "EXEMPTED"
+		}
+		fmt.Fprintf(&b, "  [%s] %s: %s", status, finding.Rule, finding.Address)
+		if finding.Description != "" {
+			fmt.Fprintf(&b, " - %s", finding.Description)
+		}
+		if finding.Exempted && finding.Reason != "" {
+			fmt.Fprintf(&b, " (%s)", finding.Reason)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
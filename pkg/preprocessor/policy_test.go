@@ -0,0 +1,209 @@
+package preprocessor
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// policyTestState is the state the conditions of TestPolicyConditions are evaluated on.
+var policyTestState = map[string]interface{}{
+	"bucket":   "logs-prod",
+	"size":     20.0,
+	"empty":    "",
+	"nothing":  nil,
+	"tags":     map[string]interface{}{"env": "prod"},
+	"versions": []interface{}{"v1", "v2"},
+	"ingress": []interface{}{
+		map[string]interface{}{"from_port": 443.0, "to_port": 443.0, "cidr_blocks": []interface{}{"0.0.0.0/0"}},
+		map[string]interface{}{"from_port": 22.0, "to_port": 22.0, "cidr_blocks": []interface{}{"10.0.0.0/8"}},
+	},
+}
+
+func TestPolicyConditions(t *testing.T) {
+	tests := []struct {
+		condition string
+		want      bool
+	}{
+		{condition: `{"attribute": "bucket", "operator": "exists"}`, want: true},
+		{condition: `{"attribute": "nothing", "operator": "exists"}`, want: false},
+		{condition: `{"attribute": "missing", "operator": "not_exists"}`, want: true},
+		{condition: `{"attribute": "bucket", "operator": "not_exists"}`, want: false},
+		{condition: `{"attribute": "empty", "operator": "empty"}`, want: true},
+		{condition: `{"attribute": "missing", "operator": "empty"}`, want: true},
+		{condition: `{"attribute": "tags", "operator": "empty"}`, want: false},
+		{condition: `{"attribute": "versions", "operator": "not_empty"}`, want: true},
+		{condition: `{"attribute": "empty", "operator": "not_empty"}`, want: false},
+		{condition: `{"attribute": "tags.env", "operator": "equals", "value": "prod"}`, want: true},
+		{condition: `{"attribute": "size", "operator": "equals", "value": 20}`, want: true},
+		{condition: `{"attribute": "missing", "operator": "equals", "value": null}`, want: false},
+		{condition: `{"attribute": "tags.env", "operator": "not_equals", "value": "dev"}`, want: true},
+		{condition: `{"attribute": "missing", "operator": "not_equals", "value": "dev"}`, want: true},
+		{condition: `{"attribute": "versions", "operator": "contains", "value": "v2"}`, want: true},
+		{condition: `{"attribute": "bucket", "operator": "contains", "value": "prod"}`, want: true},
+		{condition: `{"attribute": "tags", "operator": "contains", "value": "env"}`, want: true},
+		{condition: `{"attribute": "versions", "operator": "not_contains", "value": "v3"}`, want: true},
+		{condition: `{"attribute": "tags", "operator": "not_contains", "value": "env"}`, want: false},
+		{condition: `{"attribute": "tags.env", "operator": "in", "value": ["dev", "prod"]}`, want: true},
+		{condition: `{"attribute": "missing", "operator": "in", "value": [null]}`, want: false},
+		{condition: `{"attribute": "bucket", "operator": "matches", "value": "^logs-(dev|prod)$"}`, want: true},
+		{condition: `{"attribute": "size", "operator": "matches", "value": "20"}`, want: false},
+		{condition: `{"attribute": "size", "operator": "gt", "value": 19}`, want: true},
+		{condition: `{"attribute": "size", "operator": "gt", "value": 20}`, want: false},
+		{condition: `{"attribute": "size", "operator": "gte", "value": 20}`, want: true},
+		{condition: `{"attribute": "size", "operator": "lt", "value": 20}`, want: false},
+		{condition: `{"attribute": "size", "operator": "lte", "value": 20}`, want: true},
+		{condition: `{"attribute": "bucket", "operator": "lte", "value": 20}`, want: false},
+		{condition: `{"attribute": "ingress", "some": {"attribute": "cidr_blocks", "operator": "contains", "value": "0.0.0.0/0"}}`, want: true},
+		{condition: `{"attribute": "ingress", "every": {"attribute": "cidr_blocks", "operator": "contains", "value": "0.0.0.0/0"}}`, want: false},
+		{condition: `{"attribute": "missing", "some": {"attribute": "", "operator": "exists"}}`, want: false},
+		{condition: `{"attribute": "missing", "every": {"attribute": "", "operator": "exists"}}`, want: true},
+		{condition: `{"attribute": "versions", "every": {"attribute": "", "operator": "matches", "value": "^v[0-9]$"}}`, want: true},
+		{condition: `{"attribute": "ingress", "some": {"all": [
+			{"attribute": "cidr_blocks", "operator": "contains", "value": "0.0.0.0/0"},
+			{"attribute": "from_port", "operator": "lte", "value": 22},
+			{"attribute": "to_port", "operator": "gte", "value": 22}
+		]}}`, want: false},
+		{condition: `{"attribute": "ingress", "some": {"all": [
+			{"attribute": "cidr_blocks", "operator": "contains", "value": "10.0.0.0/8"},
+			{"attribute": "from_port", "operator": "lte", "value": 22}
+		]}}`, want: true},
+		{condition: `{"any": [{"attribute": "missing", "operator": "exists"}, {"attribute": "bucket", "operator": "exists"}]}`, want: true},
+		{condition: `{"any": [{"attribute": "missing", "operator": "exists"}]}`, want: false},
+		{condition: `{"not": {"attribute": "bucket", "operator": "exists"}}`, want: false},
+	}
+	for _, test := range tests {
+		condition := new(PolicyCondition)
+		if err := json.Unmarshal([]byte(test.condition), condition); err != nil {
+			t.Fatalf("could not read %s: %s", test.condition, err)
+		}
+		if err := condition.compile(); err != nil {
+			t.Fatalf("could not compile %s: %s", test.condition, err)
+		}
+		if got := condition.evaluate(policyTestState); got != test.want {
+			t.Errorf("got %t for %s, want %t", got, test.condition, test.want)
+		}
+	}
+}
+
+func TestParsePolicySetRejectsInvalidRules(t *testing.T) {
+	tests := []string{
+		`{"rules": [{"severity": "high", "assert": {"attribute": "a", "operator": "exists"}}]}`,
+		`{"rules": [{"id": "a", "severity": "urgent", "assert": {"attribute": "a", "operator": "exists"}}]}`,
+		`{"rules": [{"id": "a", "severity": "high"}]}`,
+		`{"rules": [{"id": "a", "severity": "high", "assert": {"attribute": "a", "operator": "like"}}]}`,
+		`{"rules": [{"id": "a", "severity": "high", "assert": {"attribute": "a", "operator": "exists", "not": {"attribute": "a", "operator": "exists"}}}]}`,
+		`{"rules": [{"id": "a", "severity": "high", "assert": {"attribute": "a", "operator": "in", "value": "prod"}}]}`,
+		`{"rules": [{"id": "a", "severity": "high", "assert": {"attribute": "a", "operator": "matches", "value": "("}}]}`,
+		`{"rules": [{"id": "a", "severity": "high", "assert": {"attribute": "a", "operator": "gt", "value": "1"}}]}`,
+		`{"rules": [{"id": "a", "severity": "high", "filter": "type ==", "assert": {"attribute": "a", "operator": "exists"}}]}`,
+		`{"rules": [{"id": "a", "severity": "high", "assert": {"attribute": "a", "operator": "exists"}}, {"id": "a", "severity": "low", "assert": {"attribute": "a", "operator": "exists"}}]}`,
+		`{"rules": [{"id": "a", "severity": "high", "assert": {"attribute": "a", "operator": "exists"}}], "exemptions": [{"address": "*", "rules": ["b"]}]}`,
+		`{"rules": [], "exemptions": [{"rules": []}]}`,
+	}
+	for _, data := range tests {
+		if _, err := ParsePolicySet([]byte(data)); err == nil {
+			t.Errorf("parsed the invalid policy set %s", data)
+		}
+	}
+}
+
+func TestEvaluatePolicies(t *testing.T) {
+	policySet, err := ParsePolicySet([]byte(`{
+		"rules": [
+			{"id": "encryption", "severity": "high", "resourceTypes": ["aws_s3_*"], "assert": {"attribute": "encrypted", "operator": "equals", "value": true}},
+			{"id": "prod-versioning", "severity": "medium", "resourceTypes": ["aws_s3_bucket"], "filter": "tags.env == prod",
+			 "assert": {"attribute": "versioning", "operator": "equals", "value": true}},
+			{"id": "tags", "severity": "low", "assert": {"attribute": "tags", "operator": "not_empty"}}
+		],
+		"exemptions": [
+			{"address": "aws_s3_bucket.public*", "rules": ["encryption"], "reason": "public assets"},
+			{"address": "module.legacy.*", "reason": "legacy"}
+		]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodeTable := map[string]Node{}
+	add := func(address string, current map[string]interface{}, planned map[string]interface{}) {
+		resource, _ := NewResource(RootAddress+"."+address, nil)
+		if current != nil {
+			resource.addState(State_current, current)
+		}
+		if planned != nil {
+			resource.addState(State_planned, planned)
+		}
+		nodeTable[resource.Address] = resource
+	}
+	prod := map[string]interface{}{"env": "prod"}
+	dev := map[string]interface{}{"env": "dev"}
+	// the bucket is moved to prod by the plan, the prod rules only apply to its planned state
+	add("aws_s3_bucket.data", map[string]interface{}{"encrypted": true, "tags": dev}, map[string]interface{}{"encrypted": true, "tags": prod})
+	add("aws_s3_bucket.public_assets", map[string]interface{}{"encrypted": false, "tags": dev}, nil)
+	add("module.legacy.aws_s3_bucket.old", map[string]interface{}{"encrypted": false}, nil)
+	add("aws_instance.web", nil, map[string]interface{}{"tags": dev})
+
+	tests := []struct {
+		state    string
+		findings []string
+		exempted []string
+	}{
+		{
+			state:    State_current,
+			findings: []string{"aws_s3_bucket.public_assets:encryption", "module.legacy.aws_s3_bucket.old:encryption", "module.legacy.aws_s3_bucket.old:tags"},
+			exempted: []string{"aws_s3_bucket.public_assets:encryption", "module.legacy.aws_s3_bucket.old:encryption", "module.legacy.aws_s3_bucket.old:tags"},
+		},
+		{
+			state:    State_planned,
+			findings: []string{"aws_s3_bucket.data:prod-versioning"},
+		},
+	}
+	for _, test := range tests {
+		report, err := EvaluatePolicies(nodeTable, policySet, test.state)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var findings, exempted []string
+		for _, finding := range report.Findings {
+			findings = append(findings, finding.Address+":"+finding.Rule)
+			if finding.Exempted {
+				exempted = append(exempted, finding.Address+":"+finding.Rule)
+			}
+		}
+		if !reflect.DeepEqual(findings, test.findings) || !reflect.DeepEqual(exempted, test.exempted) {
+			t.Errorf("got findings %v with exempted %v in the %s, want %v with exempted %v", findings, exempted, test.state, test.findings, test.exempted)
+		}
+	}
+
+	if _, err := EvaluatePolicies(nodeTable, policySet, "Unknown_State"); err == nil {
+		t.Errorf("evaluated the policies on an unknown state")
+	}
+}
+
+func TestPolicyReportViolations(t *testing.T) {
+	report := &PolicyReport{Findings: []PolicyFinding{
+		{Rule: "a", Severity: Severity_info},
+		{Rule: "b", Severity: Severity_medium},
+		{Rule: "c", Severity: Severity_critical},
+		{Rule: "d", Severity: Severity_critical, Exempted: true},
+		{Rule: "e", Severity: Severity_high},
+	}}
+	tests := []struct {
+		minSeverity string
+		want        []string
+	}{
+		{minSeverity: Severity_info, want: []string{"a", "b", "c", "e"}},
+		{minSeverity: Severity_medium, want: []string{"b", "c", "e"}},
+		{minSeverity: Severity_high, want: []string{"c", "e"}},
+		{minSeverity: Severity_critical, want: []string{"c"}},
+	}
+	for _, test := range tests {
+		var rules []string
+		for _, violation := range report.Violations(test.minSeverity) {
+			rules = append(rules, violation.Rule)
+		}
+		if !reflect.DeepEqual(rules, test.want) {
+			t.Errorf("got violations %v for the minimum severity %s, want %v", rules, test.minSeverity, test.want)
+		}
+	}
+}
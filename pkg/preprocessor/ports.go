@@ -0,0 +1,253 @@
+package preprocessor
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const port_max = 65535
+
+// Protocols of port sets
+const (
+	Protocol_tcp  = "tcp"
+	Protocol_udp  = "udp"
+	Protocol_icmp = "icmp"
+)
+
+var allProtocols = []string{Protocol_tcp, Protocol_udp, Protocol_icmp}
+
+type portRange struct {
+	from, to int
+}
+
+// portSet maps protocols to sorted, non overlapping port ranges. ICMP has no ports and always covers the full range.
+type portSet map[string][]portRange
+
+// allPorts returns the set of all ports of all protocols.
+func allPorts() portSet {
+	set := make(portSet)
+	for _, protocol := range allProtocols {
+		set.add(protocol, 0, port_max)
+	}
+	return set
+}
+
+// protocolsOf maps the protocol names and numbers used by cloud providers to the protocols of port sets.
+func protocolsOf(protocol string) []string {
+	switch strings.ToLower(protocol) {
+	case "-1", "all", "*", "any", "":
+		return allProtocols
+	case "6", "tcp", "http", "https", "tls":
+		return []string{Protocol_tcp}
+	case "17", "udp":
+		return []string{Protocol_udp}
+	case "tcp_udp":
+		return []string{Protocol_tcp, Protocol_udp}
+	case "1", "58", "icmp", "icmpv6":
+		return []string{Protocol_icmp}
+	default:
+		return nil
+	}
+}
+
+func (set portSet) add(protocol string, from int, to int) {
+	if from > to {
+		from, to = to, from
+	}
+	if from < 0 || protocol == Protocol_icmp {
+		from = 0
+	}
+	if to > port_max || to < 0 || protocol == Protocol_icmp {
+		to = port_max
+	}
+	set[protocol] = normalizeRanges(append(set[protocol], portRange{from, to}))
+}
+
+// addProtocol adds the port range for all protocols the given protocol name stands for.
+func (set portSet) addProtocol(protocol string, from int, to int) {
+	for _, normalized := range protocolsOf(protocol) {
+		set.add(normalized, from, to)
+	}
+}
+
+func (set portSet) addAll(other portSet) {
+	for protocol, ranges := range other {
+		set[protocol] = normalizeRanges(append(set[protocol], ranges...))
+	}
+}
+
+func (set portSet) intersect(other portSet) portSet {
+	result := make(portSet)
+	for protocol, ranges := range set {
+		if intersection := intersectRanges(ranges, other[protocol]); len(intersection) > 0 {
+			result[protocol] = intersection
+		}
+	}
+	return result
+}
+
+func (set portSet) subtract(other portSet) portSet {
+	result := make(portSet)
+	for protocol, ranges := range set {
+		if difference := subtractRanges(ranges, other[protocol]); len(difference) > 0 {
+			result[protocol] = difference
+		}
+	}
+	return result
+}
+
+func (set portSet) isEmpty() bool {
+	for _, ranges := range set {
+		if len(ranges) > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// strings formats the port set like tcp/22, tcp/80-443, udp/all or icmp.
+func (set portSet) strings() []string {
+	var formatted []string
+	for _, protocol := range allProtocols {
+		for _, ports := range set[protocol] {
+			switch {
+			case protocol == Protocol_icmp:
+				formatted = append(formatted, protocol)
+			case ports.from == 0 && ports.to == port_max:
+				formatted = append(formatted, protocol+"/all")
+			case ports.from == ports.to:
+				formatted = append(formatted, protocol+"/"+strconv.Itoa(ports.from))
+			default:
+				formatted = append(formatted, fmt.Sprintf("%s/%d-%d", protocol, ports.from, ports.to))
+			}
+		}
+	}
+	return formatted
+}
+
+func normalizeRanges(ranges []portRange) []portRange {
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].from < ranges[j].from })
+	var normalized []portRange
+	for _, current := range ranges {
+		last := len(normalized) - 1
+		if last >= 0 && current.from <= normalized[last].to+1 {
+			if current.to > normalized[last].to {
+				normalized[last].to = current.to
+			}
+			continue
+		}
+		normalized = append(normalized, current)
+	}
+	return normalized
+}
+
+func intersectRanges(a []portRange, b []portRange) []portRange {
+	var result []portRange
+	for _, first := range a {
+		for _, second := range b {
+			from, to := first.from, first.to
+			if second.from > from {
+				from = second.from
+			}
+			if second.to < to {
+				to = second.to
+			}
+			if from <= to {
+				result = append(result, portRange{from, to})
+			}
+		}
+	}
+	return normalizeRanges(result)
+}
+
+func subtractRanges(a []portRange, b []portRange) []portRange {
+	result := append([]portRange(nil), a...)
+	for _, removed := range b {
+		var next []portRange
+		for _, current := range result {
+			if removed.to < current.from || removed.from > current.to {
+				next = append(next, current)
+				continue
+			}
+			if removed.from > current.from {
+				next = append(next, portRange{current.from, removed.from - 1})
+			}
+			if removed.to < current.to {
+				next = append(next, portRange{removed.to + 1, current.to})
+			}
+		}
+		result = next
+	}
+	return result
+}
+
+// parsePortRange parses port ranges like 22, 80-443 or * as used by Azure and GCP. An empty range covers all ports.
+func parsePortRange(ports string) (int, int, bool) {
+	ports = strings.TrimSpace(ports)
+	if ports == "" || ports == "*" {
+		return 0, port_max, true
+	}
+	fromText, toText, isRange := strings.Cut(ports, "-")
+	from, err := strconv.Atoi(strings.TrimSpace(fromText))
+	if err != nil {
+		return 0, 0, false
+	}
+	if !isRange {
+		return from, from, true
+	}
+	to, err := strconv.Atoi(strings.TrimSpace(toText))
+	if err != nil {
+		return 0, 0, false
+	}
+	return from, to, true
+}
+
+// orderedRule is a firewall rule which is evaluated by priority, e.g. a network ACL entry, an Azure security rule
+// or a GCP firewall rule. The rule with the lowest priority which matches a port decides whether it is allowed.
+type orderedRule struct {
+	priority int
+	allow    bool
+	ports    portSet
+	// address is the node the rule is defined in
+	address string
+}
+
+// evaluateOrderedRules returns the ports which are allowed by the rules and the addresses of the allowing rules.
+// Ports which no rule matches are denied. Deny rules take precedence over allow rules with the same priority.
+func evaluateOrderedRules(rules []orderedRule) (portSet, []string) {
+	sorted := append([]orderedRule(nil), rules...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].priority != sorted[j].priority {
+			return sorted[i].priority < sorted[j].priority
+		}
+		return !sorted[i].allow && sorted[j].allow
+	})
+
+	allowed := make(portSet)
+	undecided := allPorts()
+	var addresses []string
+	for _, rule := range sorted {
+		decided := rule.ports.intersect(undecided)
+		if decided.isEmpty() {
+			continue
+		}
+		if rule.allow {
+			allowed.addAll(decided)
+			addresses = appendUnique(addresses, rule.address)
+		}
+		undecided = undecided.subtract(rule.ports)
+	}
+	return allowed, addresses
+}
+
+// appendUnique appends the values which are not yet contained in the list.
+func appendUnique(list []string, values ...string) []string {
+	for _, value := range values {
+		if value != "" && !containsString(list, value) {
+			list = append(list, value)
+		}
+	}
+	return list
+}
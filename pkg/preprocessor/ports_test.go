@@ -0,0 +1,74 @@
+package preprocessor
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPortSet(t *testing.T) {
+	set := make(portSet)
+	set.addProtocol("tcp", 443, 80)
+	set.addProtocol("6", 22, 22)
+	set.addProtocol("tcp", 444, 500)
+	set.addProtocol("icmp", 8, 8)
+	if formatted := set.strings(); !reflect.DeepEqual(formatted, []string{"tcp/22", "tcp/80-500", "icmp"}) {
+		t.Errorf("got %v, want adjacent ranges merged and icmp without ports", formatted)
+	}
+
+	other := make(portSet)
+	other.addProtocol("all", 100, 200)
+	if formatted := set.intersect(other).strings(); !reflect.DeepEqual(formatted, []string{"tcp/100-200", "icmp"}) {
+		t.Errorf("got intersection %v", formatted)
+	}
+	if formatted := set.subtract(other).strings(); !reflect.DeepEqual(formatted, []string{"tcp/22", "tcp/80-99", "tcp/201-500"}) {
+		t.Errorf("got difference %v", formatted)
+	}
+	if !set.subtract(allPorts()).isEmpty() {
+		t.Errorf("subtracting all ports left %v", set.subtract(allPorts()).strings())
+	}
+	if formatted := allPorts().strings(); !reflect.DeepEqual(formatted, []string{"tcp/all", "udp/all", "icmp"}) {
+		t.Errorf("got all ports %v", formatted)
+	}
+}
+
+func TestParsePortRange(t *testing.T) {
+	tests := []struct {
+		ports    string
+		from, to int
+		ok       bool
+	}{
+		{ports: "22", from: 22, to: 22, ok: true},
+		{ports: " 80 - 443 ", from: 80, to: 443, ok: true},
+		{ports: "*", from: 0, to: port_max, ok: true},
+		{ports: "", from: 0, to: port_max, ok: true},
+		{ports: "http", ok: false},
+		{ports: "80-", ok: false},
+	}
+	for _, test := range tests {
+		from, to, ok := parsePortRange(test.ports)
+		if from != test.from || to != test.to || ok != test.ok {
+			t.Errorf("got %d, %d, %t for '%s', want %d, %d, %t", from, to, ok, test.ports, test.from, test.to, test.ok)
+		}
+	}
+}
+
+func TestEvaluateOrderedRules(t *testing.T) {
+	ports := func(protocol string, from int, to int) portSet {
+		set := make(portSet)
+		set.addProtocol(protocol, from, to)
+		return set
+	}
+	rules := []orderedRule{
+		{priority: 200, allow: true, ports: ports("tcp", 0, port_max), address: "allow-all"},
+		{priority: 100, allow: true, ports: ports("tcp", 443, 443), address: "allow-https"},
+		{priority: 100, allow: false, ports: ports("tcp", 22, 443), address: "deny-low"},
+		{priority: 300, allow: true, ports: ports("udp", 53, 53), address: "allow-dns"},
+	}
+	allowed, addresses := evaluateOrderedRules(rules)
+	if formatted := allowed.strings(); !reflect.DeepEqual(formatted, []string{"tcp/0-21", "tcp/444-65535", "udp/53"}) {
+		t.Errorf("got allowed ports %v", formatted)
+	}
+	if !reflect.DeepEqual(addresses, []string{"allow-all", "allow-dns"}) {
+		t.Errorf("got allowing rules %v", addresses)
+	}
+}
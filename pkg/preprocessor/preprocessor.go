@@ -19,7 +19,11 @@ func ParseStateFile(stateFile []byte) (map[string]Node, error) {
 	}
 	nodeTable := make(map[string]Node)
 
-	rootModule := tfjsonState.Values.RootModule
+	// the values are omitted for an empty state
+	rootModule := new(tfjson.StateModule)
+	if tfjsonState.Values != nil && tfjsonState.Values.RootModule != nil {
+		rootModule = tfjsonState.Values.RootModule
+	}
 	rootModule.Address = RootAddress
 
 	nodeTable, err = parseTfjsonStateModule(rootModule, nodeTable, State_current, RootAddress)
@@ -29,6 +33,15 @@ func ParseStateFile(stateFile []byte) (map[string]Node, error) {
 	return nodeTable, nil
 }
 
+// ParseKarenFile takes a json formatted karen document, with or without envelope, and restores the node table from it.
+func ParseKarenFile(karenFile []byte) (map[string]Node, error) {
+	document, err := ParseKarenDocument(karenFile)
+	if err != nil {
+		return nil, err
+	}
+	return document.Nodes, nil
+}
+
 // ParsePlanFile takes a json formatted plan file and generates a node table from it.
 func ParsePlanFile(planFile []byte, tfConfigUrl string, tfConfigMainPath string) (map[string]Node, error) {
 	plan := new(tfjson.Plan)
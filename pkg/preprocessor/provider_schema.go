@@ -0,0 +1,260 @@
+package preprocessor
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	tfjson "github.com/hashicorp/terraform-json"
+	"github.com/zclconf/go-cty/cty"
+)
+
+// ResourceSchema describes a resource type as declared by the schema of its provider.
+type ResourceSchema struct {
+	Provider    string `json:"provider"`
+	Version     uint64 `json:"version"`
+	Description string `json:"description,omitempty"`
+	Deprecated  bool   `json:"deprecated,omitempty"`
+	// Attributes maps the path of every attribute to its schema. Attributes of nested blocks and nested attributes
+	// use dotted paths without indices, e.g. ingress.from_port.
+	Attributes map[string]AttributeSchema `json:"attributes,omitempty"`
+}
+
+// AttributeSchema describes an attribute of a resource as declared by the schema of its provider.
+type AttributeSchema struct {
+	Type        string `json:"type,omitempty"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+	Optional    bool   `json:"optional,omitempty"`
+	Computed    bool   `json:"computed,omitempty"`
+	Sensitive   bool   `json:"sensitive,omitempty"`
+	Deprecated  bool   `json:"deprecated,omitempty"`
+}
+
+// ParseProviderSchemas takes the json output of 'terraform providers schema -json'.
+func ParseProviderSchemas(providerSchemasFile []byte) (*tfjson.ProviderSchemas, error) {
+	providerSchemas := new(tfjson.ProviderSchemas)
+	err := providerSchemas.UnmarshalJSON(providerSchemasFile)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't parse the given provider schemas file: %s", err.Error())
+	}
+	return providerSchemas, nil
+}
+
+// EnrichWithProviderSchemas adds the schemas of the resource types of the document, taken from the json output of
+// 'terraform providers schema -json', once per type to the schemas of the document and refers the resources to them
+// by their schema key. Deposed objects refer to the schema of their instance. Values of attributes which the schema
+// declares as sensitive are removed from the states of the resources, if terraform did not already remove them.
+func EnrichWithProviderSchemas(document *KarenDocument, providerSchemasFile []byte) error {
+	providerSchemas, err := ParseProviderSchemas(providerSchemasFile)
+	if err != nil {
+		return err
+	}
+	nodeTable := document.Nodes
+	if document.Schemas == nil {
+		document.Schemas = make(map[string]*ResourceSchema)
+	}
+
+	providers := make([]string, 0, len(providerSchemas.Schemas))
+	for provider := range providerSchemas.Schemas {
+		providers = append(providers, provider)
+	}
+	sort.Strings(providers)
+
+	for _, address := range sortedAddresses(nodeTable) {
+		var resource *Resource
+		instanceAddress := address
+		switch casted := nodeTable[address].(type) {
+		case *Resource:
+			resource = casted
+		case *DeposedObject:
+			// deposed objects are described by the schema of the type of their instance
+			resource = casted.Resource
+			instanceAddress = strings.TrimSuffix(address, DeposedObjectAddress("", casted.DeposedKey))
+		default:
+			continue
+		}
+		parsed, ok := parseResourceAddress(instanceAddress)
+		if !ok {
+			continue
+		}
+		provider, schema := lookupResourceSchema(providerSchemas, providers, resource.Provider, parsed)
+		if schema == nil || schema.Block == nil {
+			continue
+		}
+
+		key := resourceSchemaKey(provider, parsed)
+		if _, ok := document.Schemas[key]; !ok {
+			document.Schemas[key] = newResourceSchema(provider, schema)
+		}
+		resource.SchemaKey = key
+
+		for _, state := range []string{State_current, State_planned} {
+			if attributes, ok := resource.States[state]; ok && attributes != nil {
+				resource.removeSchemaSensitiveValues(state, attributes, schema.Block, "")
+			}
+		}
+	}
+	return nil
+}
+
+// resourceSchemaKey returns the key of the schema of a resource or data source type of a provider, e.g.
+// registry.terraform.io/hashicorp/aws/aws_instance or registry.terraform.io/hashicorp/aws/data.aws_ami.
+func resourceSchemaKey(provider string, parsed resourceAddress) string {
+	if parsed.Mode == Resource_mode_data {
+		return provider + "/data." + parsed.Type
+	}
+	return provider + "/" + parsed.Type
+}
+
+// lookupResourceSchema returns the schema of the resource or data source type of the given address and the provider which
+// declares it. The provider of the resource is preferred, other providers declaring the type are tried in sorted order.
+func lookupResourceSchema(providerSchemas *tfjson.ProviderSchemas, providers []string, resourceProvider string, parsed resourceAddress) (string, *tfjson.Schema) {
+	if resourceProvider != "" {
+		providers = append([]string{resourceProvider}, providers...)
+	}
+	for _, provider := range providers {
+		providerSchema := providerSchemas.Schemas[provider]
+		if providerSchema == nil {
+			continue
+		}
+		schemas := providerSchema.ResourceSchemas
+		if parsed.Mode == Resource_mode_data {
+			schemas = providerSchema.DataSourceSchemas
+		}
+		if schema, ok := schemas[parsed.Type]; ok {
+			return provider, schema
+		}
+	}
+	return "", nil
+}
+
+func newResourceSchema(provider string, schema *tfjson.Schema) *ResourceSchema {
+	resourceSchema := &ResourceSchema{
+		Provider:    provider,
+		Version:     schema.Version,
+		Description: schema.Block.Description,
+		Deprecated:  schema.Block.Deprecated,
+		Attributes:  make(map[string]AttributeSchema),
+	}
+	collectAttributeSchemas(schema.Block, "", resourceSchema.Attributes)
+	return resourceSchema
+}
+
+// collectAttributeSchemas adds the schemas of all attributes of the block and its nested blocks.
+func collectAttributeSchemas(block *tfjson.SchemaBlock, prefix string, attributeSchemas map[string]AttributeSchema) {
+	for name, attribute := range block.Attributes {
+		path := joinAttributePath(prefix, name)
+		attributeSchemas[path] = AttributeSchema{
+			Type:        attributeTypeName(attribute),
+			Description: attribute.Description,
+			Required:    attribute.Required,
+			Optional:    attribute.Optional,
+			Computed:    attribute.Computed,
+			Sensitive:   attribute.Sensitive,
+			Deprecated:  attribute.Deprecated,
+		}
+		if attribute.AttributeNestedType != nil {
+			collectAttributeSchemas(&tfjson.SchemaBlock{Attributes: attribute.AttributeNestedType.Attributes}, path, attributeSchemas)
+		}
+	}
+	for name, blockType := range block.NestedBlocks {
+		if blockType.Block != nil {
+			collectAttributeSchemas(blockType.Block, joinAttributePath(prefix, name), attributeSchemas)
+		}
+	}
+}
+
+// attributeTypeName returns a human readable name of the type of the attribute, e.g. list of string.
+func attributeTypeName(attribute *tfjson.SchemaAttribute) string {
+	if attribute.AttributeNestedType != nil {
+		switch attribute.AttributeNestedType.NestingMode {
+		case tfjson.SchemaNestingModeSingle, tfjson.SchemaNestingModeGroup:
+			return "object"
+		default:
+			return string(attribute.AttributeNestedType.NestingMode) + " of object"
+		}
+	}
+	if attribute.AttributeType == cty.NilType {
+		return ""
+	}
+	return attribute.AttributeType.FriendlyName()
+}
+
+func joinAttributePath(prefix string, name string) string {
+	if prefix == "" {
+		return name
+	}
+	return prefix + "." + name
+}
+
+// removeSchemaSensitiveValues removes the values of the attributes which the schema declares as sensitive from the
+// object and records their paths as sensitive attributes of the state.
+func (resource *Resource) removeSchemaSensitiveValues(state string, value interface{}, block *tfjson.SchemaBlock, prefix string) {
+	object, ok := value.(map[string]interface{})
+	if !ok {
+		return
+	}
+
+	names := make([]string, 0, len(block.Attributes))
+	for name := range block.Attributes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		attribute := block.Attributes[name]
+		nested, present := object[name]
+		if !present || nested == nil {
+			continue
+		}
+		path := joinAttributePath(prefix, name)
+		if attribute.Sensitive {
+			delete(object, name)
+			if !containsString(resource.SensitiveAttributes[state], path) {
+				resource.addSensitiveAttribute(state, path)
+			}
+			continue
+		}
+		if attribute.AttributeNestedType != nil {
+			nestedBlock := &tfjson.SchemaBlock{Attributes: attribute.AttributeNestedType.Attributes}
+			resource.removeNestedSchemaSensitiveValues(state, nested, attribute.AttributeNestedType.NestingMode, nestedBlock, path)
+		}
+	}
+
+	names = names[:0]
+	for name := range block.NestedBlocks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		blockType := block.NestedBlocks[name]
+		if blockType.Block == nil {
+			continue
+		}
+		resource.removeNestedSchemaSensitiveValues(state, object[name], blockType.NestingMode, blockType.Block, joinAttributePath(prefix, name))
+	}
+}
+
+// removeNestedSchemaSensitiveValues removes the sensitive values of every object of a nested block or nested attribute.
+func (resource *Resource) removeNestedSchemaSensitiveValues(state string, value interface{}, nestingMode tfjson.SchemaNestingMode, block *tfjson.SchemaBlock, path string) {
+	switch nestingMode {
+	case tfjson.SchemaNestingModeList, tfjson.SchemaNestingModeSet:
+		elements, _ := value.([]interface{})
+		for idx, element := range elements {
+			resource.removeSchemaSensitiveValues(state, element, block, path+"["+strconv.Itoa(idx)+"]")
+		}
+	case tfjson.SchemaNestingModeMap:
+		elements, _ := value.(map[string]interface{})
+		keys := make([]string, 0, len(elements))
+		for key := range elements {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			resource.removeSchemaSensitiveValues(state, elements[key], block, path+"["+strconv.Quote(key)+"]")
+		}
+	default:
+		resource.removeSchemaSensitiveValues(state, value, block, path)
+	}
+}
@@ -0,0 +1,93 @@
+package preprocessor
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	tfjson "github.com/hashicorp/terraform-json"
+)
+
+func TestLookupResourceSchemaPrefersProviderOfResource(t *testing.T) {
+	schema := func(description string) *tfjson.ProviderSchema {
+		return &tfjson.ProviderSchema{ResourceSchemas: map[string]*tfjson.Schema{
+			"aws_instance": {Block: &tfjson.SchemaBlock{Description: description}},
+		}}
+	}
+	providerSchemas := &tfjson.ProviderSchemas{Schemas: map[string]*tfjson.ProviderSchema{
+		"registry.terraform.io/acme/aws":      schema("fork"),
+		"registry.terraform.io/hashicorp/aws": schema("upstream"),
+	}}
+	providers := []string{"registry.terraform.io/acme/aws", "registry.terraform.io/hashicorp/aws"}
+	parsed := resourceAddress{Mode: Resource_mode_managed, Type: "aws_instance", Name: "web"}
+
+	tests := []struct {
+		resourceProvider string
+		wantProvider     string
+	}{
+		{resourceProvider: "registry.terraform.io/hashicorp/aws", wantProvider: "registry.terraform.io/hashicorp/aws"},
+		{resourceProvider: "", wantProvider: "registry.terraform.io/acme/aws"},
+		{resourceProvider: "registry.terraform.io/hashicorp/google", wantProvider: "registry.terraform.io/acme/aws"},
+	}
+	for _, test := range tests {
+		provider, _ := lookupResourceSchema(providerSchemas, providers, test.resourceProvider, parsed)
+		if provider != test.wantProvider {
+			t.Errorf("got provider %s for a resource of provider '%s', want %s", provider, test.resourceProvider, test.wantProvider)
+		}
+	}
+}
+
+func TestEnrichWithProviderSchemasDescribesDeposedObjects(t *testing.T) {
+	data, err := os.ReadFile("testdata/deposed_state.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	document, err := ParseDocument(data, Input_kind_state, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	providerSchemas := []byte(`{"format_version": "1.0", "provider_schemas": {"registry.terraform.io/hashicorp/aws": {
+		"resource_schemas": {"aws_instance": {"version": 1, "block": {"attributes": {
+			"id": {"type": "string", "computed": true},
+			"instance_type": {"type": "string", "optional": true, "sensitive": true}
+		}}}}
+	}}}`)
+	err = EnrichWithProviderSchemas(document, providerSchemas)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	schemaKey := "registry.terraform.io/hashicorp/aws/aws_instance"
+	tests := []struct {
+		address   string
+		sensitive []string
+	}{
+		{address: RootAddress + ".aws_instance.web", sensitive: []string{"instance_type"}},
+		{address: DeposedObjectAddress(RootAddress+".aws_instance.web", "00000001"), sensitive: []string{"instance_type"}},
+		{address: DeposedObjectAddress(RootAddress+".aws_instance.app[0]", "abcd1234")},
+	}
+	for _, test := range tests {
+		address := test.address
+		var resource *Resource
+		switch casted := document.Nodes[address].(type) {
+		case *Resource:
+			resource = casted
+		case *DeposedObject:
+			resource = casted.Resource
+		default:
+			t.Fatalf("the resource %s is missing", address)
+		}
+		if resource.SchemaKey != schemaKey {
+			t.Errorf("got schema key '%s' of %s, want %s", resource.SchemaKey, address, schemaKey)
+		}
+		if _, ok := resource.States[State_current]["instance_type"]; ok {
+			t.Errorf("the sensitive instance_type of %s was not removed", address)
+		}
+		if _, ok := resource.States[State_current]["id"]; !ok {
+			t.Errorf("the id of %s was removed", address)
+		}
+		if !reflect.DeepEqual(resource.SensitiveAttributes[State_current], test.sensitive) {
+			t.Errorf("got sensitive attributes %v of %s, want %v", resource.SensitiveAttributes[State_current], address, test.sensitive)
+		}
+	}
+}
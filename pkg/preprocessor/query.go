@@ -0,0 +1,652 @@
+package preprocessor
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Query selects nodes of a node table. A query is built by ParseQuery from an expression like
+//
+//	module.network.* and (type == aws_subnet or tags.env == "prod") and not action == NoOp
+//
+// An expression consists of the following terms:
+//   - a bare address glob like module.network.* which is matched against the terraform address of a node
+//   - a predicate 'field operator value' where field is one of address, type, name, module, mode, provider,
+//     node, action, stack or status. Every other field is treated as a dotted path into the attributes of a resource, e.g. tags.env.
+//     Attributes are looked up in the planned state of a resource if it is present, in the current state
+//     otherwise and finally in the attributes of the node.
+//
+// Supported operators are == (or =), != and ~= which matches a glob. Attributes additionally support
+// <, <=, > and >= for numeric values. Values can be quoted with double quotes.
+// Terms are combined with 'and' (&&), 'or' (||), 'not' (!) and parentheses.
+type Query struct {
+	expression string
+	root       queryExpr
+}
+
+type queryExpr interface {
+	match(node Node) bool
+}
+
+type queryAnd struct {
+	left, right queryExpr
+}
+
+func (expr *queryAnd) match(node Node) bool {
+	return expr.left.match(node) && expr.right.match(node)
+}
+
+type queryOr struct {
+	left, right queryExpr
+}
+
+func (expr *queryOr) match(node Node) bool {
+	return expr.left.match(node) || expr.right.match(node)
+}
+
+type queryNot struct {
+	expr queryExpr
+}
+
+func (expr *queryNot) match(node Node) bool {
+	return !expr.expr.match(node)
+}
+
+type queryPredicate struct {
+	field    string
+	operator string
+	value    string
+	glob     *regexp.Regexp
+}
+
+const (
+	query_field_address  = "address"
+	query_field_type     = "type"
+	query_field_name     = "name"
+	query_field_module   = "module"
+	query_field_mode     = "mode"
+	query_field_provider = "provider"
+	query_field_node     = "node"
+	query_field_action   = "action"
+	query_field_stack    = "stack"
+	query_field_status   = "status"
+)
+
+func (predicate *queryPredicate) match(node Node) bool {
+	values, ok := queryFieldValues(node, predicate.field)
+	if !ok {
+		return predicate.operator == "!="
+	}
+	if predicate.operator == "!=" {
+		for _, value := range values {
+			if compareQueryValue(value, "==", predicate.value, nil) {
+				return false
+			}
+		}
+		return true
+	}
+	for _, value := range values {
+		if compareQueryValue(value, predicate.operator, predicate.value, predicate.glob) {
+			return true
+		}
+	}
+	return false
+}
+
+// queryFieldValues returns the values of a node that a predicate on the given field is compared with.
+func queryFieldValues(node Node, field string) ([]interface{}, bool) {
+	switch field {
+	case query_field_address:
+		return []interface{}{TerraformAddress(node.GetAddress()), node.GetAddress()}, true
+	case query_field_node:
+		return []interface{}{node.GetNodeType()}, true
+	case query_field_stack:
+		stack := StackOf(node.GetAddress())
+		if stack == "" {
+			return nil, false
+		}
+		return []interface{}{stack}, true
+	case query_field_action:
+		resource, ok := node.(*Resource)
+		if deposedObject, isDeposed := node.(*DeposedObject); isDeposed {
+			resource, ok = deposedObject.Resource, true
+		}
+		if !ok {
+			return nil, false
+		}
+		values := make([]interface{}, 0, len(resource.Actions))
+		for _, action := range resource.Actions {
+			values = append(values, action)
+		}
+		return values, true
+	case query_field_status:
+		switch casted := node.(type) {
+		case *Resource:
+			if casted.Status == "" {
+				return nil, false
+			}
+			return []interface{}{casted.Status}, true
+		case *DeposedObject:
+			return []interface{}{Instance_status_deposed}, true
+		}
+		return nil, false
+	case query_field_type, query_field_name, query_field_module, query_field_mode, query_field_provider:
+		if node.GetNodeType() != Node_type_resource && node.GetNodeType() != Node_type_reference_resource {
+			return nil, false
+		}
+		parsed, ok := parseResourceAddress(node.GetAddress())
+		if !ok {
+			return nil, false
+		}
+		switch field {
+		case query_field_type:
+			return []interface{}{parsed.Type}, true
+		case query_field_name:
+			return []interface{}{parsed.Name}, true
+		case query_field_module:
+			return []interface{}{parsed.Module}, true
+		case query_field_mode:
+			return []interface{}{parsed.Mode}, true
+		default:
+			return []interface{}{providerOfType(parsed.Type)}, true
+		}
+	default:
+		path := strings.Split(field, ".")
+		if resource, ok := node.(*Resource); ok {
+			if value, ok := lookupAttribute(effectiveState(resource), path); ok {
+				return []interface{}{value}, true
+			}
+		}
+		value, ok := lookupAttribute(node.GetAttributes(), path)
+		if !ok {
+			return nil, false
+		}
+		return []interface{}{value}, true
+	}
+}
+
+// effectiveState returns the planned state of a resource if it is present and the current state otherwise.
+func effectiveState(resource *Resource) map[string]interface{} {
+	if state, ok := resource.States[State_planned]; ok && state != nil {
+		return state
+	}
+	return resource.States[State_current]
+}
+
+// lookupAttribute follows the given path through nested maps and lists. Lists are indexed by keys like 0 or [0],
+// other keys descend into the first element of a list, so that nested blocks like network_interface.subnetwork
+// can be addressed.
+func lookupAttribute(attributes interface{}, path []string) (interface{}, bool) {
+	current := attributes
+	for _, key := range path {
+		if list, ok := current.([]interface{}); ok {
+			if idx, err := strconv.Atoi(strings.Trim(key, "[]")); err == nil {
+				if idx < 0 || idx >= len(list) {
+					return nil, false
+				}
+				current = list[idx]
+				continue
+			}
+			current = firstElement(list)
+		}
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		next, ok := object[key]
+		if !ok {
+			return nil, false
+		}
+		current = next
+	}
+	return current, true
+}
+
+func compareQueryValue(actual interface{}, operator string, expected string, glob *regexp.Regexp) bool {
+	switch operator {
+	case "==":
+		switch casted := actual.(type) {
+		case nil:
+			return expected == "null"
+		case string:
+			return casted == expected
+		case bool:
+			parsed, err := strconv.ParseBool(expected)
+			return err == nil && parsed == casted
+		case float64:
+			parsed, err := strconv.ParseFloat(expected, 64)
+			return err == nil && parsed == casted
+		default:
+			return false
+		}
+	case "~=":
+		switch actual.(type) {
+		case string, bool, float64:
+			return glob.MatchString(fmt.Sprint(actual))
+		default:
+			return false
+		}
+	case "<", "<=", ">", ">=":
+		number, ok := actual.(float64)
+		if !ok {
+			return false
+		}
+		parsed, err := strconv.ParseFloat(expected, 64)
+		if err != nil {
+			return false
+		}
+		switch operator {
+		case "<":
+			return number < parsed
+		case "<=":
+			return number <= parsed
+		case ">":
+			return number > parsed
+		default:
+			return number >= parsed
+		}
+	}
+	return false
+}
+
+// compileGlob converts a glob with the wildcards * and ? into a regular expression.
+func compileGlob(glob string) *regexp.Regexp {
+	var pattern strings.Builder
+	pattern.WriteString("^")
+	for _, r := range glob {
+		switch r {
+		case '*':
+			pattern.WriteString(".*")
+		case '?':
+			pattern.WriteString(".")
+		default:
+			pattern.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	pattern.WriteString("$")
+	return regexp.MustCompile(pattern.String())
+}
+
+type queryToken struct {
+	value  string
+	quoted bool
+}
+
+// queryOperators are ordered so that longer operators are matched first.
+var queryOperators = []string{"==", "!=", "~=", "<=", ">=", "&&", "||", "=", "<", ">", "!", "(", ")"}
+
+func tokenizeQuery(query string) ([]queryToken, error) {
+	var tokens []queryToken
+	i := 0
+	for i < len(query) {
+		c := rune(query[i])
+		if unicode.IsSpace(c) {
+			i++
+			continue
+		}
+		if c == '"' {
+			value, length, err := readQuotedString(query[i:])
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, queryToken{value: value, quoted: true})
+			i += length
+			continue
+		}
+		isOperator := false
+		for _, operator := range queryOperators {
+			if strings.HasPrefix(query[i:], operator) {
+				tokens = append(tokens, queryToken{value: operator})
+				i += len(operator)
+				isOperator = true
+				break
+			}
+		}
+		if isOperator {
+			continue
+		}
+		start := i
+		depth := 0
+		for i < len(query) {
+			c := query[i]
+			if c == '[' {
+				depth++
+			} else if c == ']' {
+				depth--
+			} else if c == '"' && depth > 0 {
+				_, length, err := readQuotedString(query[i:])
+				if err != nil {
+					return nil, err
+				}
+				i += length
+				continue
+			} else if depth == 0 && (unicode.IsSpace(rune(c)) || strings.ContainsRune("()=!~<>&|\"", rune(c))) {
+				break
+			}
+			i++
+		}
+		tokens = append(tokens, queryToken{value: query[start:i]})
+	}
+	return tokens, nil
+}
+
+// readQuotedString reads a double quoted string from the start of the input and returns its unquoted value and its length.
+func readQuotedString(input string) (string, int, error) {
+	for i := 1; i < len(input); i++ {
+		if input[i] == '\\' {
+			i++
+		} else if input[i] == '"' {
+			value, err := strconv.Unquote(input[:i+1])
+			if err != nil {
+				return "", 0, fmt.Errorf("invalid string %s: %s", input[:i+1], err.Error())
+			}
+			return value, i + 1, nil
+		}
+	}
+	return "", 0, fmt.Errorf("unterminated string %s", input)
+}
+
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+}
+
+func (parser *queryParser) peek() (queryToken, bool) {
+	if parser.pos >= len(parser.tokens) {
+		return queryToken{}, false
+	}
+	return parser.tokens[parser.pos], true
+}
+
+func (parser *queryParser) isKeyword(keywords ...string) bool {
+	token, ok := parser.peek()
+	if !ok || token.quoted {
+		return false
+	}
+	for _, keyword := range keywords {
+		if token.value == keyword {
+			return true
+		}
+	}
+	return false
+}
+
+func (parser *queryParser) parseOr() (queryExpr, error) {
+	left, err := parser.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for parser.isKeyword("or", "||") {
+		parser.pos++
+		right, err := parser.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &queryOr{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (parser *queryParser) parseAnd() (queryExpr, error) {
+	left, err := parser.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for parser.isKeyword("and", "&&") {
+		parser.pos++
+		right, err := parser.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &queryAnd{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (parser *queryParser) parseUnary() (queryExpr, error) {
+	if parser.isKeyword("not", "!") {
+		parser.pos++
+		expr, err := parser.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &queryNot{expr: expr}, nil
+	}
+	if parser.isKeyword("(") {
+		parser.pos++
+		expr, err := parser.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !parser.isKeyword(")") {
+			return nil, fmt.Errorf("missing ')' at token %d", parser.pos+1)
+		}
+		parser.pos++
+		return expr, nil
+	}
+	return parser.parsePredicate()
+}
+
+func (parser *queryParser) parsePredicate() (queryExpr, error) {
+	token, ok := parser.peek()
+	if !ok {
+		return nil, fmt.Errorf("unexpected end of query")
+	}
+	if !token.quoted && isQueryKeyword(token.value) {
+		return nil, fmt.Errorf("unexpected '%s' at token %d", token.value, parser.pos+1)
+	}
+	parser.pos++
+
+	if !parser.isKeyword("==", "=", "!=", "~=", "<", "<=", ">", ">=") {
+		// a term without an operator is an address glob
+		return &queryPredicate{field: query_field_address, operator: "~=", value: token.value, glob: compileGlob(token.value)}, nil
+	}
+	if token.quoted {
+		return nil, fmt.Errorf("field name %q must not be quoted", token.value)
+	}
+	operator, _ := parser.peek()
+	parser.pos++
+	value, ok := parser.peek()
+	if !ok || (!value.quoted && isQueryKeyword(value.value)) {
+		return nil, fmt.Errorf("missing value after '%s %s'", token.value, operator.value)
+	}
+	parser.pos++
+
+	predicate := &queryPredicate{field: token.value, operator: operator.value, value: value.value}
+	if predicate.operator == "=" {
+		predicate.operator = "=="
+	}
+	if predicate.operator == "~=" {
+		predicate.glob = compileGlob(value.value)
+	}
+	return predicate, nil
+}
+
+func isQueryKeyword(value string) bool {
+	switch value {
+	case "and", "or", "not":
+		return true
+	}
+	for _, operator := range queryOperators {
+		if value == operator {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseQuery parses the given query expression. See Query for the supported syntax.
+func ParseQuery(expression string) (*Query, error) {
+	tokens, err := tokenizeQuery(expression)
+	if err != nil {
+		return nil, fmt.Errorf("invalid query: %s", err.Error())
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("invalid query: query is empty")
+	}
+	parser := &queryParser{tokens: tokens}
+	root, err := parser.parseOr()
+	if err != nil {
+		return nil, fmt.Errorf("invalid query: %s", err.Error())
+	}
+	if token, ok := parser.peek(); ok {
+		return nil, fmt.Errorf("invalid query: unexpected '%s' at token %d", token.value, parser.pos+1)
+	}
+	return &Query{expression: expression, root: root}, nil
+}
+
+// Match reports whether the given node satisfies the query.
+func (query *Query) Match(node Node) bool {
+	return query.root.match(node)
+}
+
+func (query *Query) String() string {
+	return query.expression
+}
+
+// QueryNodeTable returns the sorted addresses of all nodes that match the query.
+// If depth is greater than zero, nodes that are up to depth dependency hops away from a matching node are returned as well.
+func QueryNodeTable(nodeTable map[string]Node, query *Query, depth int) []string {
+	matches := make(map[string]bool)
+	for address, node := range nodeTable {
+		if query.Match(node) {
+			matches[address] = true
+		}
+	}
+	if depth > 0 {
+		matches = expandDependencies(nodeTable, matches, depth)
+	}
+
+	addresses := make([]string, 0, len(matches))
+	for address := range matches {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+	return addresses
+}
+
+// FilterNodeTable returns a pruned copy of the node table that only contains the nodes which match the query,
+// the nodes within depth dependency hops of them, all of their ancestors and the provider configurations the retained
+// resources use. The children of the retained nodes
+// and the members of retained groups are reduced to retained nodes, so that the pruned node table can be rendered like the original one.
+func FilterNodeTable(nodeTable map[string]Node, query *Query, depth int) (map[string]Node, error) {
+	retained := make(map[string]bool)
+	parents := parentTable(nodeTable)
+	for _, address := range QueryNodeTable(nodeTable, query, depth) {
+		for current, ok := address, true; ok && !retained[current]; current, ok = parents[current] {
+			retained[current] = true
+		}
+	}
+	retainProviders(nodeTable, retained)
+
+	filteredNodeTable := make(map[string]Node, len(retained))
+	for address := range retained {
+		node, err := cloneNode(nodeTable[address])
+		if err != nil {
+			return nil, err
+		}
+		data := node.(nodeDataProvider).data()
+		data.Children = retainedChildren(data.Children, retained)
+		if group, ok := node.(*Group); ok {
+			group.Members = retainedChildren(group.Members, retained)
+		}
+		filteredNodeTable[address] = node
+	}
+	return filteredNodeTable, nil
+}
+
+// retainProviders retains the provider configurations of the providers which the retained resources of their stack use.
+func retainProviders(nodeTable map[string]Node, retained map[string]bool) {
+	used := make(map[string]bool)
+	for address := range retained {
+		resource, ok := nodeTable[address].(*Resource)
+		if !ok {
+			continue
+		}
+		if parsed, ok := parseResourceAddress(address); ok {
+			used[StackOf(address)+" "+resourceProviderName(resource, parsed)] = true
+		}
+	}
+	for address, n := range nodeTable {
+		if provider, ok := n.(*Provider); ok {
+			name, _ := provider.GetAttributes()["name"].(string)
+			if used[StackOf(address)+" "+name] {
+				retained[address] = true
+			}
+		}
+	}
+}
+
+func retainedChildren(children []string, retained map[string]bool) []string {
+	var filtered []string
+	for _, child := range children {
+		if retained[child] {
+			filtered = append(filtered, child)
+		}
+	}
+	return filtered
+}
+
+// expandDependencies adds all nodes that are up to depth dependency hops away from the given nodes.
+// Dependencies are followed in both directions. If a reference resource is reached, all of its instances are added as well.
+func expandDependencies(nodeTable map[string]Node, addresses map[string]bool, depth int) map[string]bool {
+	neighbours := make(map[string][]string)
+	for address, node := range nodeTable {
+		for _, dependency := range nodeDependencies(node) {
+			neighbours[address] = append(neighbours[address], dependency)
+			neighbours[dependency] = append(neighbours[dependency], address)
+		}
+	}
+
+	expanded := make(map[string]bool, len(addresses))
+	frontier := make([]string, 0, len(addresses))
+	for address := range addresses {
+		expanded[address] = true
+		frontier = append(frontier, address)
+	}
+	for hop := 0; hop < depth && len(frontier) > 0; hop++ {
+		var next []string
+		for _, address := range frontier {
+			for _, neighbour := range neighbours[address] {
+				if _, ok := nodeTable[neighbour]; !ok || expanded[neighbour] {
+					continue
+				}
+				expanded[neighbour] = true
+				next = append(next, neighbour)
+				if nodeTable[neighbour].GetNodeType() == Node_type_reference_resource {
+					for _, instance := range nodeTable[neighbour].GetChildren() {
+						if !expanded[instance] {
+							expanded[instance] = true
+							next = append(next, instance)
+						}
+					}
+				}
+			}
+		}
+		frontier = next
+	}
+	return expanded
+}
+
+// nodeDependencies returns the dependencies of resources and reference resources, including the targets of the edges of resources.
+func nodeDependencies(node Node) []string {
+	switch casted := node.(type) {
+	case *Resource:
+		if len(casted.Edges) == 0 {
+			return casted.Dependencies
+		}
+		dependencies := append([]string(nil), casted.Dependencies...)
+		for _, edge := range casted.Edges {
+			dependencies = append(dependencies, edge.To)
+		}
+		return dependencies
+	case *ReferenceResource:
+		return casted.Dependencies
+	default:
+		return nil
+	}
+}
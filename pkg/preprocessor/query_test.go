@@ -0,0 +1,91 @@
+package preprocessor
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// newTestQueryTable returns a node table of a network module with a vpc and a subnet, and a bucket in the root module.
+func newTestQueryTable(t *testing.T) map[string]Node {
+	t.Helper()
+	nodeTable := newTestPlan(t, map[string][]string{
+		"module.network.aws_vpc.main":    {Action_no_op},
+		"module.network.aws_subnet.a[0]": {Action_create},
+		"aws_s3_bucket.logs":             {Action_update},
+	})
+	nodeTable[RootAddress+".module.network.aws_vpc.main"].(*Resource).addState(State_planned, map[string]interface{}{
+		"cidr_block": "10.0.0.0/16", "tags": map[string]interface{}{"env": "prod"},
+	})
+	subnet := nodeTable[RootAddress+".module.network.aws_subnet.a[0]"].(*Resource)
+	subnet.Dependencies = []string{RootAddress + ".module.network.aws_vpc.main"}
+	subnet.addState(State_planned, map[string]interface{}{"ingress": []interface{}{map[string]interface{}{"from_port": 443.0}}})
+	for _, name := range []string{"aws", "google"} {
+		provider, _ := NewProvider(RootAddress+".provider."+name, []string{})
+		provider.AddAttribute("name", name)
+		nodeTable[provider.GetAddress()] = provider
+	}
+	return nodeTable
+}
+
+func TestQueryNodeTable(t *testing.T) {
+	nodeTable := newTestQueryTable(t)
+	tests := []struct {
+		expression string
+		depth      int
+		want       []string
+	}{
+		{expression: "module.network.*", want: []string{"module.network.aws_subnet.a", "module.network.aws_subnet.a[0]", "module.network.aws_vpc.main"}},
+		{expression: `tags.env == "prod" or type == aws_s3_bucket`, want: []string{"aws_s3_bucket.logs", "module.network.aws_vpc.main"}},
+		{expression: "node == Resource and not action == NoOp", want: []string{"aws_s3_bucket.logs", "module.network.aws_subnet.a[0]"}},
+		{expression: "ingress.from_port >= 443", want: []string{"module.network.aws_subnet.a[0]"}},
+		{expression: "type == aws_vpc", depth: 1, want: []string{"module.network.aws_subnet.a[0]", "module.network.aws_vpc.main"}},
+	}
+	for _, test := range tests {
+		query, err := ParseQuery(test.expression)
+		if err != nil {
+			t.Fatalf("could not parse %s: %s", test.expression, err)
+		}
+		var addresses []string
+		for _, address := range QueryNodeTable(nodeTable, query, test.depth) {
+			addresses = append(addresses, TerraformAddress(address))
+		}
+		sort.Strings(addresses)
+		if !reflect.DeepEqual(addresses, test.want) {
+			t.Errorf("got %v for %s, want %v", addresses, test.expression, test.want)
+		}
+	}
+}
+
+func TestParseQueryRejectsInvalidExpressions(t *testing.T) {
+	for _, expression := range []string{"", "type ==", "(type == aws_vpc", "type == aws_vpc and"} {
+		if _, err := ParseQuery(expression); err == nil {
+			t.Errorf("parsed the invalid query '%s'", expression)
+		}
+	}
+}
+
+func TestFilterNodeTable(t *testing.T) {
+	nodeTable := newTestQueryTable(t)
+	query, err := ParseQuery("type == aws_subnet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filtered, err := FilterNodeTable(nodeTable, query, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		RootAddress,
+		RootAddress + ".module.network",
+		RootAddress + ".module.network.aws_subnet.a",
+		RootAddress + ".module.network.aws_subnet.a[0]",
+		RootAddress + ".provider.aws",
+	}
+	if addresses := sortedAddresses(filtered); !reflect.DeepEqual(addresses, want) {
+		t.Errorf("got nodes %v, want %v", addresses, want)
+	}
+	if children := filtered[RootAddress+".module.network"].GetChildren(); !reflect.DeepEqual(children, []string{RootAddress + ".module.network.aws_subnet.a"}) {
+		t.Errorf("got children %v of the module, want only the subnet", children)
+	}
+}
@@ -0,0 +1,246 @@
+package preprocessor
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+const (
+	remote_state_type         = "terraform_remote_state"
+	remote_state_default_name = "default"
+)
+
+// StateBackend describes where the state of a stack is stored, e.g. the s3 backend with bucket and key.
+// It is matched against the configuration of terraform_remote_state data sources in other stacks.
+type StateBackend struct {
+	Type string `json:"type"`
+	// Config contains the identifying settings of the backend. Nested settings like workspaces.name of the
+	// remote backend use dotted keys.
+	Config map[string]string `json:"config,omitempty"`
+	// Workspace is the terraform workspace of the stack, defaults to 'default'
+	Workspace string `json:"workspace,omitempty"`
+}
+
+// ParseStateBackend parses a backend description like s3:bucket=states,key=network.tfstate,workspace=prod.
+// The setting workspace is the terraform workspace, all other settings are backend settings.
+func ParseStateBackend(description string) (*StateBackend, error) {
+	backendType, settings, _ := strings.Cut(description, ":")
+	if backendType == "" {
+		return nil, fmt.Errorf("couldn't parse the backend '%s': the backend type is missing", description)
+	}
+	backend := &StateBackend{Type: backendType, Config: make(map[string]string)}
+	if settings == "" {
+		return backend, nil
+	}
+	for _, setting := range strings.Split(settings, ",") {
+		key, value, found := strings.Cut(setting, "=")
+		if !found || key == "" {
+			return nil, fmt.Errorf("couldn't parse the backend '%s': expected key=value but got '%s'", description, setting)
+		}
+		if key == "workspace" {
+			backend.Workspace = value
+			continue
+		}
+		backend.Config[key] = value
+	}
+	return backend, nil
+}
+
+func (backend *StateBackend) String() string {
+	keys := make([]string, 0, len(backend.Config))
+	for key := range backend.Config {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	settings := make([]string, 0, len(keys)+1)
+	for _, key := range keys {
+		settings = append(settings, key+"="+backend.Config[key])
+	}
+	if backend.Workspace != "" {
+		settings = append(settings, "workspace="+backend.Workspace)
+	}
+	return backend.Type + ":" + strings.Join(settings, ",")
+}
+
+// matches reports whether a terraform_remote_state data source with the given backend type, configuration
+// and workspace reads the state stored in the backend. Every setting of the backend has to be equal to the
+// respective setting of the data source, local paths only have to end with the path of the data source.
+func (backend *StateBackend) matches(backendType string, config map[string]interface{}, workspace string) bool {
+	if backend.Type != backendType {
+		return false
+	}
+	if workspaceOrDefault(backend.Workspace) != workspaceOrDefault(workspace) {
+		return false
+	}
+	flattened := make(map[string]interface{})
+	flattenAttributes("", config, flattened)
+	for key, expected := range backend.Config {
+		actual, ok := flattened[key]
+		if !ok {
+			return false
+		}
+		if backend.Type == "local" && key == "path" {
+			if !isPathSuffix(expected, fmt.Sprint(actual)) {
+				return false
+			}
+			continue
+		}
+		if fmt.Sprint(actual) != expected {
+			return false
+		}
+	}
+	return true
+}
+
+func workspaceOrDefault(workspace string) string {
+	if workspace == "" {
+		return remote_state_default_name
+	}
+	return workspace
+}
+
+// isPathSuffix reports whether the path ends with the suffix after leading ./ and ../ segments are removed from the suffix.
+func isPathSuffix(fullPath string, suffix string) bool {
+	fullPath = path.Clean(strings.ReplaceAll(fullPath, "\\", "/"))
+	suffix = path.Clean(strings.ReplaceAll(suffix, "\\", "/"))
+	for strings.HasPrefix(suffix, "../") {
+		suffix = strings.TrimPrefix(suffix, "../")
+	}
+	return fullPath == suffix || strings.HasSuffix(fullPath, "/"+suffix)
+}
+
+// RemoteStateLink describes a terraform_remote_state data source and the stack whose state it reads.
+type RemoteStateLink struct {
+	// Address is the address of the data source
+	Address string `json:"address"`
+	Stack   string `json:"stack"`
+	// Producer is the name of the stack whose state is read or empty if no stack matches
+	Producer string `json:"producer,omitempty"`
+	Backend  string `json:"backend"`
+}
+
+// remoteStateValue returns an attribute of a terraform_remote_state data source. Raw state files store
+// dynamically typed attributes like config together with their type, which is removed.
+func remoteStateValue(state map[string]interface{}, key string) interface{} {
+	value := state[key]
+	if wrapped, ok := value.(map[string]interface{}); ok && len(wrapped) == 2 {
+		if _, hasType := wrapped["type"]; hasType {
+			if unwrapped, hasValue := wrapped["value"]; hasValue {
+				return unwrapped
+			}
+		}
+	}
+	return value
+}
+
+// LinkRemoteStates matches the terraform_remote_state data sources of a merged node table with the backends of its stacks.
+// The data source gets an edge to every output of the stack whose state it reads. Resources that depend on the data source
+// get an edge to the outputs whose values occur in their attributes or, if there are none, to the root module of that stack.
+func LinkRemoteStates(nodeTable map[string]Node) []RemoteStateLink {
+	var stacks []*Stack
+	for _, address := range sortedAddresses(nodeTable) {
+		if stack, ok := nodeTable[address].(*Stack); ok && stack.Backend != nil {
+			stacks = append(stacks, stack)
+		}
+	}
+
+	var links []RemoteStateLink
+	for _, address := range sortedAddresses(nodeTable) {
+		dataSource, ok := nodeTable[address].(*Resource)
+		if !ok {
+			continue
+		}
+		parsed, ok := parseResourceAddress(address)
+		if !ok || parsed.Mode != Resource_mode_data || parsed.Type != remote_state_type {
+			continue
+		}
+		state := effectiveState(dataSource)
+		backendType, _ := remoteStateValue(state, "backend").(string)
+		config, _ := remoteStateValue(state, "config").(map[string]interface{})
+		workspace, _ := remoteStateValue(state, "workspace").(string)
+
+		consumer := StackOf(address)
+		link := RemoteStateLink{Address: address, Stack: consumer, Backend: backendType}
+		for _, stack := range stacks {
+			if stack.Name != consumer && stack.Backend.matches(backendType, config, workspace) {
+				link.Producer = stack.Name
+				linkRemoteState(nodeTable, dataSource, stack)
+				break
+			}
+		}
+		links = append(links, link)
+	}
+	return links
+}
+
+// linkRemoteState adds the edges from the data source and the resources that depend on it to the stack which it reads.
+func linkRemoteState(nodeTable map[string]Node, dataSource *Resource, producer *Stack) {
+	rootAddress := producer.Address + "." + RootAddress
+	reason := TerraformAddress(dataSource.Address)
+
+	var outputs []*Output
+	for _, child := range nodeTable[rootAddress].GetChildren() {
+		if output, ok := nodeTable[child].(*Output); ok {
+			outputs = append(outputs, output)
+			dataSource.addEdge(Edge{To: output.Address, Kind: Edge_kind_remote_state, Reason: reason})
+		}
+	}
+
+	referenceAddress := ""
+	if parsed, ok := parseResourceAddress(dataSource.Address); ok && parsed.Index != "" {
+		referenceAddress = strings.TrimSuffix(dataSource.Address, parsed.Index)
+	}
+	for _, address := range sortedAddresses(nodeTable) {
+		resource, ok := nodeTable[address].(*Resource)
+		if !ok || resource == dataSource || !containsString(resource.Dependencies, dataSource.Address, referenceAddress) {
+			continue
+		}
+		values := make(map[string]interface{})
+		flattenAttributes("", effectiveState(resource), values)
+		linked := false
+		for _, output := range outputs {
+			if output.Value != nil && hasAttributeValue(values, output.Value) {
+				resource.addEdge(Edge{To: output.Address, Kind: Edge_kind_remote_state, Reason: reason})
+				linked = true
+			}
+		}
+		if !linked {
+			resource.addEdge(Edge{To: rootAddress, Kind: Edge_kind_remote_state, Reason: reason})
+		}
+	}
+}
+
+// containsString reports whether the list contains one of the non empty values.
+func containsString(list []string, values ...string) bool {
+	for _, element := range list {
+		for _, value := range values {
+			if value != "" && element == value {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hasAttributeValue reports whether one of the flattened attributes equals the value. Empty strings and booleans are ignored
+// since they would match almost every resource.
+func hasAttributeValue(flattened map[string]interface{}, value interface{}) bool {
+	switch casted := value.(type) {
+	case string:
+		if casted == "" {
+			return false
+		}
+	case bool:
+		return false
+	case map[string]interface{}, []interface{}:
+		return false
+	}
+	for _, attribute := range flattened {
+		if attribute == value {
+			return true
+		}
+	}
+	return false
+}
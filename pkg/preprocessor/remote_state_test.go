@@ -0,0 +1,120 @@
+package preprocessor
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseStateBackend(t *testing.T) {
+	tests := []struct {
+		description string
+		want        *StateBackend
+	}{
+		{
+			description: "s3:bucket=states,key=network.tfstate,workspace=prod",
+			want:        &StateBackend{Type: "s3", Config: map[string]string{"bucket": "states", "key": "network.tfstate"}, Workspace: "prod"},
+		},
+		{
+			description: "remote:organization=acme,workspaces.name=network",
+			want:        &StateBackend{Type: "remote", Config: map[string]string{"organization": "acme", "workspaces.name": "network"}},
+		},
+		{description: "local", want: &StateBackend{Type: "local", Config: map[string]string{}}},
+	}
+	for _, test := range tests {
+		backend, err := ParseStateBackend(test.description)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(backend, test.want) {
+			t.Errorf("got backend %+v for %s, want %+v", backend, test.description, test.want)
+		}
+	}
+	if got := tests[0].want.String(); got != tests[0].description {
+		t.Errorf("got description %s, want %s", got, tests[0].description)
+	}
+
+	for _, description := range []string{"", ":bucket=states", "s3:bucket", "s3:=states", "s3:bucket=states,"} {
+		if _, err := ParseStateBackend(description); err == nil {
+			t.Errorf("parsed the invalid backend '%s'", description)
+		}
+	}
+}
+
+func TestStateBackendMatches(t *testing.T) {
+	s3 := &StateBackend{Type: "s3", Config: map[string]string{"bucket": "states", "key": "network.tfstate"}}
+	local := &StateBackend{Type: "local", Config: map[string]string{"path": "/work/stacks/network/terraform.tfstate"}}
+	tests := []struct {
+		name        string
+		backend     *StateBackend
+		backendType string
+		config      map[string]interface{}
+		workspace   string
+		want        bool
+	}{
+		{name: "equal settings", backend: s3, backendType: "s3", config: map[string]interface{}{"bucket": "states", "key": "network.tfstate", "region": "eu-west-1"}, want: true},
+		{name: "other type", backend: s3, backendType: "gcs", config: map[string]interface{}{"bucket": "states", "key": "network.tfstate"}},
+		{name: "other key", backend: s3, backendType: "s3", config: map[string]interface{}{"bucket": "states", "key": "app.tfstate"}},
+		{name: "missing setting", backend: s3, backendType: "s3", config: map[string]interface{}{"bucket": "states"}},
+		{name: "default workspace", backend: s3, backendType: "s3", config: map[string]interface{}{"bucket": "states", "key": "network.tfstate"}, workspace: "default", want: true},
+		{name: "other workspace", backend: s3, backendType: "s3", config: map[string]interface{}{"bucket": "states", "key": "network.tfstate"}, workspace: "prod"},
+		{
+			name:        "nested setting",
+			backend:     &StateBackend{Type: "remote", Config: map[string]string{"workspaces.name": "network"}},
+			backendType: "remote",
+			config:      map[string]interface{}{"organization": "acme", "workspaces": map[string]interface{}{"name": "network"}},
+			want:        true,
+		},
+		{name: "relative local path", backend: local, backendType: "local", config: map[string]interface{}{"path": "../network/terraform.tfstate"}, want: true},
+		{name: "windows local path", backend: local, backendType: "local", config: map[string]interface{}{"path": `..\..\stacks\network\terraform.tfstate`}, want: true},
+		{name: "equal local path", backend: local, backendType: "local", config: map[string]interface{}{"path": "/work/stacks/network/terraform.tfstate"}, want: true},
+		{name: "local path of another directory", backend: local, backendType: "local", config: map[string]interface{}{"path": "../app/terraform.tfstate"}},
+		{name: "local path with a partial directory name", backend: local, backendType: "local", config: map[string]interface{}{"path": "work/network/terraform.tfstate"}},
+		{name: "local path with a partial file name", backend: local, backendType: "local", config: map[string]interface{}{"path": "form.tfstate"}},
+	}
+	for _, test := range tests {
+		if got := test.backend.matches(test.backendType, test.config, test.workspace); got != test.want {
+			t.Errorf("%s: got %t, want %t", test.name, got, test.want)
+		}
+	}
+}
+
+func TestLinkRemoteStates(t *testing.T) {
+	networkBackend, err := ParseStateBackend("local:path=/work/stacks/network/terraform.tfstate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	merged, err := MergeDocuments([]StackInput{
+		{Name: "network", Document: readStackDocument(t, "stack_network.tfstate"), Backend: networkBackend},
+		{Name: "app", Document: readStackDocument(t, "stack_app.json")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	network := StackAddress("network") + "." + RootAddress
+	app := StackAddress("app") + "." + RootAddress
+
+	links := LinkRemoteStates(merged.Nodes)
+	wantLinks := []RemoteStateLink{
+		{Address: app + ".data.terraform_remote_state.network", Stack: "app", Producer: "network", Backend: "local"},
+		{Address: app + ".data.terraform_remote_state.shared", Stack: "app", Backend: "s3"},
+	}
+	if !reflect.DeepEqual(links, wantLinks) {
+		t.Errorf("got links %+v, want %+v", links, wantLinks)
+	}
+	reason := "data.terraform_remote_state.network"
+	wantEdges := map[string][]Edge{
+		// the data source reads all outputs, the security group uses the vpc_id, the instance none of them
+		app + ".data.terraform_remote_state.network": {
+			{To: network + ".output.db_password", Kind: Edge_kind_remote_state, Reason: reason},
+			{To: network + ".output.vpc_id", Kind: Edge_kind_remote_state, Reason: reason},
+		},
+		app + ".aws_security_group.app":             {{To: network + ".output.vpc_id", Kind: Edge_kind_remote_state, Reason: reason}},
+		app + ".aws_instance.app":                   {{To: network, Kind: Edge_kind_remote_state, Reason: reason}},
+		app + ".data.terraform_remote_state.shared": nil,
+	}
+	for address, want := range wantEdges {
+		if edges := merged.Nodes[address].(*Resource).Edges; !reflect.DeepEqual(edges, want) {
+			t.Errorf("got edges %+v of %s, want %+v", edges, address, want)
+		}
+	}
+}
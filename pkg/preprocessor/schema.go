@@ -0,0 +1,347 @@
+package preprocessor
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:embed karen.schema.json
+var karenSchema []byte
+
+// KarenSchema returns the JSON Schema of karen documents.
+func KarenSchema() []byte {
+	return karenSchema
+}
+
+// SchemaError describes a single violation of the karen schema. Path is a JSON pointer to the offending value.
+type SchemaError struct {
+	Path    string `json:"path"`
+	Message string `json:"message"`
+}
+
+// ValidationError is returned if a karen document does not conform to the karen schema.
+type ValidationError struct {
+	Errors []SchemaError `json:"errors"`
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, 0, len(e.Errors))
+	for _, schemaError := range e.Errors {
+		path := schemaError.Path
+		if path == "" {
+			path = "/"
+		}
+		messages = append(messages, path+": "+schemaError.Message)
+	}
+	return "invalid karen document: " + strings.Join(messages, "; ")
+}
+
+// schemaValidator validates json values against the subset of JSON Schema used by the karen schema:
+// $ref to $defs, type, const, enum, pattern, minLength, minimum, properties, required,
+// additionalProperties, items, allOf and if/then/else.
+type schemaValidator struct {
+	root    map[string]interface{}
+	errors  []SchemaError
+	regexps map[string]*regexp.Regexp
+}
+
+func newSchemaValidator(schema []byte) (*schemaValidator, error) {
+	var root map[string]interface{}
+	err := json.Unmarshal(schema, &root)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't parse the schema: %s", err.Error())
+	}
+	return &schemaValidator{root: root, regexps: make(map[string]*regexp.Regexp)}, nil
+}
+
+func (v *schemaValidator) addError(path string, format string, args ...interface{}) {
+	v.errors = append(v.errors, SchemaError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// escapeJSONPointer escapes a key for the use in a JSON pointer as described in RFC 6901.
+func escapeJSONPointer(key string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+}
+
+func (v *schemaValidator) resolve(ref string) (map[string]interface{}, error) {
+	if !strings.HasPrefix(ref, "#/") {
+		return nil, fmt.Errorf("unsupported reference '%s'", ref)
+	}
+	var current interface{} = v.root
+	for _, key := range strings.Split(strings.TrimPrefix(ref, "#/"), "/") {
+		object, ok := current.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("unresolvable reference '%s'", ref)
+		}
+		current = object[key]
+	}
+	schema, ok := current.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unresolvable reference '%s'", ref)
+	}
+	return schema, nil
+}
+
+// matches reports whether the value conforms to the schema without recording errors.
+func (v *schemaValidator) matches(schema map[string]interface{}, value interface{}) bool {
+	nested := &schemaValidator{root: v.root, regexps: v.regexps}
+	nested.validate(schema, value, "")
+	return len(nested.errors) == 0
+}
+
+func jsonType(value interface{}) string {
+	switch casted := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if casted == math.Trunc(casted) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+func isOfType(value interface{}, schemaType string) bool {
+	actual := jsonType(value)
+	return actual == schemaType || (schemaType == "number" && actual == "integer")
+}
+
+func (v *schemaValidator) validate(schema map[string]interface{}, value interface{}, path string) {
+	if ref, ok := schema["$ref"].(string); ok {
+		resolved, err := v.resolve(ref)
+		if err != nil {
+			v.addError(path, err.Error())
+			return
+		}
+		v.validate(resolved, value, path)
+		return
+	}
+
+	switch schemaType := schema["type"].(type) {
+	case string:
+		if !isOfType(value, schemaType) {
+			v.addError(path, "expected %s but got %s", schemaType, jsonType(value))
+			return
+		}
+	case []interface{}:
+		valid := false
+		var types []string
+		for _, candidate := range schemaType {
+			types = append(types, fmt.Sprint(candidate))
+			valid = valid || isOfType(value, fmt.Sprint(candidate))
+		}
+		if !valid {
+			v.addError(path, "expected %s but got %s", strings.Join(types, " or "), jsonType(value))
+			return
+		}
+	}
+
+	if constant, ok := schema["const"]; ok && !reflect.DeepEqual(constant, value) {
+		v.addError(path, "expected %v but got %v", constant, value)
+	}
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		var allowed []string
+		for _, candidate := range enum {
+			found = found || reflect.DeepEqual(candidate, value)
+			allowed = append(allowed, fmt.Sprintf("%v", candidate))
+		}
+		if !found {
+			v.addError(path, "value %v is not one of %s", value, strings.Join(allowed, ", "))
+		}
+	}
+
+	switch casted := value.(type) {
+	case string:
+		v.validateString(schema, casted, path)
+	case float64:
+		if minimum, ok := schema["minimum"].(float64); ok && casted < minimum {
+			v.addError(path, "value %v is less than the minimum %v", casted, minimum)
+		}
+	case []interface{}:
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for idx, item := range casted {
+				v.validate(items, item, path+"/"+strconv.Itoa(idx))
+			}
+		}
+	case map[string]interface{}:
+		v.validateObject(schema, casted, path)
+	}
+
+	if allOf, ok := schema["allOf"].([]interface{}); ok {
+		for _, nested := range allOf {
+			if nestedSchema, ok := nested.(map[string]interface{}); ok {
+				v.validate(nestedSchema, value, path)
+			}
+		}
+	}
+	if condition, ok := schema["if"].(map[string]interface{}); ok {
+		branch := "else"
+		if v.matches(condition, value) {
+			branch = "then"
+		}
+		if nestedSchema, ok := schema[branch].(map[string]interface{}); ok {
+			v.validate(nestedSchema, value, path)
+		}
+	}
+}
+
+func (v *schemaValidator) validateString(schema map[string]interface{}, value string, path string) {
+	if minLength, ok := schema["minLength"].(float64); ok && float64(len(value)) < minLength {
+		v.addError(path, "string is shorter than %v characters", minLength)
+	}
+	if pattern, ok := schema["pattern"].(string); ok {
+		compiled, ok := v.regexps[pattern]
+		if !ok {
+			var err error
+			compiled, err = regexp.Compile(pattern)
+			if err != nil {
+				v.addError(path, "invalid pattern '%s' in schema", pattern)
+				return
+			}
+			v.regexps[pattern] = compiled
+		}
+		if !compiled.MatchString(value) {
+			v.addError(path, "value '%s' does not match the pattern '%s'", value, pattern)
+		}
+	}
+}
+
+func (v *schemaValidator) validateObject(schema map[string]interface{}, value map[string]interface{}, path string) {
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, key := range required {
+			if _, ok := value[fmt.Sprint(key)]; !ok {
+				v.addError(path, "missing required property '%s'", key)
+			}
+		}
+	}
+
+	properties, _ := schema["properties"].(map[string]interface{})
+	keys := make([]string, 0, len(value))
+	for key := range value {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		childPath := path + "/" + escapeJSONPointer(key)
+		if propertySchema, ok := properties[key].(map[string]interface{}); ok {
+			v.validate(propertySchema, value[key], childPath)
+			continue
+		}
+		switch additional := schema["additionalProperties"].(type) {
+		case bool:
+			if !additional {
+				v.addError(childPath, "property '%s' is not allowed", key)
+			}
+		case map[string]interface{}:
+			v.validate(additional, value[key], childPath)
+		}
+	}
+}
+
+// ValidateKarenDocument validates a json formatted karen document, with or without envelope, against the karen schema,
+// checks that the node addresses are consistent and restores the document. Bare node tables are wrapped in an envelope.
+// Violations are returned as *ValidationError.
+func ValidateKarenDocument(karenFile []byte) (*KarenDocument, error) {
+	var value interface{}
+	err := json.Unmarshal(karenFile, &value)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't parse the given karen file: %s", err.Error())
+	}
+
+	validator, err := newSchemaValidator(karenSchema)
+	if err != nil {
+		return nil, err
+	}
+	nodesPath := "/nodes"
+	schema := validator.root
+	if rawDocument, ok := value.(map[string]interface{}); ok && !isKarenEnvelopeValue(rawDocument) {
+		nodesPath = ""
+		schema, err = validator.resolve("#/$defs/nodeTable")
+		if err != nil {
+			return nil, err
+		}
+	}
+	validator.validate(schema, value, "")
+	if len(validator.errors) > 0 {
+		return nil, &ValidationError{Errors: validator.errors}
+	}
+
+	document, err := ParseKarenDocument(karenFile)
+	if err != nil {
+		return nil, err
+	}
+	schemaErrors := normalizeNodeTable(document.Nodes, nodesPath)
+	if len(schemaErrors) > 0 {
+		return nil, &ValidationError{Errors: schemaErrors}
+	}
+	return document, nil
+}
+
+func isKarenEnvelopeValue(rawDocument map[string]interface{}) bool {
+	_, hasVersion := rawDocument["karenVersion"]
+	_, hasNodes := rawDocument["nodes"]
+	return hasVersion && hasNodes
+}
+
+// normalizeNodeTable checks that every node is stored under its own address and that all children and members of groups exist.
+// Duplicate children are removed.
+func normalizeNodeTable(nodeTable map[string]Node, nodesPath string) []SchemaError {
+	var schemaErrors []SchemaError
+	for _, address := range sortedAddresses(nodeTable) {
+		node := nodeTable[address]
+		nodePath := nodesPath + "/" + escapeJSONPointer(address)
+		if node.GetAddress() != address {
+			schemaErrors = append(schemaErrors, SchemaError{
+				Path:    nodePath + "/address",
+				Message: fmt.Sprintf("address '%s' differs from the key '%s' of the node", node.GetAddress(), address),
+			})
+		}
+
+		data := node.(nodeDataProvider).data()
+		seen := make(map[string]bool)
+		var children []string
+		for idx, child := range data.Children {
+			if _, ok := nodeTable[child]; !ok {
+				schemaErrors = append(schemaErrors, SchemaError{
+					Path:    nodePath + "/children/" + strconv.Itoa(idx),
+					Message: fmt.Sprintf("child '%s' does not exist", child),
+				})
+			}
+			if !seen[child] {
+				seen[child] = true
+				children = append(children, child)
+			}
+		}
+		data.Children = children
+
+		if group, ok := node.(*Group); ok {
+			for idx, member := range group.Members {
+				if _, ok := nodeTable[member]; !ok {
+					schemaErrors = append(schemaErrors, SchemaError{
+						Path:    nodePath + "/members/" + strconv.Itoa(idx),
+						Message: fmt.Sprintf("member '%s' does not exist", member),
+					})
+				}
+			}
+		}
+	}
+	return schemaErrors
+}
@@ -0,0 +1,224 @@
+package preprocessor
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestSchemaValidator(t *testing.T) {
+	validator, err := newSchemaValidator([]byte(`{
+		"$defs": {
+			"kind": {"enum": ["a", "b"]},
+			"port": {"type": "integer", "minimum": 0}
+		},
+		"type": "object",
+		"required": ["version"],
+		"additionalProperties": false,
+		"properties": {
+			"version": {"const": "1.0"},
+			"kind": {"$ref": "#/$defs/kind"},
+			"name": {"type": "string", "pattern": "^[a-z]+$", "minLength": 2},
+			"ports": {"type": "object", "additionalProperties": {"$ref": "#/$defs/port"}},
+			"tags": {"type": "array", "items": {"type": ["string", "null"]}},
+			"broken": {"$ref": "#/$defs/missing"}
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		value string
+		want  []SchemaError
+	}{
+		{name: "valid", value: `{"version": "1.0", "kind": "a", "name": "web", "ports": {"http": 80}, "tags": ["x", null]}`},
+		{name: "not an object", value: `[]`, want: []SchemaError{{Path: "", Message: "expected object but got array"}}},
+		{name: "required", value: `{}`, want: []SchemaError{{Path: "", Message: "missing required property 'version'"}}},
+		{name: "const", value: `{"version": "2.0"}`, want: []SchemaError{{Path: "/version", Message: "expected 1.0 but got 2.0"}}},
+		{name: "enum by reference", value: `{"version": "1.0", "kind": "c"}`, want: []SchemaError{{Path: "/kind", Message: "value c is not one of a, b"}}},
+		{name: "pattern", value: `{"version": "1.0", "name": "Web"}`, want: []SchemaError{{Path: "/name", Message: "value 'Web' does not match the pattern '^[a-z]+$'"}}},
+		{name: "min length", value: `{"version": "1.0", "name": "w"}`, want: []SchemaError{{Path: "/name", Message: "string is shorter than 2 characters"}}},
+		{name: "additional properties", value: `{"version": "1.0", "extra": true}`, want: []SchemaError{{Path: "/extra", Message: "property 'extra' is not allowed"}}},
+		{
+			name:  "additional properties schema",
+			value: `{"version": "1.0", "ports": {"a/b~c": -1, "https": 443.5}}`,
+			want: []SchemaError{
+				{Path: "/ports/a~1b~0c", Message: "value -1 is less than the minimum 0"},
+				{Path: "/ports/https", Message: "expected integer but got number"},
+			},
+		},
+		{name: "items", value: `{"version": "1.0", "tags": ["x", 1]}`, want: []SchemaError{{Path: "/tags/1", Message: "expected string or null but got integer"}}},
+		{name: "unresolvable reference", value: `{"version": "1.0", "broken": 1}`, want: []SchemaError{{Path: "/broken", Message: "unresolvable reference '#/$defs/missing'"}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var value interface{}
+			if err := json.Unmarshal([]byte(test.value), &value); err != nil {
+				t.Fatal(err)
+			}
+			validator.errors = nil
+			validator.validate(validator.root, value, "")
+			if !reflect.DeepEqual(validator.errors, test.want) {
+				t.Errorf("got errors %+v, want %+v", validator.errors, test.want)
+			}
+		})
+	}
+}
+
+// rawKarenDocument returns a karen document of the deposed state as a generic json value.
+func rawKarenDocument(t *testing.T) map[string]interface{} {
+	data, err := os.ReadFile("testdata/deposed_state.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	document, err := ParseDocument(data, Input_kind_state, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err = json.Marshal(document)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var rawDocument map[string]interface{}
+	err = json.Unmarshal(data, &rawDocument)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rawDocument
+}
+
+func TestValidateKarenDocument(t *testing.T) {
+	instanceAddress := RootAddress + ".aws_instance.web"
+	tests := []struct {
+		name   string
+		modify func(rawDocument map[string]interface{}) interface{}
+		want   []SchemaError
+	}{
+		{
+			name:   "envelope",
+			modify: func(rawDocument map[string]interface{}) interface{} { return rawDocument },
+		},
+		{
+			name:   "bare node table",
+			modify: func(rawDocument map[string]interface{}) interface{} { return rawDocument["nodes"] },
+		},
+		{
+			name: "unsupported version",
+			modify: func(rawDocument map[string]interface{}) interface{} {
+				rawDocument["karenVersion"] = "2.0"
+				return rawDocument
+			},
+			want: []SchemaError{{Path: "/karenVersion", Message: "value '2.0' does not match the pattern '^1\\.[0-9]+$'"}},
+		},
+		{
+			name: "unknown node type",
+			modify: func(rawDocument map[string]interface{}) interface{} {
+				nodes := rawDocument["nodes"].(map[string]interface{})
+				nodes[instanceAddress].(map[string]interface{})["nodeType"] = "Instance"
+				return rawDocument
+			},
+			want: []SchemaError{{
+				Path:    "/nodes/_root.aws_instance.web/nodeType",
+				Message: "value Instance is not one of Module, Resource, ReferenceResource, Provider, Stack, Output, Group, DeposedObject",
+			}},
+		},
+		{
+			name: "additional property of a resource",
+			modify: func(rawDocument map[string]interface{}) interface{} {
+				nodes := rawDocument["nodes"].(map[string]interface{})
+				nodes[instanceAddress].(map[string]interface{})["instance"] = true
+				return rawDocument["nodes"]
+			},
+			want: []SchemaError{{Path: "/_root.aws_instance.web/instance", Message: "property 'instance' is not allowed"}},
+		},
+		{
+			name: "address differs from the key",
+			modify: func(rawDocument map[string]interface{}) interface{} {
+				nodes := rawDocument["nodes"].(map[string]interface{})
+				nodes["_root.a/b~c"] = nodes[instanceAddress]
+				return rawDocument
+			},
+			want: []SchemaError{{
+				Path:    "/nodes/_root.a~1b~0c/address",
+				Message: "address '_root.aws_instance.web' differs from the key '_root.a/b~c' of the node",
+			}},
+		},
+		{
+			name: "dangling child",
+			modify: func(rawDocument map[string]interface{}) interface{} {
+				nodes := rawDocument["nodes"].(map[string]interface{})
+				resource := nodes[instanceAddress].(map[string]interface{})
+				resource["children"] = append(resource["children"].([]interface{}), "_root.aws_instance.gone")
+				return rawDocument["nodes"]
+			},
+			want: []SchemaError{{Path: "/_root.aws_instance.web/children/1", Message: "child '_root.aws_instance.gone' does not exist"}},
+		},
+		{
+			name: "dangling member",
+			modify: func(rawDocument map[string]interface{}) interface{} {
+				nodes := rawDocument["nodes"].(map[string]interface{})
+				nodes["_views"] = map[string]interface{}{
+					"address":  "_views",
+					"nodeType": Node_type_group,
+					"location": "",
+					"kind":     "team",
+					"name":     "platform",
+					"members":  []interface{}{instanceAddress, "_root.aws_instance.gone"},
+				}
+				return rawDocument
+			},
+			want: []SchemaError{{Path: "/nodes/_views/members/1", Message: "member '_root.aws_instance.gone' does not exist"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			data, err := json.Marshal(test.modify(rawKarenDocument(t)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			document, err := ValidateKarenDocument(data)
+			if test.want != nil {
+				var validationError *ValidationError
+				if !errors.As(err, &validationError) {
+					t.Fatalf("got error %v, want a validation error", err)
+				}
+				if !reflect.DeepEqual(validationError.Errors, test.want) {
+					t.Errorf("got errors %+v, want %+v", validationError.Errors, test.want)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if document.KarenVersion != KarenSchemaVersion || document.Metadata.InputKind == "" {
+				t.Errorf("got version '%s' and input kind '%s', want an envelope", document.KarenVersion, document.Metadata.InputKind)
+			}
+			if _, ok := document.Nodes[DeposedObjectAddress(instanceAddress, "00000001")].(*DeposedObject); !ok {
+				t.Errorf("the deposed object of %s is missing", instanceAddress)
+			}
+		})
+	}
+}
+
+func TestValidateKarenDocumentRemovesDuplicateChildren(t *testing.T) {
+	rawDocument := rawKarenDocument(t)
+	resource := rawDocument["nodes"].(map[string]interface{})[RootAddress+".aws_instance.web"].(map[string]interface{})
+	children := resource["children"].([]interface{})
+	resource["children"] = append(children, children...)
+	data, err := json.Marshal(rawDocument)
+	if err != nil {
+		t.Fatal(err)
+	}
+	document, err := ValidateKarenDocument(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{DeposedObjectAddress(RootAddress+".aws_instance.web", "00000001")}
+	if got := document.Nodes[RootAddress+".aws_instance.web"].GetChildren(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got children %v, want %v", got, want)
+	}
+}
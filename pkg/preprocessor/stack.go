@@ -0,0 +1,215 @@
+package preprocessor
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	tfjson "github.com/hashicorp/terraform-json"
+)
+
+const (
+	// StackAddressPrefix is the first segment of the addresses of stacks and their nodes in merged node tables.
+	// The root module of the stack prod has the address _stack.prod._root.
+	StackAddressPrefix = "_stack"
+)
+
+var stackNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// StackAddress returns the address of the stack with the given name.
+func StackAddress(name string) string {
+	return StackAddressPrefix + "." + name
+}
+
+// splitStackAddress splits the address of a node in a merged node table into the name of its stack
+// and its address within the stack. Addresses outside of a stack are returned unchanged with an empty stack name.
+func splitStackAddress(address string) (string, string) {
+	if !strings.HasPrefix(address, StackAddressPrefix+".") {
+		return "", address
+	}
+	stackAddress := strings.TrimPrefix(address, StackAddressPrefix+".")
+	idx := strings.Index(stackAddress, ".")
+	if idx < 0 {
+		return stackAddress, ""
+	}
+	return stackAddress[:idx], stackAddress[idx+1:]
+}
+
+// StackOf returns the name of the stack the node with the given address belongs to or an empty string
+// if the node table was not merged.
+func StackOf(address string) string {
+	stack, _ := splitStackAddress(address)
+	return stack
+}
+
+// ParseStackDocument parses an input like ParseDocument and additionally adds the outputs of the root module as Output
+// nodes, which terraform_remote_state data sources of other stacks are linked to when the inputs are merged. Values of
+// sensitive outputs are omitted. Karen documents keep the outputs they contain.
+func ParseStackDocument(data []byte, inputKind string, tfConfigUrl string, tfConfigMainPath string) (*KarenDocument, error) {
+	var err error
+	if inputKind == Input_kind_auto {
+		inputKind, err = DetectInputKind(data)
+		if err != nil {
+			return nil, err
+		}
+	}
+	document, err := ParseDocument(data, inputKind, tfConfigUrl, tfConfigMainPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var outputs map[string]*tfjson.StateOutput
+	switch inputKind {
+	case Input_kind_state:
+		state := new(tfjson.State)
+		err = state.UnmarshalJSON(data)
+		if err == nil && state.Values != nil {
+			outputs = state.Values.Outputs
+		}
+	case Input_kind_tfstate:
+		state := new(rawState)
+		err = json.Unmarshal(data, state)
+		outputs = make(map[string]*tfjson.StateOutput, len(state.Outputs))
+		for name, output := range state.Outputs {
+			outputs[name] = &tfjson.StateOutput{Value: output.Value, Sensitive: output.Sensitive}
+		}
+	case Input_kind_plan:
+		plan := new(tfjson.Plan)
+		err = plan.UnmarshalJSON(data)
+		if err == nil && plan.PriorState != nil && plan.PriorState.Values != nil {
+			outputs = plan.PriorState.Values.Outputs
+		} else if err == nil && plan.PlannedValues != nil {
+			outputs = plan.PlannedValues.Outputs
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	document.Nodes, err = parseTfjsonStateOutputs(outputs, document.Nodes)
+	if err != nil {
+		return nil, err
+	}
+	return document, nil
+}
+
+// StackInput is a karen document which is merged into a node table as the stack with the given name.
+type StackInput struct {
+	Name     string
+	Document *KarenDocument
+	// Backend optionally describes where the state of the stack is stored
+	Backend *StateBackend
+}
+
+// isMergedNodeTable reports whether the nodes of the node table are already namespaced by stacks.
+func isMergedNodeTable(nodeTable map[string]Node) bool {
+	if _, ok := nodeTable[RootAddress]; ok {
+		return false
+	}
+	for _, node := range nodeTable {
+		if node.GetNodeType() == Node_type_stack {
+			return true
+		}
+	}
+	return false
+}
+
+// MergeDocuments merges the node tables of several inputs, e.g. the states of different root modules or workspaces,
+// into one node table. Every input becomes a stack node whose child is the root module of the input, and the addresses
+// of all nodes of an input are prefixed with the address of its stack. Inputs which were merged before keep their stacks.
+func MergeDocuments(inputs []StackInput) (*KarenDocument, error) {
+	nodeTable := make(map[string]Node)
+	schemas := make(map[string]*ResourceSchema)
+	for _, input := range inputs {
+		// schema keys contain the provider and resource type, so inputs share the schemas of the same types
+		for key, schema := range input.Document.Schemas {
+			if _, ok := schemas[key]; !ok {
+				schemas[key] = schema
+			}
+		}
+		if isMergedNodeTable(input.Document.Nodes) {
+			for address, node := range input.Document.Nodes {
+				if _, ok := nodeTable[address]; ok {
+					return nil, fmt.Errorf("node '%s' is contained in more than one input", address)
+				}
+				nodeTable[address] = node
+			}
+			continue
+		}
+
+		if !stackNamePattern.MatchString(input.Name) {
+			return nil, fmt.Errorf("invalid stack name '%s', only letters, digits, '_' and '-' are allowed", input.Name)
+		}
+		stackAddress := StackAddress(input.Name)
+		if _, ok := nodeTable[stackAddress]; ok {
+			return nil, fmt.Errorf("stack '%s' is contained in more than one input", input.Name)
+		}
+		if _, ok := input.Document.Nodes[RootAddress]; !ok {
+			return nil, fmt.Errorf("the input of stack '%s' has no root module", input.Name)
+		}
+
+		metadata := input.Document.Metadata
+		stack, err := NewStack(input.Name, &metadata)
+		if err != nil {
+			return nil, err
+		}
+		stack.Backend = input.Backend
+		stack.AddChild(stackAddress + "." + RootAddress)
+		nodeTable[stackAddress] = stack
+
+		prefix := func(address string) string {
+			return stackAddress + "." + address
+		}
+		for _, node := range input.Document.Nodes {
+			cloned, err := cloneNode(node)
+			if err != nil {
+				return nil, err
+			}
+			rewriteNodeAddresses(cloned, prefix)
+			nodeTable[cloned.GetAddress()] = cloned
+		}
+	}
+
+	metadata := DocumentMetadata{
+		GeneratorVersion: GeneratorVersion,
+		InputKind:        Input_kind_merged,
+		ParsedAt:         time.Now().UTC(),
+		Redaction: RedactionSettings{
+			SensitiveValues: Redaction_sensitive_removed,
+		},
+	}
+	document := NewKarenDocument(nodeTable, metadata)
+	if len(schemas) > 0 {
+		document.Schemas = schemas
+	}
+	return document, nil
+}
+
+// rewriteNodeAddresses replaces the address of the node and all addresses it references with the result of rewrite.
+func rewriteNodeAddresses(n Node, rewrite func(string) string) {
+	rewriteAll := func(addresses []string) {
+		for idx, address := range addresses {
+			addresses[idx] = rewrite(address)
+		}
+	}
+	data := n.(nodeDataProvider).data()
+	data.Address = rewrite(data.Address)
+	rewriteAll(data.Children)
+	switch casted := n.(type) {
+	case *Resource:
+		rewriteAll(casted.Dependencies)
+		if casted.PreviousAddress != "" {
+			casted.PreviousAddress = rewrite(casted.PreviousAddress)
+		}
+		for idx := range casted.Edges {
+			casted.Edges[idx].To = rewrite(casted.Edges[idx].To)
+		}
+	case *ReferenceResource:
+		rewriteAll(casted.Dependencies)
+	case *DeposedObject:
+		rewriteAll(casted.Dependencies)
+	case *Group:
+		rewriteAll(casted.Members)
+	}
+}
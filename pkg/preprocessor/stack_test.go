@@ -0,0 +1,94 @@
+package preprocessor
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+// readStackDocument parses a fixture of the testdata directory with its outputs.
+func readStackDocument(t *testing.T, name string) *KarenDocument {
+	data, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	document, err := ParseStackDocument(data, Input_kind_auto, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return document
+}
+
+func TestMergeDocuments(t *testing.T) {
+	networkBackend, err := ParseStateBackend("local:path=/work/stacks/network/terraform.tfstate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	merged, err := MergeDocuments([]StackInput{
+		{Name: "network", Document: readStackDocument(t, "stack_network.tfstate"), Backend: networkBackend},
+		{Name: "app", Document: readStackDocument(t, "stack_app.json")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if merged.Metadata.InputKind != Input_kind_merged {
+		t.Errorf("got input kind %s, want %s", merged.Metadata.InputKind, Input_kind_merged)
+	}
+
+	network := StackAddress("network") + "." + RootAddress
+	app := StackAddress("app") + "." + RootAddress
+	stack, ok := merged.Nodes[StackAddress("network")].(*Stack)
+	if !ok {
+		t.Fatalf("the stack network is missing")
+	}
+	if !reflect.DeepEqual(stack.GetChildren(), []string{network}) || stack.Metadata.InputKind != Input_kind_tfstate || stack.Backend != networkBackend {
+		t.Errorf("got stack %+v, want the root module, the metadata and the backend of the input", stack)
+	}
+	for _, address := range []string{network + ".aws_vpc.main", network + ".output.vpc_id", network + ".output.db_password", app + ".output.app_sg"} {
+		if _, ok := merged.Nodes[address]; !ok {
+			t.Errorf("the node %s is missing", address)
+		}
+	}
+	if _, ok := merged.Nodes[RootAddress]; ok {
+		t.Errorf("the root module is not prefixed with its stack")
+	}
+	if value := merged.Nodes[network+".output.db_password"].(*Output).Value; value != nil {
+		t.Errorf("got value %v of a sensitive output", value)
+	}
+	instance := merged.Nodes[app+".aws_instance.app"].(*Resource)
+	wantDependencies := []string{app + ".aws_security_group.app", app + ".data.terraform_remote_state.network"}
+	if !reflect.DeepEqual(instance.Dependencies, wantDependencies) {
+		t.Errorf("got dependencies %v, want %v", instance.Dependencies, wantDependencies)
+	}
+
+	// merged inputs keep their stacks when they are merged again
+	remerged, err := MergeDocuments([]StackInput{
+		{Name: "ignored", Document: merged},
+		{Name: "shared", Document: readStackDocument(t, "stack_network.tfstate")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, address := range []string{StackAddress("network"), network + ".aws_vpc.main", app + ".aws_instance.app", StackAddress("shared") + "." + RootAddress + ".aws_vpc.main"} {
+		if _, ok := remerged.Nodes[address]; !ok {
+			t.Errorf("the node %s is missing after merging again", address)
+		}
+	}
+	if _, ok := remerged.Nodes[StackAddress("ignored")]; ok {
+		t.Errorf("a merged input became a stack")
+	}
+	if len(remerged.Nodes) != len(merged.Nodes)+len(readStackDocument(t, "stack_network.tfstate").Nodes)+1 {
+		t.Errorf("got %d nodes after merging again, want the nodes of the inputs and one stack", len(remerged.Nodes))
+	}
+
+	invalidInputs := [][]StackInput{
+		{{Name: "network", Document: readStackDocument(t, "stack_network.tfstate")}, {Name: "network", Document: readStackDocument(t, "stack_app.json")}},
+		{{Name: "prod.network", Document: readStackDocument(t, "stack_network.tfstate")}},
+		{{Document: merged}, {Document: merged}},
+	}
+	for _, inputs := range invalidInputs {
+		if _, err := MergeDocuments(inputs); err == nil {
+			t.Errorf("merged the invalid inputs %+v", inputs)
+		}
+	}
+}
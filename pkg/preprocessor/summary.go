@@ -0,0 +1,521 @@
+package preprocessor
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	sensitive_value_placeholder = "(sensitive value)"
+	unset_value_placeholder     = "(not set)"
+	unknown_value_placeholder   = "(known after apply)"
+	summary_max_value_length    = 80
+)
+
+// summaryActions are the actions a resource is counted under in a plan summary, ordered by their importance.
+var summaryActions = []string{Action_replace, Action_delete, Action_create, Action_update, Action_read, Action_no_op}
+
+// PlanSummary is a human-readable report of the changes in a plan node table.
+type PlanSummary struct {
+	// ActionCounts contains the number of resources per action
+	ActionCounts map[string]int `json:"actionCounts"`
+	// Groups contain the number of resources per action for every module and resource type
+	Groups []SummaryGroup `json:"groups,omitempty"`
+	// Replacements contain the addresses of the resources that are replaced
+	Replacements []string `json:"replacements,omitempty"`
+	// Deletions contain the addresses of the resources that are deleted
+	Deletions []string `json:"deletions,omitempty"`
+	// Moves contain the resources that are moved to another address
+	Moves []ResourceMove `json:"moves,omitempty"`
+	// Imports contain the resources that are imported
+	Imports []ImportBlock `json:"imports,omitempty"`
+	// Resources contain all resources which are not left unchanged by the plan
+	Resources []ResourceSummary `json:"resources,omitempty"`
+	// Reviewers are the code owners of the changed resources who must review the plan
+	Reviewers []string `json:"reviewers,omitempty"`
+	// Cost is the estimated monthly cost before and after the plan, if a price sheet was given
+	Cost *CostReport `json:"cost,omitempty"`
+}
+
+// ResourceMove is a resource which a plan moves from its previous address.
+type ResourceMove struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// SummaryGroup counts the actions performed on the resources of one type within one module.
+type SummaryGroup struct {
+	Module       string         `json:"module"`
+	ResourceType string         `json:"resourceType"`
+	ActionCounts map[string]int `json:"actionCounts"`
+}
+
+// ResourceSummary describes the changes of a single resource.
+type ResourceSummary struct {
+	Address string   `json:"address"`
+	Action  string   `json:"action"`
+	Actions []string `json:"actions"`
+	// Changes contain the attributes whose values differ between the current and the planned state
+	Changes []AttributeChange `json:"changes,omitempty"`
+	// SensitiveAttributes contain the attributes whose values were removed because they are sensitive
+	SensitiveAttributes []string `json:"sensitiveAttributes,omitempty"`
+	// Owners are the code owners of the resource, if code owners were added to the node table
+	Owners []string `json:"owners,omitempty"`
+}
+
+// AttributeChange describes the change of a single attribute. Values are nil if the attribute is not set.
+type AttributeChange struct {
+	Path   string      `json:"path"`
+	Before interface{} `json:"before,omitempty"`
+	After  interface{} `json:"after,omitempty"`
+}
+
+// summaryAction returns the action under which a resource is counted or an empty string if no action is performed on it.
+func summaryAction(resource *Resource) string {
+	for _, action := range summaryActions {
+		if resource.HasAction(action) {
+			return action
+		}
+	}
+	return ""
+}
+
+// SummarizePlan generates a summary of the changes that are contained in a plan node table.
+func SummarizePlan(nodeTable map[string]Node) *PlanSummary {
+	summary := &PlanSummary{ActionCounts: make(map[string]int)}
+	groups := make(map[string]*SummaryGroup)
+
+	for _, address := range sortedAddresses(nodeTable) {
+		resource, ok := nodeTable[address].(*Resource)
+		instanceAddress, terraformAddress := address, TerraformAddress(address)
+		if deposedObject, isDeposed := nodeTable[address].(*DeposedObject); isDeposed {
+			// deposed objects are summarized like terraform shows them, under the address of their instance
+			resource, ok = deposedObject.Resource, true
+			instanceAddress = strings.TrimSuffix(address, DeposedObjectAddress("", deposedObject.DeposedKey))
+			terraformAddress = fmt.Sprintf("%s (deposed object %s)", TerraformAddress(instanceAddress), deposedObject.DeposedKey)
+		}
+		if !ok {
+			continue
+		}
+		action := summaryAction(resource)
+		if action == "" {
+			continue
+		}
+		summary.ActionCounts[action]++
+
+		parsed, _ := parseResourceAddress(instanceAddress)
+		groupKey := parsed.Module + " " + parsed.Type
+		group, ok := groups[groupKey]
+		if !ok {
+			group = &SummaryGroup{Module: parsed.Module, ResourceType: parsed.Type, ActionCounts: make(map[string]int)}
+			groups[groupKey] = group
+		}
+		group.ActionCounts[action]++
+
+		if resource.HasAction(Action_move) {
+			summary.ActionCounts[Action_move]++
+			summary.Moves = append(summary.Moves, ResourceMove{From: TerraformAddress(resource.PreviousAddress), To: terraformAddress})
+		}
+		if resource.HasAction(Action_import) {
+			summary.ActionCounts[Action_import]++
+			summary.Imports = append(summary.Imports, ImportBlock{To: terraformAddress, ID: resource.ImportID})
+		}
+		switch action {
+		case Action_replace:
+			summary.Replacements = append(summary.Replacements, terraformAddress)
+		case Action_delete:
+			summary.Deletions = append(summary.Deletions, terraformAddress)
+		case Action_no_op, Action_read:
+			continue
+		}
+
+		resourceSummary := ResourceSummary{
+			Address:             terraformAddress,
+			Action:              action,
+			Actions:             resource.Actions,
+			SensitiveAttributes: sensitiveAttributesOf(resource),
+			Owners:              attributeStrings(resource, Attribute_code_owners),
+		}
+		if action != Action_delete {
+			resourceSummary.Changes = diffStates(resource.States[State_current], resource.States[State_planned], resource.UnknownAttributes)
+			for idx, change := range resourceSummary.Changes {
+				if isNestedPath(change.Path, resourceSummary.SensitiveAttributes) {
+					resourceSummary.Changes[idx].Before = sensitive_value_placeholder
+					resourceSummary.Changes[idx].After = sensitive_value_placeholder
+				}
+			}
+		}
+		summary.Resources = append(summary.Resources, resourceSummary)
+		summary.Reviewers = sortedUnion(summary.Reviewers, resourceSummary.Owners)
+	}
+
+	for _, group := range groups {
+		summary.Groups = append(summary.Groups, *group)
+	}
+	sort.Slice(summary.Groups, func(i, j int) bool {
+		if summary.Groups[i].Module != summary.Groups[j].Module {
+			return summary.Groups[i].Module < summary.Groups[j].Module
+		}
+		return summary.Groups[i].ResourceType < summary.Groups[j].ResourceType
+	})
+	return summary
+}
+
+// sortedAddresses returns the addresses of the node table in lexical order.
+func sortedAddresses(nodeTable map[string]Node) []string {
+	addresses := make([]string, 0, len(nodeTable))
+	for address := range nodeTable {
+		addresses = append(addresses, address)
+	}
+	sort.Strings(addresses)
+	return addresses
+}
+
+func sensitiveAttributesOf(resource *Resource) []string {
+	unique := make(map[string]bool)
+	for _, paths := range resource.SensitiveAttributes {
+		for _, path := range paths {
+			unique[path] = true
+		}
+	}
+	var sensitiveAttributes []string
+	for path := range unique {
+		sensitiveAttributes = append(sensitiveAttributes, path)
+	}
+	sort.Strings(sensitiveAttributes)
+	return sensitiveAttributes
+}
+
+// flattenAttributes maps the path of every leaf value in the attributes to its value. Empty maps and lists are leaf values.
+func flattenAttributes(prefix string, value interface{}, flattened map[string]interface{}) {
+	switch casted := value.(type) {
+	case map[string]interface{}:
+		if len(casted) == 0 && prefix != "" {
+			flattened[prefix] = casted
+		}
+		for key, nested := range casted {
+			path := key
+			if prefix != "" {
+				path = prefix + "." + key
+			}
+			flattenAttributes(path, nested, flattened)
+		}
+	case []interface{}:
+		if len(casted) == 0 {
+			flattened[prefix] = casted
+		}
+		for idx, nested := range casted {
+			flattenAttributes(prefix+"["+strconv.Itoa(idx)+"]", nested, flattened)
+		}
+	default:
+		flattened[prefix] = casted
+	}
+}
+
+// diffStates returns the changes between two states ordered by the path of the attribute. Attributes which are or
+// are nested in one of the unknown paths are only known after apply and are always reported as changed.
+func diffStates(before map[string]interface{}, after map[string]interface{}, unknown []string) []AttributeChange {
+	flattenedBefore := make(map[string]interface{})
+	flattenedAfter := make(map[string]interface{})
+	flattenAttributes("", before, flattenedBefore)
+	flattenAttributes("", after, flattenedAfter)
+
+	var changes []AttributeChange
+	reported := make(map[string]bool)
+	for path, beforeValue := range flattenedBefore {
+		if isNestedPath(path, unknown) {
+			changes = append(changes, AttributeChange{Path: path, Before: beforeValue, After: unknown_value_placeholder})
+			reported[path] = true
+			continue
+		}
+		afterValue, ok := flattenedAfter[path]
+		if !ok || !reflect.DeepEqual(beforeValue, afterValue) {
+			changes = append(changes, AttributeChange{Path: path, Before: beforeValue, After: afterValue})
+		}
+	}
+	for path, afterValue := range flattenedAfter {
+		if _, ok := flattenedBefore[path]; !ok && !isNestedPath(path, unknown) {
+			changes = append(changes, AttributeChange{Path: path, After: afterValue})
+		}
+	}
+	for _, path := range unknown {
+		coveredByBefore := false
+		for beforePath := range reported {
+			if isNestedPath(beforePath, []string{path}) {
+				coveredByBefore = true
+				break
+			}
+		}
+		if !coveredByBefore {
+			changes = append(changes, AttributeChange{Path: path, After: unknown_value_placeholder})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	return changes
+}
+
+// isNestedPath reports whether the attribute with the given path is or is nested in one of the attributes with the
+// given paths, e.g. a sensitive attribute.
+func isNestedPath(path string, paths []string) bool {
+	for _, parentPath := range paths {
+		if path == parentPath || strings.HasPrefix(path, parentPath+".") || strings.HasPrefix(path, parentPath+"[") {
+			return true
+		}
+	}
+	return false
+}
+
+// formatSummaryValue renders a value for a report.
+func formatSummaryValue(value interface{}) string {
+	if value == sensitive_value_placeholder || value == unknown_value_placeholder {
+		return value.(string)
+	}
+	if value == nil {
+		return unset_value_placeholder
+	}
+	formatted, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	if len(formatted) > summary_max_value_length {
+		return string(formatted[:summary_max_value_length-3]) + "..."
+	}
+	return string(formatted)
+}
+
+// Headline returns a one line overview of the summary like terraform prints it after planning.
+func (summary *PlanSummary) Headline() string {
+	if summary.ActionCounts[Action_create]+summary.ActionCounts[Action_update]+
+		summary.ActionCounts[Action_replace]+summary.ActionCounts[Action_delete]+summary.ActionCounts[Action_import] == 0 {
+		if summary.ActionCounts[Action_move] > 0 {
+			return fmt.Sprintf("No changes, %d to move.", summary.ActionCounts[Action_move])
+		}
+		return "No changes."
+	}
+	headline := fmt.Sprintf("%d to add, %d to change, %d to replace, %d to destroy.",
+		summary.ActionCounts[Action_create],
+		summary.ActionCounts[Action_update],
+		summary.ActionCounts[Action_replace],
+		summary.ActionCounts[Action_delete],
+	)
+	if summary.ActionCounts[Action_import] > 0 {
+		headline = fmt.Sprintf("%d to import, %s", summary.ActionCounts[Action_import], headline)
+	}
+	if summary.ActionCounts[Action_move] > 0 {
+		headline = fmt.Sprintf("%s, %d to move.", strings.TrimSuffix(headline, "."), summary.ActionCounts[Action_move])
+	}
+	return headline
+}
+
+func moduleLabel(module string) string {
+	if module == "" {
+		return "(root)"
+	}
+	return module
+}
+
+func escapeMarkdownCell(value string) string {
+	return strings.ReplaceAll(value, "|", "\\|")
+}
+
+// Markdown renders the summary as markdown, e.g. to post it as a comment on a merge request.
+func (summary *PlanSummary) Markdown() string {
+	var b strings.Builder
+	b.WriteString("## Plan summary\n\n")
+	b.WriteString("**" + summary.Headline() + "**\n\n")
+
+	b.WriteString("| Action | Resources |\n|---|---:|\n")
+	for _, action := range summaryActions {
+		fmt.Fprintf(&b, "| %s | %d |\n", action, summary.ActionCounts[action])
+	}
+
+	if len(summary.Replacements) > 0 {
+		b.WriteString("\n### :warning: Replacements\n\n")
+		for _, address := range summary.Replacements {
+			fmt.Fprintf(&b, "- `%s`\n", address)
+		}
+	}
+	if len(summary.Deletions) > 0 {
+		b.WriteString("\n### :x: Deletions\n\n")
+		for _, address := range summary.Deletions {
+			fmt.Fprintf(&b, "- `%s`\n", address)
+		}
+	}
+
+	if len(summary.Moves) > 0 {
+		b.WriteString("\n### Moves\n\n")
+		for _, move := range summary.Moves {
+			fmt.Fprintf(&b, "- `%s` → `%s`\n", move.From, move.To)
+		}
+	}
+	if len(summary.Imports) > 0 {
+		b.WriteString("\n### Imports\n\n")
+		for _, block := range summary.Imports {
+			fmt.Fprintf(&b, "- `%s` (id `%s`)\n", block.To, block.ID)
+		}
+	}
+
+	if summary.Cost != nil {
+		cost := summary.Cost
+		b.WriteString("\n### Estimated monthly cost\n\n")
+		fmt.Fprintf(&b, "**%s → %s (%s)**\n", formatCost(cost.Current, cost.Currency, false), formatCost(cost.Planned, cost.Currency, false), formatCost(cost.Delta, cost.Currency, true))
+		if changed := cost.Changed(); len(changed) > 0 {
+			b.WriteString("\n| Resource | Current | Planned | Delta |\n|---|---:|---:|---:|\n")
+			for _, resource := range changed {
+				fmt.Fprintf(&b, "| `%s` | %s | %s | %s |\n", resource.Address, formatCost(resource.Current, "", false), formatCost(resource.Planned, "", false), formatCost(resource.Delta, "", true))
+			}
+		}
+		if len(cost.Unpriced) > 0 {
+			b.WriteString("\nNot priced:\n\n")
+			for _, unpriced := range cost.Unpriced {
+				fmt.Fprintf(&b, "- `%s`\n", unpriced)
+			}
+		}
+	}
+
+	if len(summary.Reviewers) > 0 {
+		b.WriteString("\n### Owners who must review\n\n")
+		for _, reviewer := range summary.Reviewers {
+			fmt.Fprintf(&b, "- %s\n", reviewer)
+		}
+	}
+
+	if len(summary.Groups) > 0 {
+		b.WriteString("\n### Changes by module and resource type\n\n")
+		b.WriteString("| Module | Resource type |")
+		for _, action := range summaryActions {
+			b.WriteString(" " + action + " |")
+		}
+		b.WriteString("\n|---|---|" + strings.Repeat("---:|", len(summaryActions)) + "\n")
+		for _, group := range summary.Groups {
+			fmt.Fprintf(&b, "| `%s` | `%s` |", moduleLabel(group.Module), group.ResourceType)
+			for _, action := range summaryActions {
+				fmt.Fprintf(&b, " %d |", group.ActionCounts[action])
+			}
+			b.WriteString("\n")
+		}
+	}
+
+	if len(summary.Resources) > 0 {
+		b.WriteString("\n### Changed resources\n")
+		for _, resource := range summary.Resources {
+			fmt.Fprintf(&b, "\n<details><summary><code>%s</code> (%s)</summary>\n\n", resource.Address, resource.Action)
+			if resource.Action == Action_delete {
+				b.WriteString("The resource will be destroyed.\n")
+			} else if len(resource.Changes) > 0 {
+				b.WriteString("| Attribute | Before | After |\n|---|---|---|\n")
+				for _, change := range resource.Changes {
+					fmt.Fprintf(&b, "| `%s` | `%s` | `%s` |\n",
+						escapeMarkdownCell(change.Path),
+						escapeMarkdownCell(formatSummaryValue(change.Before)),
+						escapeMarkdownCell(formatSummaryValue(change.After)),
+					)
+				}
+			} else {
+				b.WriteString("No attribute changes.\n")
+			}
+			if len(resource.SensitiveAttributes) > 0 {
+				fmt.Fprintf(&b, "\nSensitive attributes (values hidden): `%s`\n", strings.Join(resource.SensitiveAttributes, "`, `"))
+			}
+			if len(resource.Owners) > 0 {
+				fmt.Fprintf(&b, "\nOwners: %s\n", strings.Join(resource.Owners, ", "))
+			}
+			b.WriteString("\n</details>\n")
+		}
+	}
+	return b.String()
+}
+
+// Text renders the summary as plain text, e.g. to print it in a terminal.
+func (summary *PlanSummary) Text() string {
+	var b strings.Builder
+	b.WriteString("Plan summary: " + summary.Headline() + "\n\n")
+
+	for _, action := range summaryActions {
+		fmt.Fprintf(&b, "  %-8s %d\n", action, summary.ActionCounts[action])
+	}
+
+	if len(summary.Replacements) > 0 {
+		b.WriteString("\nReplacements:\n")
+		for _, address := range summary.Replacements {
+			fmt.Fprintf(&b, "  ! %s\n", address)
+		}
+	}
+	if len(summary.Deletions) > 0 {
+		b.WriteString("\nDeletions:\n")
+		for _, address := range summary.Deletions {
+			fmt.Fprintf(&b, "  - %s\n", address)
+		}
+	}
+
+	if len(summary.Moves) > 0 {
+		b.WriteString("\nMoves:\n")
+		for _, move := range summary.Moves {
+			fmt.Fprintf(&b, "  > %s -> %s\n", move.From, move.To)
+		}
+	}
+	if len(summary.Imports) > 0 {
+		b.WriteString("\nImports:\n")
+		for _, block := range summary.Imports {
+			fmt.Fprintf(&b, "  + %s (id %s)\n", block.To, block.ID)
+		}
+	}
+
+	if summary.Cost != nil {
+		cost := summary.Cost
+		fmt.Fprintf(&b, "\nEstimated monthly cost: %s -> %s (%s)\n", formatCost(cost.Current, cost.Currency, false), formatCost(cost.Planned, cost.Currency, false), formatCost(cost.Delta, cost.Currency, true))
+		for _, resource := range cost.Changed() {
+			fmt.Fprintf(&b, "  %s: %s -> %s (%s)\n", resource.Address, formatCost(resource.Current, "", false), formatCost(resource.Planned, "", false), formatCost(resource.Delta, "", true))
+		}
+		for _, unpriced := range cost.Unpriced {
+			fmt.Fprintf(&b, "  not priced: %s\n", unpriced)
+		}
+	}
+
+	if len(summary.Reviewers) > 0 {
+		b.WriteString("\nOwners who must review:\n")
+		for _, reviewer := range summary.Reviewers {
+			fmt.Fprintf(&b, "  %s\n", reviewer)
+		}
+	}
+
+	if len(summary.Groups) > 0 {
+		b.WriteString("\nChanges by module and resource type:\n")
+		for _, group := range summary.Groups {
+			var counts []string
+			for _, action := range summaryActions {
+				if group.ActionCounts[action] > 0 {
+					counts = append(counts, fmt.Sprintf("%s=%d", action, group.ActionCounts[action]))
+				}
+			}
+			fmt.Fprintf(&b, "  %s %s: %s\n", moduleLabel(group.Module), group.ResourceType, strings.Join(counts, " "))
+		}
+	}
+
+	if len(summary.Resources) > 0 {
+		b.WriteString("\nChanged resources:\n")
+		for _, resource := range summary.Resources {
+			fmt.Fprintf(&b, "\n  %s (%s)\n", resource.Address, resource.Action)
+			for _, change := range resource.Changes {
+				fmt.Fprintf(&b, "    %s: %s -> %s\n",
+					change.Path,
+					formatSummaryValue(change.Before),
+					formatSummaryValue(change.After),
+				)
+			}
+			if len(resource.SensitiveAttributes) > 0 {
+				fmt.Fprintf(&b, "    sensitive attributes (values hidden): %s\n", strings.Join(resource.SensitiveAttributes, ", "))
+			}
+			if len(resource.Owners) > 0 {
+				fmt.Fprintf(&b, "    owners: %s\n", strings.Join(resource.Owners, ", "))
+			}
+		}
+	}
+	return b.String()
+}
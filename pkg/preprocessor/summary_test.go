@@ -0,0 +1,44 @@
+package preprocessor
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffStates(t *testing.T) {
+	before := map[string]interface{}{
+		"id":            "i-1",
+		"instance_type": "t3.micro",
+		"ebs":           []interface{}{map[string]interface{}{"volume_id": "vol-1", "size": 8.0}},
+		"tags":          map[string]interface{}{"env": "prod"},
+	}
+	after := map[string]interface{}{
+		"instance_type": "t3.large",
+		"tags":          map[string]interface{}{"env": "prod", "team": "web"},
+	}
+	unknown := []string{"arn", "ebs", "id"}
+
+	want := []AttributeChange{
+		{Path: "arn", After: unknown_value_placeholder},
+		{Path: "ebs[0].size", Before: 8.0, After: unknown_value_placeholder},
+		{Path: "ebs[0].volume_id", Before: "vol-1", After: unknown_value_placeholder},
+		{Path: "id", Before: "i-1", After: unknown_value_placeholder},
+		{Path: "instance_type", Before: "t3.micro", After: "t3.large"},
+		{Path: "tags.team", After: "web"},
+	}
+	if changes := diffStates(before, after, unknown); !reflect.DeepEqual(changes, want) {
+		t.Errorf("got changes %+v, want %+v", changes, want)
+	}
+}
+
+func TestUnknownPaths(t *testing.T) {
+	afterUnknown := map[string]interface{}{
+		"id":   true,
+		"tags": map[string]interface{}{},
+		"ebs":  []interface{}{map[string]interface{}{"volume_id": true, "size": false}},
+	}
+	want := []string{"ebs[0].volume_id", "id"}
+	if paths := unknownPaths("", afterUnknown); !reflect.DeepEqual(paths, want) {
+		t.Errorf("got paths %v, want %v", paths, want)
+	}
+}
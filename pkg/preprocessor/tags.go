@@ -0,0 +1,324 @@
+package preprocessor
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Node attributes resolved from the tags of a resource
+const (
+	Attribute_owner        = "owner"
+	Attribute_environment  = "environment"
+	Attribute_missing_tags = "missingTags"
+)
+
+// TagViewAddress is the address of the root group of the tag view.
+const TagViewAddress = "_tags"
+
+// Kinds of the groups of the tag view
+const (
+	Group_kind_tag_view  = "tag_view"
+	Group_kind_tag_value = "tag_value"
+	Group_kind_untagged  = "untagged"
+)
+
+// tagAttributes are the state attributes holding the tags of aws and azurerm resources and the labels of google resources.
+// tags_all and effective_labels additionally contain the default tags of the provider.
+var tagAttributes = map[string][]string{
+	"tags":   {"tags_all", "tags"},
+	"labels": {"effective_labels", "labels"},
+}
+
+// TagOptions configures how tags are resolved by ResolveTags.
+type TagOptions struct {
+	// GroupBy is the tag key the resources are grouped by in the tag view, like team, tags.team or labels.env.
+	// A tags. or labels. prefix restricts the lookup to the tags of aws and azurerm or the labels of google resources.
+	GroupBy string
+	// Ownership adds the owner and environment of every resource as attributes
+	Ownership       bool
+	OwnerKeys       []string
+	EnvironmentKeys []string
+	// Required are the tag keys every taggable resource must have
+	Required []string
+	// ModuleDefaults are default tags by module path like module.network, the root module has the empty path.
+	// They are inherited by the resources of the module and its child modules, in addition to the default tags
+	// of the provider configurations.
+	ModuleDefaults map[string]map[string]string
+}
+
+// MissingTags lists the required tags a resource does not have.
+type MissingTags struct {
+	Address string   `json:"address"`
+	Missing []string `json:"missing"`
+}
+
+func (missing MissingTags) String() string {
+	return fmt.Sprintf("%s is missing the required tags %v", TerraformAddress(missing.Address), missing.Missing)
+}
+
+// NewTagOptions returns tag options which look up the owner in the owner and team tags and the environment
+// in the environment and env tags.
+func NewTagOptions() *TagOptions {
+	return &TagOptions{
+		OwnerKeys:       []string{"owner", "team"},
+		EnvironmentKeys: []string{"environment", "env"},
+		ModuleDefaults:  make(map[string]map[string]string),
+	}
+}
+
+// ResolveRequestedTags resolves the tags as requested by the tag settings of the commands and the server, using the
+// default owner and environment keys. It does nothing unless the resources are grouped by a tag, their ownership is
+// added or tags are required. The module defaults are default tags by module path.
+func ResolveRequestedTags(nodeTable map[string]Node, groupBy string, ownership bool, required []string, moduleDefaults map[string]map[string]string) ([]MissingTags, error) {
+	if groupBy == "" && !ownership && len(required) == 0 {
+		return nil, nil
+	}
+	options := NewTagOptions()
+	options.GroupBy = groupBy
+	options.Ownership = ownership
+	options.Required = required
+	if moduleDefaults != nil {
+		options.ModuleDefaults = moduleDefaults
+	}
+	return ResolveTags(nodeTable, options)
+}
+
+// ParseModuleDefaultTags parses default tags of a module like module.network:team=net,env=prod. Without a module
+// path like team=net, the tags are default tags of the root module.
+func ParseModuleDefaultTags(definition string) (string, map[string]string, error) {
+	module := ""
+	tags := definition
+	if idx := strings.Index(definition, ":"); idx >= 0 && !strings.Contains(definition[:idx], "=") {
+		module, tags = definition[:idx], definition[idx+1:]
+	}
+	if module != "" && !strings.HasPrefix(module, "module.") {
+		return "", nil, fmt.Errorf("couldn't parse the given default tags '%s': the module path must start with 'module.'", definition)
+	}
+	defaults := make(map[string]string)
+	for _, pair := range strings.Split(tags, ",") {
+		key, value, found := strings.Cut(pair, "=")
+		if !found || strings.TrimSpace(key) == "" {
+			return "", nil, fmt.Errorf("couldn't parse the given default tags '%s': expected KEY=VALUE but got '%s'", definition, pair)
+		}
+		defaults[strings.TrimSpace(key)] = strings.TrimSpace(value)
+	}
+	return module, defaults, nil
+}
+
+// ResolveTags resolves the tags of every resource including the default tags inherited from its enclosing modules,
+// which are taken from the provider configurations of plans and the module defaults of the options.
+// Depending on the options, it adds the owner and environment of the resources as attributes, groups the resources
+// by the value of a tag below the group TagViewAddress and flags taggable resources without the required tags
+// under the attribute Attribute_missing_tags. Resources are taggable if their state has a tags or labels attribute.
+func ResolveTags(nodeTable map[string]Node, options *TagOptions) ([]MissingTags, error) {
+	providerDefaults := providerDefaultTags(nodeTable)
+
+	var view *Group
+	groupByAttributes, groupByKey := splitTagKey(options.GroupBy)
+	if options.GroupBy != "" {
+		removeSubtree(nodeTable, TagViewAddress)
+		var err error
+		view, err = NewGroup(TagViewAddress, Group_kind_tag_view, groupByKey)
+		if err != nil {
+			return nil, err
+		}
+		nodeTable[TagViewAddress] = view
+	}
+
+	var missingTags []MissingTags
+	for _, address := range sortedAddresses(nodeTable) {
+		resource, ok := nodeTable[address].(*Resource)
+		if !ok {
+			continue
+		}
+		parsed, ok := parseResourceAddress(address)
+		if !ok || parsed.Mode != Resource_mode_managed {
+			continue
+		}
+		state := effectiveState(resource)
+		if !isTaggable(state) {
+			continue
+		}
+		inherited := make(map[string]string)
+		provider := resourceProviderName(resource, parsed)
+		modules := append(moduleAncestors(parsed.Module), "")
+		for idx := len(modules) - 1; idx >= 0; idx-- {
+			for key, value := range options.ModuleDefaults[modules[idx]] {
+				inherited[key] = value
+			}
+			for key, value := range providerDefaults[providerDefaultsKey(StackOf(address), modules[idx], provider)] {
+				inherited[key] = value
+			}
+		}
+
+		if options.Ownership {
+			tags := resourceTags(state, inherited, nil)
+			if owner := firstTag(tags, options.OwnerKeys); owner != "" {
+				resource.AddAttribute(Attribute_owner, owner)
+			}
+			if environment := firstTag(tags, options.EnvironmentKeys); environment != "" {
+				resource.AddAttribute(Attribute_environment, environment)
+			}
+		}
+
+		if len(options.Required) > 0 {
+			tags := resourceTags(state, inherited, nil)
+			var missing []string
+			for _, key := range options.Required {
+				if tags[key] == "" {
+					missing = append(missing, key)
+				}
+			}
+			if len(missing) > 0 {
+				resource.AddAttribute(Attribute_missing_tags, missing)
+				missingTags = append(missingTags, MissingTags{Address: address, Missing: missing})
+			}
+		}
+
+		if view != nil {
+			value := resourceTags(state, inherited, groupByAttributes)[groupByKey]
+			err := addToTagGroup(nodeTable, view, address, value)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return missingTags, nil
+}
+
+// addToTagGroup adds the resource to the group of the tag value, or the untagged group if the value is empty.
+func addToTagGroup(nodeTable map[string]Node, view *Group, address string, value string) error {
+	groupAddress := TagViewAddress + "." + Group_kind_untagged
+	kind, name := Group_kind_untagged, Group_kind_untagged
+	if value != "" {
+		groupAddress = TagViewAddress + ".value[" + strconv.Quote(value) + "]"
+		kind, name = Group_kind_tag_value, value
+	}
+	group, ok := nodeTable[groupAddress].(*Group)
+	if !ok {
+		var err error
+		group, err = NewGroup(groupAddress, kind, name)
+		if err != nil {
+			return err
+		}
+		nodeTable[groupAddress] = group
+		view.AddChild(groupAddress)
+	}
+	group.AddMember(address)
+	return nil
+}
+
+// splitTagKey splits a tag key like tags.team into the state attributes to look it up in and the key itself.
+func splitTagKey(key string) ([]string, string) {
+	prefix, name, found := strings.Cut(key, ".")
+	if attributes, ok := tagAttributes[prefix]; found && ok {
+		return attributes, name
+	}
+	return nil, key
+}
+
+func isTaggable(state map[string]interface{}) bool {
+	for _, attributes := range tagAttributes {
+		for _, attribute := range attributes {
+			if _, ok := state[attribute]; ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// resourceTags merges the inherited tags with the tags of the given state attributes, or of all tag attributes if none are given.
+func resourceTags(state map[string]interface{}, inherited map[string]string, attributes []string) map[string]string {
+	if attributes == nil {
+		attributes = append(append([]string(nil), tagAttributes["labels"]...), tagAttributes["tags"]...)
+	}
+	tags := make(map[string]string, len(inherited))
+	for key, value := range inherited {
+		tags[key] = value
+	}
+	for _, attribute := range attributes {
+		values, _ := state[attribute].(map[string]interface{})
+		for key, value := range values {
+			if text, ok := value.(string); ok {
+				tags[key] = text
+			}
+		}
+	}
+	return tags
+}
+
+func firstTag(tags map[string]string, keys []string) string {
+	for _, key := range keys {
+		if value := tags[key]; value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func providerDefaultsKey(stack string, module string, provider string) string {
+	return stack + " " + module + " " + provider
+}
+
+// resourceProviderName returns the local name of the provider of a resource like aws, taken from the source address of
+// its provider or, if it isn't known, from the prefix of its type.
+func resourceProviderName(resource *Resource, parsed resourceAddress) string {
+	if resource.Provider != "" {
+		return resource.Provider[strings.LastIndex(resource.Provider, "/")+1:]
+	}
+	return providerOfType(parsed.Type)
+}
+
+// providerDefaultTags returns the constant default_tags of aws and default_labels of google provider configurations by
+// the stack, module and name of the provider they are configured for. Provider configurations are only known for plans.
+func providerDefaultTags(nodeTable map[string]Node) map[string]map[string]string {
+	defaults := make(map[string]map[string]string)
+	for _, address := range sortedAddresses(nodeTable) {
+		provider, ok := nodeTable[address].(*Provider)
+		if !ok {
+			continue
+		}
+		// the expressions are generic maps after a karen file was read and tfjson expressions after a plan was parsed
+		data, err := json.Marshal(provider.GetAttributes()["attributes"])
+		if err != nil {
+			continue
+		}
+		var expressions map[string]interface{}
+		if json.Unmarshal(data, &expressions) != nil {
+			continue
+		}
+
+		tags := make(map[string]string)
+		if block, ok := firstElement(expressions["default_tags"]).(map[string]interface{}); ok {
+			addConstantTags(tags, block["tags"])
+		}
+		addConstantTags(tags, expressions["default_labels"])
+		if len(tags) == 0 {
+			continue
+		}
+		module, _ := provider.GetAttributes()["moduleAddress"].(string)
+		name, _ := provider.GetAttributes()["name"].(string)
+		key := providerDefaultsKey(StackOf(address), module, name)
+		if defaults[key] == nil {
+			defaults[key] = make(map[string]string)
+		}
+		for tag, value := range tags {
+			defaults[key][tag] = value
+		}
+	}
+	return defaults
+}
+
+// addConstantTags adds the string values of the constant value of an expression to the tags.
+func addConstantTags(tags map[string]string, expression interface{}) {
+	object, _ := expression.(map[string]interface{})
+	values, _ := object["constant_value"].(map[string]interface{})
+	for key, value := range values {
+		if text, ok := value.(string); ok {
+			tags[key] = text
+		}
+	}
+}
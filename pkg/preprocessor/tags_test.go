@@ -0,0 +1,38 @@
+package preprocessor
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestResolveTagsAppliesProviderDefaultsToResourcesOfTheProvider(t *testing.T) {
+	nodeTable := map[string]Node{}
+	provider, _ := NewProvider(RootAddress+".provider.aws", []string{})
+	provider.AddAttribute("name", "aws")
+	provider.AddAttribute("moduleAddress", "")
+	provider.AddAttribute("attributes", map[string]interface{}{
+		"default_tags": []interface{}{map[string]interface{}{
+			"tags": map[string]interface{}{"constant_value": map[string]interface{}{"team": "platform"}},
+		}},
+	})
+	nodeTable[provider.GetAddress()] = provider
+
+	add := func(address string, providerSource string, state map[string]interface{}) {
+		resource, _ := NewResource(RootAddress+"."+address, nil)
+		resource.Provider = providerSource
+		resource.addState(State_planned, state)
+		nodeTable[resource.Address] = resource
+	}
+	add("aws_s3_bucket.logs", "registry.terraform.io/hashicorp/aws", map[string]interface{}{"tags": map[string]interface{}{}})
+	add("azurerm_resource_group.main", "registry.terraform.io/hashicorp/azurerm", map[string]interface{}{"tags": map[string]interface{}{}})
+	add("google_storage_bucket.data", "", map[string]interface{}{"labels": map[string]interface{}{"team": "data"}})
+
+	missingTags, err := ResolveRequestedTags(nodeTable, "", false, []string{"team"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []MissingTags{{Address: RootAddress + ".azurerm_resource_group.main", Missing: []string{"team"}}}
+	if !reflect.DeepEqual(missingTags, want) {
+		t.Errorf("got missing tags %+v, want %+v", missingTags, want)
+	}
+}
@@ -0,0 +1,266 @@
+package preprocessor
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	tfjson "github.com/hashicorp/terraform-json"
+)
+
+const (
+	raw_state_supported_version = 4
+	raw_state_status_tainted    = "tainted"
+)
+
+// rawState is the format terraform uses to persist states, e.g. in terraform.tfstate files or remote backends.
+type rawState struct {
+	Version          int                       `json:"version"`
+	TerraformVersion string                    `json:"terraform_version"`
+	Serial           uint64                    `json:"serial"`
+	Lineage          string                    `json:"lineage"`
+	Outputs          map[string]rawStateOutput `json:"outputs"`
+	Resources        []rawStateResource        `json:"resources"`
+}
+
+type rawStateOutput struct {
+	Value     interface{} `json:"value"`
+	Sensitive bool        `json:"sensitive,omitempty"`
+}
+
+type rawStateResource struct {
+	Module    string                     `json:"module,omitempty"`
+	Mode      string                     `json:"mode"`
+	Type      string                     `json:"type"`
+	Name      string                     `json:"name"`
+	Provider  string                     `json:"provider"`
+	Instances []rawStateResourceInstance `json:"instances"`
+}
+
+type rawStateResourceInstance struct {
+	IndexKey            interface{}            `json:"index_key,omitempty"`
+	Status              string                 `json:"status,omitempty"`
+	Deposed             string                 `json:"deposed,omitempty"`
+	SchemaVersion       uint64                 `json:"schema_version"`
+	Attributes          map[string]interface{} `json:"attributes,omitempty"`
+	SensitiveAttributes []rawStatePath         `json:"sensitive_attributes,omitempty"`
+	Dependencies        []string               `json:"dependencies,omitempty"`
+}
+
+// rawStatePath is a path to a value within the attributes of a resource instance.
+type rawStatePath []rawStatePathStep
+
+type rawStatePathStep struct {
+	// Type is either get_attr or index
+	Type  string          `json:"type"`
+	Value json.RawMessage `json:"value"`
+}
+
+// ParseRawStateFile takes a raw state file of version 4, as it is stored in terraform.tfstate files and remote backends,
+// and generates the same node table from it as ParseStateFile does for the json output of 'terraform show'.
+func ParseRawStateFile(stateFile []byte) (map[string]Node, error) {
+	state := new(rawState)
+	err := json.Unmarshal(stateFile, state)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't parse the given raw state file: %s", err.Error())
+	}
+	if state.Version != raw_state_supported_version {
+		return nil, fmt.Errorf("raw state version %d is not supported, only version %d is", state.Version, raw_state_supported_version)
+	}
+
+	rootModule, err := convertRawState(state)
+	if err != nil {
+		return nil, err
+	}
+	rootModule.Address = RootAddress
+
+	nodeTable := make(map[string]Node)
+	nodeTable, err = parseTfjsonStateModule(rootModule, nodeTable, State_current, RootAddress)
+	if err != nil {
+		return nil, err
+	}
+	return nodeTable, nil
+}
+
+// convertRawState converts the resources of a raw state into the module hierarchy of the json output of 'terraform show'.
+func convertRawState(state *rawState) (*tfjson.StateModule, error) {
+	rootModule := new(tfjson.StateModule)
+	modules := map[string]*tfjson.StateModule{"": rootModule}
+
+	var getModule func(address string) *tfjson.StateModule
+	getModule = func(address string) *tfjson.StateModule {
+		if module, ok := modules[address]; ok {
+			return module
+		}
+		module := &tfjson.StateModule{Address: address}
+		modules[address] = module
+		segments := splitAddress(address)
+		parent := getModule(strings.Join(segments[:len(segments)-2], "."))
+		parent.ChildModules = append(parent.ChildModules, module)
+		return module
+	}
+
+	for _, resource := range state.Resources {
+		module := getModule(resource.Module)
+		for _, instance := range resource.Instances {
+			stateResource, err := convertRawStateInstance(resource, instance)
+			if err != nil {
+				return nil, err
+			}
+			module.Resources = append(module.Resources, stateResource)
+		}
+	}
+	return rootModule, nil
+}
+
+func convertRawStateInstance(resource rawStateResource, instance rawStateResourceInstance) (*tfjson.StateResource, error) {
+	address := resource.Type + "." + resource.Name
+	if resource.Mode == Resource_mode_data {
+		address = "data." + address
+	}
+	index, err := formatIndexKey(instance.IndexKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid index key of %s: %s", address, err.Error())
+	}
+	address += index
+	if resource.Module != "" {
+		address = resource.Module + "." + address
+	}
+
+	stateResource := &tfjson.StateResource{
+		Address:         address,
+		Mode:            tfjson.ResourceMode(resource.Mode),
+		Type:            resource.Type,
+		Name:            resource.Name,
+		Index:           instance.IndexKey,
+		ProviderName:    providerNameOfConfig(resource.Provider),
+		SchemaVersion:   instance.SchemaVersion,
+		AttributeValues: instance.Attributes,
+		DependsOn:       instance.Dependencies,
+		Tainted:         instance.Status == raw_state_status_tainted,
+		DeposedKey:      instance.Deposed,
+	}
+
+	if len(instance.SensitiveAttributes) > 0 {
+		sensitiveValues := make(map[string]interface{})
+		for _, path := range instance.SensitiveAttributes {
+			err := addSensitivePath(sensitiveValues, path)
+			if err != nil {
+				return nil, fmt.Errorf("invalid sensitive attribute of %s: %s", address, err.Error())
+			}
+		}
+		stateResource.SensitiveValues, err = json.Marshal(sensitiveValues)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return stateResource, nil
+}
+
+// formatIndexKey formats the index key of a resource instance as it is shown in resource addresses, e.g. [0] or ["a"].
+func formatIndexKey(indexKey interface{}) (string, error) {
+	switch casted := indexKey.(type) {
+	case nil:
+		return "", nil
+	case float64:
+		return "[" + strconv.FormatFloat(casted, 'f', -1, 64) + "]", nil
+	case string:
+		return "[" + strconv.Quote(casted) + "]", nil
+	default:
+		return "", fmt.Errorf("unexpected index key of type %T", indexKey)
+	}
+}
+
+// providerNameOfConfig extracts the provider source address from a provider configuration address like
+// provider["registry.terraform.io/hashicorp/aws"].alias
+func providerNameOfConfig(providerConfig string) string {
+	start := strings.Index(providerConfig, "[\"")
+	end := strings.Index(providerConfig, "\"]")
+	if start < 0 || end < start {
+		return providerConfig
+	}
+	return providerConfig[start+2 : end]
+}
+
+// addSensitivePath marks the value at the path as sensitive in the nested structure of sensitive values,
+// which has the same form as the sensitive_values of the json output of 'terraform show'.
+func addSensitivePath(sensitiveValues map[string]interface{}, path rawStatePath) error {
+	if len(path) == 0 {
+		return nil
+	}
+	var current interface{} = sensitiveValues
+	var set func(value interface{})
+
+	for idx, step := range path {
+		if current == true {
+			// an enclosing value is already sensitive
+			return nil
+		}
+		isLast := idx == len(path)-1
+		var key interface{}
+		switch step.Type {
+		case "get_attr":
+			var name string
+			err := json.Unmarshal(step.Value, &name)
+			if err != nil {
+				return err
+			}
+			key = name
+		case "index":
+			var indexValue struct {
+				Value interface{} `json:"value"`
+			}
+			err := json.Unmarshal(step.Value, &indexValue)
+			if err != nil {
+				return err
+			}
+			key = indexValue.Value
+		default:
+			return fmt.Errorf("unknown path step type '%s'", step.Type)
+		}
+
+		switch casted := key.(type) {
+		case string:
+			object, ok := current.(map[string]interface{})
+			if !ok {
+				object = make(map[string]interface{})
+				set(object)
+			}
+			if isLast {
+				object[casted] = true
+				return nil
+			}
+			if _, ok := object[casted]; !ok {
+				object[casted] = nil
+			}
+			current = object[casted]
+			set = func(value interface{}) { object[casted] = value }
+		case float64:
+			if set == nil {
+				return fmt.Errorf("path must start with an attribute name")
+			}
+			position := int(casted)
+			list, ok := current.([]interface{})
+			if !ok {
+				list = nil
+			}
+			for len(list) <= position {
+				list = append(list, false)
+			}
+			set(list)
+			if isLast {
+				list[position] = true
+				return nil
+			}
+			if list[position] == false {
+				list[position] = nil
+			}
+			current = list[position]
+			set = func(value interface{}) { list[position] = value }
+		default:
+			return fmt.Errorf("unexpected path step value of type %T", key)
+		}
+	}
+	return nil
+}
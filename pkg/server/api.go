@@ -19,6 +19,7 @@ func NewApiServer(svc Service) *ApiServer {
 
 func (s *ApiServer) Start(listenAddr string) error {
 	http.HandleFunc("/parse", CORS(s.handlePostParseFile))
+	http.HandleFunc("/schema", CORS(s.handleGetSchema))
 	return http.ListenAndServe(listenAddr, nil)
 }
 
@@ -44,6 +45,20 @@ func (s *ApiServer) handlePostParseFile(w http.ResponseWriter, r *http.Request)
 	}
 }
 
+func (s *ApiServer) handleGetSchema(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case "GET":
+		schema, err := s.svc.GetSchema(context.Background())
+		if err != nil {
+			writeJSON(w, http.StatusInternalServerError, err)
+		} else {
+			writeJSON(w, http.StatusOK, schema)
+		}
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	}
+}
+
 func writeJSON(w http.ResponseWriter, s int, v any) error {
 	w.WriteHeader(s)
 	w.Header().Add("Content-Type", "application/json")
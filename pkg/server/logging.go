@@ -38,3 +38,14 @@ func (s *LoggingService) PostParseFile(data []byte, ctx context.Context) (parsed
 	}()
 	return s.next.PostParseFile(data, ctx)
 }
+
+func (s *LoggingService) GetSchema(ctx context.Context) (schema []byte, err error) {
+	defer func() {
+		if err != nil {
+			s.logger.Error().Err(err).Msg("")
+		} else {
+			s.logger.Info().Msg("served karen schema")
+		}
+	}()
+	return s.next.GetSchema(ctx)
+}
@@ -4,13 +4,17 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"net/url"
+	"strings"
 
 	"github.com/bfrn/karen-preprocessor/pkg/preprocessor"
+	"github.com/rs/zerolog/log"
 )
 
 type Service interface {
 	PostParseFile([]byte, context.Context) ([]byte, error)
+	GetSchema(context.Context) ([]byte, error)
 }
 
 type PreprocessorService struct {
@@ -23,7 +27,7 @@ func NewPreprocessorService() Service {
 func (p *PreprocessorService) PostParseFile(data []byte, ctx context.Context) ([]byte, error) {
 	var parseRequestData *ParseRequestData
 	var err error
-	var parsedModel map[string]preprocessor.Node
+	var document *preprocessor.KarenDocument
 
 	err = json.Unmarshal(data, &parseRequestData)
 	if err != nil {
@@ -32,10 +36,22 @@ func (p *PreprocessorService) PostParseFile(data []byte, ctx context.Context) ([
 	if len(parseRequestData.FileData) == 0 {
 		return nil, errors.New("empty file")
 	}
+	if parseRequestData.FileType == "" || parseRequestData.FileType == Auto {
+		inputKind, err := preprocessor.DetectInputKind([]byte(parseRequestData.FileData))
+		if err != nil {
+			return nil, err
+		}
+		parseRequestData.FileType = FileType(inputKind)
+	}
 
 	switch parseRequestData.FileType {
 	case State:
-		parsedModel, err = preprocessor.ParseStateFile([]byte(parseRequestData.FileData))
+		document, err = preprocessor.ParseDocument([]byte(parseRequestData.FileData), preprocessor.Input_kind_state, "", "")
+		if err != nil {
+			return nil, err
+		}
+	case TFState:
+		document, err = preprocessor.ParseDocument([]byte(parseRequestData.FileData), preprocessor.Input_kind_tfstate, "", "")
 		if err != nil {
 			return nil, err
 		}
@@ -45,15 +61,163 @@ func (p *PreprocessorService) PostParseFile(data []byte, ctx context.Context) ([
 		if err != nil {
 			return nil, err
 		}
-		parsedModel, err = preprocessor.ParsePlanFile([]byte(parseRequestData.FileData), u.Host, u.Path)
+		document, err = preprocessor.ParseDocument([]byte(parseRequestData.FileData), preprocessor.Input_kind_plan, u.Host, u.Path)
 		if err != nil {
 			return nil, err
 		}
 	case Karen:
-		return data, nil
+		document, err = preprocessor.ParseDocument([]byte(parseRequestData.FileData), preprocessor.Input_kind_karen, "", "")
+		if err != nil {
+			return nil, err
+		}
 	default:
 		return nil, errors.New("unknown file format")
 	}
 
-	return json.Marshal(parsedModel)
+	if parseRequestData.ProviderSchemas != "" {
+		err = preprocessor.EnrichWithProviderSchemas(document, []byte(parseRequestData.ProviderSchemas))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if parseRequestData.Classify || parseRequestData.Classification != "" {
+		registry := preprocessor.NewClassificationRegistry()
+		if parseRequestData.Classification != "" {
+			rules, err := preprocessor.ParseClassificationRules([]byte(parseRequestData.Classification))
+			if err != nil {
+				return nil, err
+			}
+			registry.Extend(rules)
+		}
+		document.Nodes = preprocessor.ClassifyResources(document.Nodes, registry)
+	}
+
+	if parseRequestData.ConsoleLinks || parseRequestData.ConsoleLinkRules != "" {
+		registry := preprocessor.NewConsoleLinkRegistry()
+		if parseRequestData.ConsoleLinkRules != "" {
+			rules, err := preprocessor.ParseConsoleLinkRules([]byte(parseRequestData.ConsoleLinkRules))
+			if err != nil {
+				return nil, err
+			}
+			registry.Extend(rules)
+		}
+		preprocessor.AddConsoleLinks(document.Nodes, registry)
+	}
+
+	if parseRequestData.NetworkView {
+		document.Nodes, err = preprocessor.AddNetworkView(document.Nodes)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if parseRequestData.InferEdges {
+		preprocessor.InferEdges(document.Nodes)
+	}
+
+	if parseRequestData.IAM {
+		preprocessor.ExtractIAMPermissions(document.Nodes)
+	}
+
+	missingTags, err := preprocessor.ResolveRequestedTags(document.Nodes, parseRequestData.GroupByTag, parseRequestData.Ownership,
+		parseRequestData.RequiredTags, parseRequestData.DefaultTags)
+	if err != nil {
+		return nil, err
+	}
+	for _, missing := range missingTags {
+		log.Warn().Msg(missing.String())
+	}
+
+	if parseRequestData.CodeOwners != "" {
+		err = addCodeOwners(document.Nodes, parseRequestData)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if parseRequestData.Exposure {
+		preprocessor.AnalyzeExposure(document.Nodes)
+	}
+
+	if parseRequestData.Policies != "" {
+		err = evaluatePolicies(document.Nodes, parseRequestData)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if parseRequestData.PriceSheet != "" {
+		sheet, err := preprocessor.ParsePriceSheet([]byte(parseRequestData.PriceSheet))
+		if err != nil {
+			return nil, err
+		}
+		preprocessor.EstimateCosts(document.Nodes, sheet)
+	}
+
+	if parseRequestData.Overlay != "" {
+		overlay, err := preprocessor.ParseOverlay([]byte(parseRequestData.Overlay))
+		if err != nil {
+			return nil, err
+		}
+		report := preprocessor.ApplyOverlay(document.Nodes, overlay)
+		if parseRequestData.Bare && len(report.Unmatched) > 0 {
+			return nil, fmt.Errorf("the overlay patterns %s match no node", strings.Join(report.Unmatched, ", "))
+		}
+		document.Metadata.Overlay = report
+	}
+
+	if parseRequestData.Bare {
+		return json.Marshal(document.Nodes)
+	}
+	return json.Marshal(document)
+}
+
+func (p *PreprocessorService) GetSchema(ctx context.Context) ([]byte, error) {
+	return preprocessor.KarenSchema(), nil
+}
+
+// addCodeOwners attaches the owners of the CODEOWNERS file to the modules and resources of the node table.
+func addCodeOwners(nodeTable map[string]preprocessor.Node, parseRequestData *ParseRequestData) error {
+	codeOwners, err := preprocessor.ParseCodeOwners([]byte(parseRequestData.CodeOwners))
+	if err != nil {
+		return err
+	}
+	prefix := parseRequestData.CodeOwnersPrefix
+	if prefix == "" {
+		u, err := url.Parse(parseRequestData.URL)
+		if err != nil {
+			return err
+		}
+		segments := strings.SplitN(strings.TrimPrefix(u.Path, "/"), "/", 3)
+		if len(segments) > 2 {
+			segments = segments[:2]
+		}
+		prefix = u.Host + "/" + strings.Join(segments, "/")
+	}
+	preprocessor.AddCodeOwners(nodeTable, codeOwners, prefix)
+	return nil
+}
+
+// evaluatePolicies attaches the findings of the policy set to the resources of the node table.
+func evaluatePolicies(nodeTable map[string]preprocessor.Node, parseRequestData *ParseRequestData) error {
+	policySet, err := preprocessor.ParsePolicySet([]byte(parseRequestData.Policies))
+	if err != nil {
+		return err
+	}
+	policyState := parseRequestData.PolicyState
+	if policyState == "" && (parseRequestData.FileType == State || parseRequestData.FileType == TFState) {
+		policyState = "current"
+	}
+	var state string
+	switch policyState {
+	case "", "planned":
+		state = preprocessor.State_planned
+	case "current":
+		state = preprocessor.State_current
+	default:
+		return fmt.Errorf("unknown policy state '%s'", policyState)
+	}
+	_, err = preprocessor.EvaluatePolicies(nodeTable, policySet, state)
+	return err
 }
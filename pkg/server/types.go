@@ -6,11 +6,57 @@ const (
 	Karen     FileType = "karen"
 	Plan      FileType = "plan"
 	State     FileType = "state"
+	TFState   FileType = "tfstate"
+	Auto      FileType = "auto"
 	Undefined FileType = "undefined"
 )
 
 type ParseRequestData struct {
-	FileData string   `json:"data"`
-	FileType FileType `json:"type"`
+	FileData string `json:"data"`
+	// FileType is detected from the content of the file if it is missing or auto
+	FileType FileType `json:"type,omitempty"`
 	URL      string   `json:"url,omitempty"`
+	// Bare requests the bare node table without the versioned envelope, as before karen version 1.0
+	Bare bool `json:"bare,omitempty"`
+	// ProviderSchemas optionally contains the output of 'terraform providers schema -json' which is used to annotate the resources.
+	// The schemas are part of the envelope, so bare responses only contain the schema keys of the resources
+	ProviderSchemas string `json:"providerSchemas,omitempty"`
+	// Classify adds the provider, service, category and icon of every resource as attributes
+	Classify bool `json:"classify,omitempty"`
+	// Classification optionally contains classification rules which take precedence over the built-in rules. It implies Classify.
+	Classification string `json:"classification,omitempty"`
+	// ConsoleLinks adds a link to the cloud console or kubernetes dashboard page of every resource as attribute
+	ConsoleLinks bool `json:"consoleLinks,omitempty"`
+	// ConsoleLinkRules optionally contains console link rules which take precedence over the built-in rules. It implies ConsoleLinks.
+	ConsoleLinkRules string `json:"consoleLinkRules,omitempty"`
+	// NetworkView adds groups which arrange the resources by account, region, network and subnet
+	NetworkView bool `json:"networkView,omitempty"`
+	// InferEdges adds inferred edges between resources whose attributes contain the identifier of another resource
+	InferEdges bool `json:"inferEdges,omitempty"`
+	// IAM adds edges from IAM roles, users and groups to the resources their policies allow actions on
+	IAM bool `json:"iam,omitempty"`
+	// GroupByTag adds groups which arrange the resources by the value of a tag or label like team, tags.team or labels.env
+	GroupByTag string `json:"groupByTag,omitempty"`
+	// Ownership adds the owner and environment of every resource, resolved from its tags, as attributes
+	Ownership bool `json:"ownership,omitempty"`
+	// RequiredTags flags taggable resources which miss one of these tags with the attribute missingTags
+	RequiredTags []string `json:"requiredTags,omitempty"`
+	// DefaultTags are default tags by module path like module.network which the resources of the module inherit. The root module has the empty path.
+	DefaultTags map[string]map[string]string `json:"defaultTags,omitempty"`
+	// CodeOwners optionally contains a GitHub or GitLab CODEOWNERS file whose owners are attached to the modules and resources
+	CodeOwners string `json:"codeOwners,omitempty"`
+	// CodeOwnersPrefix is the prefix of the locations which is the root of the repository, like github.com/org/repo.
+	// It defaults to the host and the first two path segments of the url.
+	CodeOwnersPrefix string `json:"codeOwnersPrefix,omitempty"`
+	// Exposure attaches to every resource which is reachable from the internet the ports and the chain of resources which expose it
+	Exposure bool `json:"exposure,omitempty"`
+	// PriceSheet optionally contains a json formatted price sheet used to add the estimated monthly cost of the resources and modules
+	PriceSheet string `json:"priceSheet,omitempty"`
+	// Overlay optionally contains a json formatted overlay file whose attributes are added to the nodes matching its address patterns.
+	// The patterns which matched no node are reported in the metadata of the envelope, bare requests are rejected if there are any
+	Overlay string `json:"overlay,omitempty"`
+	// Policies optionally contains a json formatted policy set whose findings are attached to the resources
+	Policies string `json:"policies,omitempty"`
+	// PolicyState is the state the policies are evaluated on. One of 'current' or 'planned', defaults to 'current' for state files and 'planned' otherwise.
+	PolicyState string `json:"policyState,omitempty"`
 }